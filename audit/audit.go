@@ -0,0 +1,156 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+var (
+	// Error is the default audit error class.
+	Error = errs.Class("audit error")
+	// TamperedError indicates that audit log chain is broken.
+	TamperedError = errs.Class("audit log tampered")
+)
+
+// DB exposes functionality to manage append-only audit log.
+//
+// architecture: Database
+type DB interface {
+	// Append links entry to the last one in the log, computes its hash and stores it.
+	Append(ctx context.Context, entry Entry) (Entry, error)
+	// List returns all entries ordered by id.
+	List(ctx context.Context) ([]Entry, error)
+}
+
+// Action defines what was requested.
+type Action string
+
+const (
+	// ActionCommitTx is a transfer request.
+	ActionCommitTx Action = "commit_tx"
+	// ActionMigrate is an application of database migrations.
+	ActionMigrate Action = "migrate"
+	// ActionLimitChange is a change of limits, allow-list, commission or other settings by config reload.
+	ActionLimitChange Action = "limit_change"
+	// ActionWebhookCreate is a creation of webhook subscription.
+	ActionWebhookCreate Action = "webhook_create"
+	// ActionWebhookDelete is a removal of webhook subscription.
+	ActionWebhookDelete Action = "webhook_delete"
+	// ActionBatchCreate is a creation of batch payout.
+	ActionBatchCreate Action = "batch_create"
+	// ActionScheduleCreate is a creation of scheduled transfer.
+	ActionScheduleCreate Action = "schedule_create"
+	// ActionScheduleCancel is a cancellation of scheduled transfer.
+	ActionScheduleCancel Action = "schedule_cancel"
+	// ActionBroadcastTx is a broadcast of a transfer signed offline.
+	ActionBroadcastTx Action = "broadcast_tx"
+)
+
+// Outcome defines result of the action.
+type Outcome string
+
+const (
+	// OutcomeSuccess indicates that action was done.
+	OutcomeSuccess Outcome = "success"
+	// OutcomeRejected indicates that action was refused because of invalid request.
+	OutcomeRejected Outcome = "rejected"
+	// OutcomeFailed indicates that action was accepted, but failed.
+	OutcomeFailed Outcome = "failed"
+)
+
+// Entry is a single audit log record.
+type Entry struct {
+	ID          int64     `json:"id"`
+	Action      Action    `json:"action"`
+	Actor       string    `json:"actor"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	RequestHash string    `json:"requestHash"`
+	Outcome     Outcome   `json:"outcome"`
+	ErrorClass  string    `json:"errorClass"`
+	Details     string    `json:"details"`
+	CreatedAt   time.Time `json:"createdAt"`
+	PrevHash    string    `json:"prevHash"`
+	Hash        string    `json:"hash"`
+}
+
+// ComputeHash calculates hash of the entry content chained to the previous entry hash.
+func (entry Entry) ComputeHash() string {
+	fields := []string{
+		entry.PrevHash,
+		strconv.FormatInt(entry.ID, 10),
+		string(entry.Action),
+		entry.Actor,
+		entry.RemoteAddr,
+		entry.RequestHash,
+		string(entry.Outcome),
+		entry.ErrorClass,
+		entry.Details,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+
+	hash := sha256.New()
+	for _, field := range fields {
+		// length prefix makes encoding unambiguous.
+		_, _ = hash.Write([]byte(strconv.Itoa(len(field)) + ":" + field))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Verify checks that entries ordered by id form unbroken hash chain.
+func Verify(entries []Entry) error {
+	var prev *Entry
+	for i := range entries {
+		entry := entries[i]
+
+		if prev == nil {
+			if entry.PrevHash != "" {
+				return TamperedError.New("entry %d: first entry has previous hash", entry.ID)
+			}
+		} else {
+			if entry.ID != prev.ID+1 {
+				return TamperedError.New("entry %d: expected id %d, entries are missing", entry.ID, prev.ID+1)
+			}
+			if entry.PrevHash != prev.Hash {
+				return TamperedError.New("entry %d: previous hash mismatch", entry.ID)
+			}
+		}
+
+		if entry.ComputeHash() != entry.Hash {
+			return TamperedError.New("entry %d: content does not match hash", entry.ID)
+		}
+
+		prev = &entries[i]
+	}
+
+	return nil
+}
+
+// HashRequest returns hex encoded sha256 of the request body.
+func HashRequest(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// ErrorClass returns names of all error classes wrapping the err.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var names []string
+	for _, class := range errs.Classes(err) {
+		names = append(names, string(*class))
+	}
+
+	return strings.Join(names, ": ")
+}
@@ -0,0 +1,30 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package audit
+
+import (
+	"context"
+)
+
+// Caller identifies who requested an action.
+type Caller struct {
+	// Identity is an api key fingerprint, or an operator name for CLI.
+	Identity    string
+	RemoteAddr  string
+	RequestHash string
+}
+
+// callerKey is used to store caller in context.Context.
+type callerKey struct{}
+
+// WithCaller returns a copy of ctx which carries the caller.
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns caller carried by ctx.
+func CallerFromContext(ctx context.Context) Caller {
+	caller, _ := ctx.Value(callerKey{}).(Caller)
+	return caller
+}
@@ -0,0 +1,51 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+// Service records actions to the audit log.
+//
+// architecture: Service
+type Service struct {
+	db DB
+}
+
+// NewService is a constructor for audit Service.
+func NewService(db DB) *Service {
+	return &Service{
+		db: db,
+	}
+}
+
+// Record appends action requested by the caller from ctx with its outcome.
+func (service *Service) Record(ctx context.Context, action Action, outcome Outcome, actionErr error, details string) error {
+	caller := CallerFromContext(ctx)
+
+	_, err := service.db.Append(ctx, Entry{
+		Action:      action,
+		Actor:       caller.Identity,
+		RemoteAddr:  caller.RemoteAddr,
+		RequestHash: caller.RequestHash,
+		Outcome:     outcome,
+		ErrorClass:  ErrorClass(actionErr),
+		Details:     details,
+		CreatedAt:   time.Now().UTC(),
+	})
+
+	return Error.Wrap(err)
+}
+
+// Verify checks that audit log was not tampered.
+func (service *Service) Verify(ctx context.Context) (int, error) {
+	entries, err := service.db.List(ctx)
+	if err != nil {
+		return 0, Error.Wrap(err)
+	}
+
+	return len(entries), Verify(entries)
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package batches
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/console"
+)
+
+var (
+	// Error is the default batches error class.
+	Error = errs.Class("batches error")
+	// ValidationError indicates that batch or some of its items are invalid.
+	ValidationError = errs.Class("batch validation error")
+	// ErrNotFound indicates that batch does not exist.
+	ErrNotFound = errs.Class("batch not found")
+)
+
+// DB exposes functionality to manage batch payouts.
+//
+// architecture: Database
+type DB interface {
+	// Create stores new batch with all its items.
+	Create(ctx context.Context, batch Batch) error
+	// Get returns batch with all its items ordered by index.
+	Get(ctx context.Context, id string) (Batch, error)
+
+	// Claim leases the oldest unfinished batch for the lease duration, so concurrent processors
+	// never process the same batch at once. returns ErrNotFound if there is nothing to process.
+	Claim(ctx context.Context, lease time.Duration) (Batch, error)
+	// Extend prolongs lease of the batch which is being processed.
+	Extend(ctx context.Context, id string, lease time.Duration) error
+	// UpdateItem stores status, transaction id and error of the batch item.
+	UpdateItem(ctx context.Context, batchID string, item Item) error
+	// Finish sets final status of the batch and releases its lease.
+	Finish(ctx context.Context, id string, status Status) error
+	// Release releases lease of unfinished batch, so it is processed again later.
+	Release(ctx context.Context, id string) error
+}
+
+// Status indicates state of the batch.
+type Status string
+
+const (
+	// StatusPending indicates that batch is waiting for processing.
+	StatusPending Status = "pending"
+	// StatusProcessing indicates that items of the batch are being sent.
+	StatusProcessing Status = "processing"
+	// StatusCompleted indicates that all items were sent.
+	StatusCompleted Status = "completed"
+	// StatusPartiallyFailed indicates that some items were sent and some failed.
+	StatusPartiallyFailed Status = "partially_failed"
+	// StatusFailed indicates that all items failed.
+	StatusFailed Status = "failed"
+)
+
+// ItemStatus indicates state of the batch item.
+type ItemStatus string
+
+const (
+	// ItemStatusPending indicates that item was not sent yet.
+	ItemStatusPending ItemStatus = "pending"
+	// ItemStatusProcessing indicates that item is being sent. Item which stays in this status
+	// after processor restart has unknown outcome and is not resent.
+	ItemStatusProcessing ItemStatus = "processing"
+	// ItemStatusSent indicates that transaction of the item was broadcasted.
+	ItemStatusSent ItemStatus = "sent"
+	// ItemStatusFailed indicates that item was not sent.
+	ItemStatusFailed ItemStatus = "failed"
+)
+
+// Batch is a list of transfers requested at once.
+type Batch struct {
+	ID     string `json:"id"`
+	Status Status `json:"status"`
+	Items  []Item `json:"items"`
+	// CreatedBy and RemoteAddr identify caller, items are recorded to the audit log on its behalf.
+	CreatedBy   string     `json:"createdBy"`
+	RemoteAddr  string     `json:"-"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// Item is a single transfer of the batch.
+type Item struct {
+	Index       int                 `json:"index"`
+	Transaction console.Transaction `json:"transaction"`
+	Status      ItemStatus          `json:"status"`
+	TxID        string              `json:"txId,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	UpdatedAt   time.Time           `json:"updatedAt"`
+}
+
+// Summary describes progress of the batch.
+type Summary struct {
+	Total      int `json:"total"`
+	Pending    int `json:"pending"`
+	Processing int `json:"processing"`
+	Sent       int `json:"sent"`
+	Failed     int `json:"failed"`
+	// SentAmount is a sum of sent amounts by currency.
+	SentAmount map[string]float64 `json:"sentAmount"`
+}
+
+// Summary returns progress of the batch.
+func (batch Batch) Summary() Summary {
+	summary := Summary{Total: len(batch.Items), SentAmount: map[string]float64{}}
+	for _, item := range batch.Items {
+		switch item.Status {
+		case ItemStatusPending:
+			summary.Pending++
+		case ItemStatusProcessing:
+			summary.Processing++
+		case ItemStatusSent:
+			summary.Sent++
+			summary.SentAmount[item.Transaction.Currency] += item.Transaction.Amount
+		case ItemStatusFailed:
+			summary.Failed++
+		}
+	}
+
+	return summary
+}
+
+// FinalStatus returns status of the batch after all items are processed.
+func (summary Summary) FinalStatus() Status {
+	switch {
+	case summary.Failed == 0:
+		return StatusCompleted
+	case summary.Sent == 0 && summary.Processing == 0:
+		return StatusFailed
+	default:
+		return StatusPartiallyFailed
+	}
+}
+
+// InvalidItem describes why batch item is invalid.
+type InvalidItem struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// InvalidItemsError is returned when some items of the batch are invalid, no item is sent in that case.
+type InvalidItemsError struct {
+	Items []InvalidItem
+}
+
+// Error implements error interface.
+func (err *InvalidItemsError) Error() string {
+	messages := make([]string, 0, len(err.Items))
+	for _, item := range err.Items {
+		messages = append(messages, fmt.Sprintf("item %d: %s", item.Index, item.Error))
+	}
+
+	return strings.Join(messages, "; ")
+}
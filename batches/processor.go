@@ -0,0 +1,246 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package batches
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/audit"
+	"paxful/console"
+	"paxful/internal/logger"
+	"paxful/payments"
+)
+
+// Config contains configuration for batch payouts.
+type Config struct {
+	Interval    time.Duration `json:"interval" help:"how often pending batches are checked" default:"5s"`
+	MaxItems    int           `json:"maxItems" help:"maximum amount of transfers in a single batch" default:"1000"`
+	Concurrency int           `json:"concurrency" help:"amount of transfers sent at once for currencies without nonce ordering" default:"4"`
+	Lease       time.Duration `json:"lease" help:"how long batch is locked by processor without progress" default:"5m"`
+}
+
+// sequential are currencies whose transfers depend on account nonce, so they are sent one by one in batch order.
+var sequential = map[string]bool{
+	string(payments.PaymentCurrencyETH): true,
+}
+
+// Processor sends items of pending batches.
+//
+// architecture: Worker
+type Processor struct {
+	log     logger.Logger
+	config  Config
+	db      DB
+	console *console.Service
+}
+
+// NewProcessor is a constructor for batches Processor.
+func NewProcessor(log logger.Logger, config Config, db DB, console *console.Service) *Processor {
+	return &Processor{
+		log:     log,
+		config:  config,
+		db:      db,
+		console: console,
+	}
+}
+
+// Run processes pending batches every interval until ctx is done.
+func (processor *Processor) Run(ctx context.Context) error {
+	interval := processor.config.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := processor.Process(ctx); err != nil {
+			processor.log.Error("could not process batch", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process claims and sends single pending batch.
+func (processor *Processor) Process(ctx context.Context) (err error) {
+	lease := processor.lease()
+
+	batch, err := processor.db.Claim(ctx, lease)
+	if err != nil {
+		if ErrNotFound.Has(err) {
+			return nil
+		}
+		return Error.Wrap(err)
+	}
+
+	log := processor.log.With(logger.String("batchID", batch.ID))
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	var heartbeat sync.WaitGroup
+	heartbeat.Add(1)
+	go func() {
+		defer heartbeat.Done()
+		processor.heartbeat(heartbeatCtx, log, batch.ID, lease)
+	}()
+	defer func() {
+		stopHeartbeat()
+		heartbeat.Wait()
+	}()
+
+	groups := make(map[string][]int)
+	for index, item := range batch.Items {
+		switch item.Status {
+		case ItemStatusPending:
+			currency := item.Transaction.Currency
+			groups[currency] = append(groups[currency], index)
+		case ItemStatusProcessing:
+			// processor was stopped while item was being sent, it could be already broadcasted.
+			batch.Items[index].Status = ItemStatusFailed
+			batch.Items[index].Error = "processing was interrupted, outcome is unknown, check transactions before resending"
+			if err := processor.db.UpdateItem(ctx, batch.ID, batch.Items[index]); err != nil {
+				return Error.Wrap(err)
+			}
+		}
+	}
+
+	var group errs.Group
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for currency, indexes := range groups {
+		concurrency := processor.config.Concurrency
+		if concurrency <= 0 || sequential[currency] {
+			concurrency = 1
+		}
+
+		wg.Add(1)
+		go func(indexes []int, concurrency int) {
+			defer wg.Done()
+			err := processor.send(ctx, log, &batch, indexes, concurrency)
+
+			mu.Lock()
+			group.Add(err)
+			mu.Unlock()
+		}(indexes, concurrency)
+	}
+	wg.Wait()
+
+	summary := batch.Summary()
+	if err := group.Err(); err != nil || summary.Pending > 0 {
+		// batch is retried when service is available again.
+		return errs.Combine(Error.Wrap(err), Error.Wrap(processor.db.Release(ctx, batch.ID)))
+	}
+
+	status := summary.FinalStatus()
+	log.Info("batch processed", logger.String("status", string(status)),
+		logger.Any("sent", summary.Sent), logger.Any("failed", summary.Failed))
+
+	return Error.Wrap(processor.db.Finish(ctx, batch.ID, status))
+}
+
+// send sends items with given indexes in order with at most concurrency transfers at once.
+// sending stops when console service becomes unavailable, remaining items stay pending.
+func (processor *Processor) send(ctx context.Context, log logger.Logger, batch *Batch, indexes []int, concurrency int) error {
+	caller := audit.Caller{Identity: batch.CreatedBy, RemoteAddr: batch.RemoteAddr}
+
+	var group errs.Group
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, concurrency)
+	stopped := make(chan struct{})
+	var stopOnce sync.Once
+
+	for _, index := range indexes {
+		select {
+		case <-ctx.Done():
+		case <-stopped:
+		case limiter <- struct{}{}:
+			wg.Add(1)
+			go func(item *Item) {
+				defer wg.Done()
+				defer func() { <-limiter }()
+
+				unavailable, err := processor.sendItem(ctx, log, batch.ID, caller, item)
+				if unavailable {
+					stopOnce.Do(func() { close(stopped) })
+				}
+
+				mu.Lock()
+				group.Add(err)
+				mu.Unlock()
+			}(&batch.Items[index])
+			continue
+		}
+		break
+	}
+	wg.Wait()
+
+	return group.Err()
+}
+
+// sendItem sends single item and stores its result, returns true if console service does not accept transfers.
+func (processor *Processor) sendItem(ctx context.Context, log logger.Logger, batchID string, caller audit.Caller, item *Item) (bool, error) {
+	item.Status = ItemStatusProcessing
+	item.UpdatedAt = time.Now().UTC()
+	if err := processor.db.UpdateItem(ctx, batchID, *item); err != nil {
+		item.Status = ItemStatusPending
+		return false, err
+	}
+
+	// transfer is not interrupted by shutdown, console service waits for it while draining.
+	sendCtx := audit.WithCaller(logger.WithContext(context.Background(), log), caller)
+	tx, err := processor.console.CommitTx(sendCtx, item.Transaction)
+
+	unavailable := console.UnavailableError.Has(err)
+	switch {
+	case unavailable:
+		item.Status = ItemStatusPending
+	case err != nil:
+		item.Status = ItemStatusFailed
+		item.Error = err.Error()
+		log.Warn("batch item failed", logger.Any("index", item.Index), logger.String("error", err.Error()))
+	default:
+		item.Status = ItemStatusSent
+		item.TxID = tx.ID
+	}
+	item.UpdatedAt = time.Now().UTC()
+
+	// result must be stored even if processor is stopping.
+	return unavailable, processor.db.UpdateItem(context.Background(), batchID, *item)
+}
+
+// heartbeat extends lease of the batch until ctx is done.
+func (processor *Processor) heartbeat(ctx context.Context, log logger.Logger, id string, lease time.Duration) {
+	ticker := time.NewTicker(lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := processor.db.Extend(ctx, id, lease); err != nil {
+				log.Error("could not extend batch lease", err)
+			}
+		}
+	}
+}
+
+// lease returns configured lease duration.
+func (processor *Processor) lease() time.Duration {
+	if processor.config.Lease <= 0 {
+		return 5 * time.Minute
+	}
+
+	return processor.config.Lease
+}
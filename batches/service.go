@@ -0,0 +1,137 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package batches
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/audit"
+	"paxful/console"
+)
+
+// Service exposes functionality to create and query batch payouts.
+//
+// architecture: Service
+type Service struct {
+	config  Config
+	db      DB
+	console *console.Service
+	audit   *audit.Service
+}
+
+// NewService is a constructor for batches Service.
+func NewService(config Config, db DB, console *console.Service, audit *audit.Service) *Service {
+	return &Service{
+		config:  config,
+		db:      db,
+		console: console,
+		audit:   audit,
+	}
+}
+
+// Create validates all transfers and stores them as a new batch, which is sent by Processor.
+// returns ValidationError wrapping InvalidItemsError if any transfer is invalid, nothing is stored in that case.
+func (service *Service) Create(ctx context.Context, transactions []console.Transaction) (_ Batch, err error) {
+	var batch Batch
+	defer func() { err = errs.Combine(err, service.record(ctx, batch, len(transactions), err)) }()
+
+	if len(transactions) == 0 {
+		return Batch{}, ValidationError.New("batch is empty")
+	}
+	if service.config.MaxItems > 0 && len(transactions) > service.config.MaxItems {
+		return Batch{}, ValidationError.New("batch contains %d items, maximum is %d", len(transactions), service.config.MaxItems)
+	}
+
+	var invalid []InvalidItem
+	for index, transaction := range transactions {
+		if transaction.Scheduled() {
+			invalid = append(invalid, InvalidItem{Index: index, Error: "scheduled transfers are not supported in batches"})
+			continue
+		}
+		if err := service.console.Validate(ctx, transaction); err != nil {
+			invalid = append(invalid, InvalidItem{Index: index, Error: err.Error()})
+		}
+	}
+	if len(invalid) > 0 {
+		return Batch{}, ValidationError.Wrap(&InvalidItemsError{Items: invalid})
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return Batch{}, Error.Wrap(err)
+	}
+
+	caller := audit.CallerFromContext(ctx)
+	now := time.Now().UTC()
+
+	batch = Batch{
+		ID:         id,
+		Status:     StatusPending,
+		CreatedBy:  caller.Identity,
+		RemoteAddr: caller.RemoteAddr,
+		CreatedAt:  now,
+	}
+	for index, transaction := range transactions {
+		batch.Items = append(batch.Items, Item{
+			Index:       index,
+			Transaction: transaction,
+			Status:      ItemStatusPending,
+			UpdatedAt:   now,
+		})
+	}
+
+	if err = service.db.Create(ctx, batch); err != nil {
+		batch = Batch{}
+		return Batch{}, Error.Wrap(err)
+	}
+
+	return batch, nil
+}
+
+// Get returns batch with per-item results.
+func (service *Service) Get(ctx context.Context, id string) (Batch, error) {
+	batch, err := service.db.Get(ctx, id)
+	if ErrNotFound.Has(err) {
+		return Batch{}, err
+	}
+
+	return batch, Error.Wrap(err)
+}
+
+// record writes batch creation to the audit log, transfers of the batch are recorded one by one when sent.
+func (service *Service) record(ctx context.Context, batch Batch, items int, actionErr error) error {
+	outcome := audit.OutcomeSuccess
+	switch {
+	case ValidationError.Has(actionErr):
+		outcome = audit.OutcomeRejected
+	case actionErr != nil:
+		outcome = audit.OutcomeFailed
+	}
+
+	details, err := json.Marshal(struct {
+		BatchID string `json:"batchId,omitempty"`
+		Items   int    `json:"items"`
+	}{BatchID: batch.ID, Items: items})
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	return service.audit.Record(ctx, audit.ActionBatchCreate, outcome, actionErr, string(details))
+}
+
+// randomHex returns hex encoded random bytes.
+func randomHex(size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
@@ -4,29 +4,42 @@
 package main
 
 import (
+	"bufio"
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"os/user"
 	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/zeebo/errs"
 
 	"paxful"
+	"paxful/audit"
+	"paxful/internal/cfgstruct"
+	"paxful/internal/logger"
 	"paxful/internal/logger/zaplog"
 	"paxful/paxfuldb"
 )
 
 var Error = errs.Class("paxful payments CLI error")
 
+// envPrefix is a prefix of environment variables which override config values, e.g. PAXFUL_SERVER_ADDRESS.
+const envPrefix = "PAXFUL_"
+
 // Config is the global configuration to interact with paxful payment service through CLI.
 type Config struct {
-	DatabaseURL   string `json:"databaseUrl"`
+	DatabaseURL   string `json:"databaseUrl" help:"postgres connection url of paxful database" validate:"required,url" secret:"true"`
 	paxful.Config `json:"config"`
 }
 
@@ -36,12 +49,14 @@ var (
 	rootCmd = &cobra.Command{
 		Use:   "payments",
 		Short: "CLI for interacting with paxful payment service",
+		// usage is printed only for invalid arguments, not for runtime errors.
+		SilenceUsage: true,
 	}
 
 	// payments setup cmd.
 	setupCmd = &cobra.Command{
 		Use:         "setup",
-		Short:       "setups the program config, creates database",
+		Short:       "creates config and database if they do not exist, applies migrations",
 		RunE:        cmdSetup,
 		Annotations: map[string]string{"type": "setup"},
 	}
@@ -51,15 +66,77 @@ var (
 		RunE:        cmdRun,
 		Annotations: map[string]string{"type": "run"},
 	}
+	migrateCmd = &cobra.Command{
+		Use:         "migrate",
+		Short:       "applies pending database migrations",
+		RunE:        cmdMigrate,
+		Annotations: map[string]string{"type": "setup"},
+	}
+	auditCmd = &cobra.Command{
+		Use:   "audit",
+		Short: "audit log related commands",
+	}
+	auditVerifyCmd = &cobra.Command{
+		Use:         "verify",
+		Short:       "verifies that audit log hash chain was not tampered",
+		RunE:        cmdAuditVerify,
+		Annotations: map[string]string{"type": "run"},
+	}
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "config related commands",
+	}
+	configValidateCmd = &cobra.Command{
+		Use:         "validate",
+		Short:       "validates config and reports every invalid field",
+		RunE:        cmdConfigValidate,
+		Annotations: map[string]string{"type": "setup"},
+	}
+	configShowCmd = &cobra.Command{
+		Use:         "show",
+		Short:       "prints resolved config with redacted secrets",
+		RunE:        cmdConfigShow,
+		Annotations: map[string]string{"type": "setup"},
+	}
+	configEncryptCmd = &cobra.Command{
+		Use:         "encrypt",
+		Short:       "encrypts secret read from stdin with master key, prints value for config",
+		RunE:        cmdConfigEncrypt,
+		Annotations: map[string]string{"type": "setup"},
+	}
 	runCfg   Config
 	setupCfg Config
 
+	// setup flags.
+	setupForce  bool
+	setupDryRun bool
+
+	// configPath is an explicit path to config file.
+	configPath string
+	// masterKeyPath is a path to file with hex encoded master key which decrypts `enc:` config values.
+	masterKeyPath string
+
 	defaultConfigDir = applicationDir("paxful")
 )
 
 func init() {
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(setupCmd)
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(auditCmd)
+	rootCmd.AddCommand(configCmd)
+	auditCmd.AddCommand(auditVerifyCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configEncryptCmd)
+
+	setupCmd.Flags().BoolVar(&setupForce, "force", false, "overwrite existing config file")
+	setupCmd.Flags().BoolVar(&setupDryRun, "dry-run", false, "print what would be done without changing anything")
+
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&configPath, "config", "", "path to config file, config.json in application directory by default (env "+envPrefix+"CONFIG)")
+	flags.StringVar(&masterKeyPath, "master-key-file", "", "path to file with hex encoded master key which decrypts enc: config values (env "+envPrefix+"MASTER_KEY_FILE, or key itself in "+envPrefix+"MASTER_KEY)")
+	cfgstruct.BindFlags(flags, &Config{}, envPrefix)
 }
 
 func main() {
@@ -70,15 +147,22 @@ func main() {
 }
 
 func cmdRun(cmd *cobra.Command, args []string) (err error) {
-	ctx := context.Background()
+	ctx, cancel := withSignals(context.Background())
+	defer cancel()
 	log := zaplog.NewLog()
 
-	runCfg, err = readConfig()
+	runCfg, err = readConfig(cmd.Flags())
 	if err != nil {
-		log.Error("Could not read config from default place", Error.Wrap(err))
+		log.Error("Could not read config", Error.Wrap(err))
 		return Error.Wrap(err)
 	}
 
+	log, err = zaplog.New(runCfg.Log)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+	log.Debug("config loaded", logger.Any("config", cfgstruct.Redact(&runCfg, envPrefix)))
+
 	db, err := paxfuldb.NewDatabase(runCfg.DatabaseURL)
 	if err != nil {
 		log.Error("Error starting master database on paxful payment service", Error.Wrap(err))
@@ -94,83 +178,191 @@ func cmdRun(cmd *cobra.Command, args []string) (err error) {
 		return Error.Wrap(err)
 	}
 
+	file, _ := configFile()
+	peer.WatchConfig(file, func() (paxful.Config, error) {
+		config, err := readConfig(cmd.Flags())
+		if err != nil {
+			return paxful.Config{}, err
+		}
+		if config.DatabaseURL != runCfg.DatabaseURL {
+			return paxful.Config{}, paxful.ReloadError.New("databaseUrl could not be changed without restart")
+		}
+
+		return config.Config, nil
+	})
+
+	// peer is closed before deferred db.Close, so in-flight transfers are stored before db is gone.
 	runError := peer.Run(ctx)
 	closeError := peer.Close()
 	return Error.Wrap(errs.Combine(runError, closeError))
 }
 
-func cmdSetup(cmd *cobra.Command, args []string) (err error) {
+// withSignals returns context which is canceled on SIGINT or SIGTERM.
+// the second signal terminates the process immediately.
+func withSignals(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(signals)
+			return
+		}
+
+		<-signals
+		os.Exit(1)
+	}()
+
+	return ctx, cancel
+}
+
+func cmdMigrate(cmd *cobra.Command, args []string) (err error) {
 	ctx := context.Background()
 	log := zaplog.NewLog()
 
-	setupDir, err := filepath.Abs(defaultConfigDir)
+	runCfg, err = readConfig(cmd.Flags())
 	if err != nil {
+		log.Error("Could not read config", Error.Wrap(err))
 		return Error.Wrap(err)
 	}
 
-	err = os.MkdirAll(setupDir, os.ModePerm)
+	db, err := paxfuldb.NewDatabase(runCfg.DatabaseURL)
 	if err != nil {
+		log.Error("could not connect to paxfuldb", Error.Wrap(err))
 		return Error.Wrap(err)
 	}
+	defer func() {
+		err = errs.Combine(err, db.Close())
+	}()
 
-	configFile, err := os.Create(path.Join(setupDir, "config.json"))
+	err = db.CreateSchema(ctx)
 	if err != nil {
-		log.Error("could not create config file", Error.Wrap(err))
+		log.Error("can not apply database migrations", Error.Wrap(err))
 		return Error.Wrap(err)
 	}
-	defer func() {
-		err = errs.Combine(err, configFile.Close())
-	}()
 
-	jsonData, err := json.MarshalIndent(setupCfg, "", "    ")
+	err = audit.NewService(db.Audit()).Record(withOperator(ctx), audit.ActionMigrate, audit.OutcomeSuccess, nil, "")
 	if err != nil {
-		log.Error("could not marshal config", Error.Wrap(err))
+		log.Error("can not record migration to audit log", Error.Wrap(err))
 		return Error.Wrap(err)
 	}
 
-	_, err = configFile.Write(jsonData)
+	return nil
+}
+
+func cmdAuditVerify(cmd *cobra.Command, args []string) (err error) {
+	ctx := context.Background()
+	log := zaplog.NewLog()
+
+	runCfg, err = readConfig(cmd.Flags())
 	if err != nil {
-		log.Error("could not write to config", Error.Wrap(err))
+		log.Error("Could not read config", Error.Wrap(err))
 		return Error.Wrap(err)
 	}
 
-	conn, err := sql.Open("postgres", setupCfg.DatabaseURL)
+	db, err := paxfuldb.NewDatabase(runCfg.DatabaseURL)
 	if err != nil {
-		log.Error("could not connect to database server", Error.Wrap(err))
+		log.Error("could not connect to paxfuldb", Error.Wrap(err))
 		return Error.Wrap(err)
 	}
 	defer func() {
-		err = errs.Combine(err, conn.Close())
+		err = errs.Combine(err, db.Close())
 	}()
 
-	createDBQuery := "CREATE DATABASE paxfuldb;"
+	count, err := audit.NewService(db.Audit()).Verify(ctx)
+	if err != nil {
+		log.Error("audit log verification failed", Error.Wrap(err))
+		return Error.Wrap(err)
+	}
+
+	fmt.Printf("audit log is intact, %d entries verified\n", count)
+	return nil
+}
+
+// withOperator returns a copy of ctx which carries operator who runs CLI as audit caller.
+func withOperator(ctx context.Context) context.Context {
+	identity := "cli"
+	if current, err := user.Current(); err == nil {
+		identity = "cli:" + current.Username
+	}
+
+	hostname, _ := os.Hostname()
+
+	return audit.WithCaller(ctx, audit.Caller{
+		Identity:   identity,
+		RemoteAddr: hostname,
+	})
+}
+
+// cmdConfigValidate reports every invalid config field.
+func cmdConfigValidate(cmd *cobra.Command, args []string) error {
+	path, _ := configFile()
 
-	_, err = conn.ExecContext(ctx, createDBQuery)
+	_, err := readConfig(cmd.Flags())
 	if err != nil {
-		log.Error("can not create paxfuldb", Error.Wrap(err))
+		var invalid cfgstruct.Errors
+		if !errors.As(err, &invalid) {
+			return Error.Wrap(err)
+		}
+
+		for _, field := range invalid {
+			fmt.Printf("%s: %s\n", field.Key, field.Message)
+		}
+		return Error.New("config %s has %d invalid fields", path, len(invalid))
+	}
+
+	fmt.Printf("config %s is valid\n", path)
+	return nil
+}
+
+// cmdConfigShow prints config, which is used by other commands, with every secret redacted.
+func cmdConfigShow(cmd *cobra.Command, args []string) error {
+	config, err := readConfig(cmd.Flags())
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	jsonData, err := json.MarshalIndent(cfgstruct.Redact(&config, envPrefix), "", "    ")
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	fmt.Println(string(jsonData))
+	return nil
+}
+
+// cmdConfigEncrypt encrypts the first line of stdin, so secret does not stay in shell history.
+func cmdConfigEncrypt(cmd *cobra.Command, args []string) error {
+	key, err := masterKey()
+	if err != nil {
+		return Error.Wrap(err)
+	}
+	if key == nil {
+		return Error.New("master key is not set, use --master-key-file or %sMASTER_KEY", envPrefix)
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
 		return Error.Wrap(err)
 	}
 
-	createTableQuery :=
-		`
-		CREATE TABLE transactions (
-			id            TEXT   NOT NULL,
-			currency 	  TEXT   NOT NULL,
-			amount        bigint NOT NULL,
-			fee           bigint NOT NULL,
-			fromAddress   TEXT   NOT NULL,
-			toAddress     TEXT   NOT NULL,
-			created_at    timestamp with time zone NOT NULL
-		);
-		`
+	secret := strings.TrimRight(line, "\r\n")
+	if secret == "" {
+		return Error.New("secret is empty")
+	}
 
-	_, err = conn.ExecContext(ctx, createTableQuery)
+	encrypted, err := cfgstruct.Encrypt(key, secret)
 	if err != nil {
-		log.Error("can not create transactions table", Error.Wrap(err))
 		return Error.Wrap(err)
 	}
 
-	return err
+	fmt.Println(encrypted)
+	return nil
 }
 
 // TODO: below functions should be placed in another place and be refactored, but i'm facing real lack of time.
@@ -212,12 +404,90 @@ func applicationDir(subdir ...string) string {
 	return filepath.Join(append([]string{appdir}, subdir...)...)
 }
 
-// readConfig reads config from default config dir.
-func readConfig() (config Config, err error) {
-	configBytes, err := ioutil.ReadFile(path.Join(defaultConfigDir, "config.json"))
-	if err != nil {
+// configFile returns path to config file and whether it was set explicitly.
+func configFile() (string, bool) {
+	if configPath != "" {
+		return configPath, true
+	}
+	if fromEnv := os.Getenv(envPrefix + "CONFIG"); fromEnv != "" {
+		return fromEnv, true
+	}
+
+	return path.Join(defaultConfigDir, "config.json"), false
+}
+
+// readConfig loads config with precedence, from lowest to highest: `default` tags, config file,
+// PAXFUL_* environment variables and flags, then secret references are resolved. config file in default
+// place is optional, explicitly set one must exist. returned cfgstruct.Errors contains every invalid field.
+func readConfig(flags *pflag.FlagSet) (config Config, err error) {
+	file, explicit := configFile()
+
+	err = cfgstruct.Load(&config, file, !explicit, flags, envPrefix)
+
+	var invalid cfgstruct.Errors
+	if err != nil && !errors.As(err, &invalid) {
 		return Config{}, err
 	}
 
-	return config, json.Unmarshal(configBytes, &config)
+	err = resolveSecrets(&config)
+	if err != nil {
+		var unresolved cfgstruct.Errors
+		if !errors.As(err, &unresolved) {
+			return Config{}, err
+		}
+		invalid = append(invalid, unresolved...)
+	}
+
+	if validateErr := cfgstruct.Validate(&config, envPrefix); validateErr != nil {
+		// field which could not be loaded or resolved is reported once.
+		reported := make(map[string]bool, len(invalid))
+		for _, field := range invalid {
+			reported[field.Key] = true
+		}
+
+		var validation cfgstruct.Errors
+		errors.As(validateErr, &validation)
+		for _, field := range validation {
+			if !reported[field.Key] {
+				invalid = append(invalid, field)
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return Config{}, invalid
+	}
+
+	return config, nil
+}
+
+// resolveSecrets replaces env:, file: and enc: references of secret fields with their values.
+func resolveSecrets(config *Config) error {
+	key, err := masterKey()
+	if err != nil {
+		return err
+	}
+
+	return cfgstruct.Resolve(config, envPrefix, key)
+}
+
+// masterKey returns master key from --master-key-file, PAXFUL_MASTER_KEY_FILE or PAXFUL_MASTER_KEY,
+// nil is returned if master key is not set.
+func masterKey() ([]byte, error) {
+	keyPath := masterKeyPath
+	if keyPath == "" {
+		keyPath = os.Getenv(envPrefix + "MASTER_KEY_FILE")
+	}
+	if keyPath != "" {
+		data, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			return nil, Error.New("could not read master key file %s", keyPath)
+		}
+		return cfgstruct.ParseMasterKey(string(data))
+	}
+
+	if raw := os.Getenv(envPrefix + "MASTER_KEY"); raw != "" {
+		return cfgstruct.ParseMasterKey(raw)
+	}
+
+	return nil, nil
 }
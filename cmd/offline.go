@@ -0,0 +1,205 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"paxful/audit"
+	"paxful/console"
+	"paxful/internal/keystore"
+	"paxful/internal/logger"
+	"paxful/payments"
+	"paxful/payments/paymentseth"
+)
+
+// commands
+var (
+	txPrepareCmd = &cobra.Command{
+		Use:         "prepare",
+		Short:       "exports unsigned transfer from cold wallet address with nonce, gas and chain id filled",
+		Args:        cobra.NoArgs,
+		RunE:        cmdTxPrepare,
+		Annotations: map[string]string{"type": "run"},
+	}
+	signCmd = &cobra.Command{
+		Use:         "sign <unsigned.json>",
+		Short:       "signs exported transfer with a key from keystore, does not need network or config",
+		Args:        cobra.ExactArgs(1),
+		RunE:        cmdSign,
+		Annotations: map[string]string{"type": "setup"},
+	}
+	broadcastCmd = &cobra.Command{
+		Use:         "broadcast <signed.json>",
+		Short:       "sends transfer signed offline and stores it like any other transfer",
+		Args:        cobra.ExactArgs(1),
+		RunE:        cmdBroadcast,
+		Annotations: map[string]string{"type": "run"},
+	}
+
+	txPrepareCfg struct {
+		From string
+		Out  string
+	}
+	signCfg struct {
+		Name         string
+		Keystore     string
+		PasswordFile string
+		Out          string
+	}
+)
+
+func init() {
+	txCmd.AddCommand(txPrepareCmd)
+	rootCmd.AddCommand(signCmd)
+	rootCmd.AddCommand(broadcastCmd)
+
+	prepare := txPrepareCmd.Flags()
+	prepare.StringVar(&txSendCfg.Currency, "currency", "", "currency of the transfer: eth")
+	prepare.StringVar(&txSendCfg.To, "to", "", "receiver address")
+	prepare.Float64Var(&txSendCfg.Amount, "amount", 0, "amount in the main currency unit")
+	prepare.StringVar(&txSendCfg.Urgency, "urgency", "", "slow, normal or fast, normal if empty")
+	prepare.StringVar(&txSendCfg.Network, "network", "", "network the transfer is meant for, transfer is rejected if currency is configured for another one")
+	prepare.StringVar(&txPrepareCfg.From, "from", "", "cold wallet address the transfer is sent from")
+	prepare.StringVar(&txPrepareCfg.Out, "out", "", "file unsigned transfer is written to, stdout if empty")
+	for _, name := range []string{"currency", "to", "amount", "from"} {
+		_ = txPrepareCmd.MarkFlagRequired(name)
+	}
+
+	sign := signCmd.Flags()
+	sign.StringVar(&signCfg.Name, "name", "cold", "name of the key in keystore")
+	sign.StringVar(&signCfg.Keystore, "keystore", filepath.Join(defaultConfigDir, "keystore"), "keystore directory")
+	sign.StringVar(&signCfg.PasswordFile, "password-file", "", "file with keystore password, password is prompted if neither it nor "+envPrefix+"WALLET_PASSWORD is set")
+	sign.StringVar(&signCfg.Out, "out", "", "file signed transfer is written to, stdout if empty")
+
+	broadcastCmd.Flags().StringVarP(&txOutput, "output", "o", outputTable, "output format: table, json or csv")
+}
+
+// cmdTxPrepare exports unsigned transfer, it passes the same validation and limits as web api.
+func cmdTxPrepare(cmd *cobra.Command, args []string) error {
+	transaction := console.Transaction{
+		Currency: strings.ToLower(txSendCfg.Currency),
+		Amount:   txSendCfg.Amount,
+		To:       txSendCfg.To,
+		Urgency:  txSendCfg.Urgency,
+		Network:  txSendCfg.Network,
+	}
+
+	ctx, cancel := withSignals(context.Background())
+	defer cancel()
+
+	return withConsole(cmd, func(log logger.Logger, service *console.Service) error {
+		unsigned, err := service.PrepareTx(logger.WithContext(ctx, log), transaction, txPrepareCfg.From)
+		if err != nil {
+			return Error.Wrap(err)
+		}
+
+		return writeJSON(txPrepareCfg.Out, unsigned)
+	})
+}
+
+// cmdSign signs unsigned transfer with the key from keystore. it is meant to be run on an offline host,
+// so transfer is printed to stderr for the operator to check what is signed.
+func cmdSign(cmd *cobra.Command, args []string) error {
+	var unsigned payments.UnsignedTransaction
+	if err := readJSON(args[0], &unsigned); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "signing %v %s on %s network from %s to %s\n", unsigned.Amount, unsigned.Currency, unsigned.Network, unsigned.From, unsigned.To)
+	fmt.Fprintf(os.Stderr, "params: %s\n", unsigned.Params)
+
+	password, err := walletPassword(signCfg.PasswordFile, false)
+	if err != nil {
+		return err
+	}
+
+	privateKey, err := keystore.New(signCfg.Keystore).PrivateKey(signCfg.Name, password)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	var signed payments.SignedTransaction
+	switch unsigned.Currency {
+	case payments.PaymentCurrencyETH:
+		signed, err = paymentseth.Sign(unsigned, privateKey)
+	default:
+		return Error.New("offline signing is not supported for %q", unsigned.Currency)
+	}
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "transaction id: %s\n", signed.ID)
+	return writeJSON(signCfg.Out, signed)
+}
+
+// cmdBroadcast sends signed transfer through console service, operator who runs CLI is recorded to the audit log.
+func cmdBroadcast(cmd *cobra.Command, args []string) error {
+	if err := checkOutput(); err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	var signed payments.SignedTransaction
+	if err = json.Unmarshal(data, &signed); err != nil {
+		return Error.New("could not decode %s: %v", args[0], err)
+	}
+
+	// transfer is not bound to signals, so it is never interrupted between sending and storing.
+	ctx := context.Background()
+	return withConsole(cmd, func(log logger.Logger, service *console.Service) error {
+		caller := audit.CallerFromContext(withOperator(ctx))
+		caller.RequestHash = audit.HashRequest(data)
+		ctx := audit.WithCaller(logger.WithContext(ctx, log), caller)
+
+		tx, err := service.BroadcastTx(ctx, signed)
+		if err != nil {
+			return Error.Wrap(err)
+		}
+
+		return printTransactions([]payments.Transaction{tx})
+	})
+}
+
+// readJSON decodes json file at the path into value.
+func readJSON(path string, value interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	if err = json.Unmarshal(data, value); err != nil {
+		return Error.New("could not decode %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// writeJSON writes value as indented json to the file at the path, or to stdout if path is empty.
+func writeJSON(path string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "    ")
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	if path == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+
+	return Error.Wrap(ioutil.WriteFile(path, append(data, '\n'), 0644))
+}
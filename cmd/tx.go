@@ -0,0 +1,345 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+	"github.com/zeebo/errs"
+
+	"paxful"
+	"paxful/audit"
+	"paxful/console"
+	"paxful/internal/logger"
+	"paxful/internal/logger/zaplog"
+	"paxful/paxfuldb"
+	"paxful/payments"
+	"paxful/payments/paymentsbtc"
+	"paxful/payments/paymentseth"
+)
+
+// output formats of tx commands.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+// commands
+var (
+	txCmd = &cobra.Command{
+		Use:   "tx",
+		Short: "transaction related commands",
+	}
+	txSendCmd = &cobra.Command{
+		Use:         "send",
+		Short:       "sends transaction with the same validation, limits and audit trail as web api",
+		Args:        cobra.NoArgs,
+		RunE:        cmdTxSend,
+		Annotations: map[string]string{"type": "run"},
+	}
+	txListCmd = &cobra.Command{
+		Use:         "list",
+		Short:       "lists sent transactions, newest first",
+		Args:        cobra.NoArgs,
+		RunE:        cmdTxList,
+		Annotations: map[string]string{"type": "run"},
+	}
+	txShowCmd = &cobra.Command{
+		Use:         "show <id>",
+		Short:       "shows all outputs of the transaction",
+		Args:        cobra.ExactArgs(1),
+		RunE:        cmdTxShow,
+		Annotations: map[string]string{"type": "run"},
+	}
+
+	txSendCfg struct {
+		Currency string
+		To       string
+		Amount   float64
+		Urgency  string
+		Network  string
+	}
+	txListCfg struct {
+		Currency string
+		Network  string
+		Status   string
+		To       string
+		Since    string
+		Until    string
+		Limit    int
+	}
+	// txOutput is an output format of tx commands.
+	txOutput string
+)
+
+func init() {
+	rootCmd.AddCommand(txCmd)
+	txCmd.AddCommand(txSendCmd)
+	txCmd.AddCommand(txListCmd)
+	txCmd.AddCommand(txShowCmd)
+
+	txCmd.PersistentFlags().StringVarP(&txOutput, "output", "o", outputTable, "output format: table, json or csv")
+
+	send := txSendCmd.Flags()
+	send.StringVar(&txSendCfg.Currency, "currency", "", "currency of the transfer: eth or btc")
+	send.StringVar(&txSendCfg.To, "to", "", "receiver address")
+	send.Float64Var(&txSendCfg.Amount, "amount", 0, "amount in the main currency unit")
+	send.StringVar(&txSendCfg.Urgency, "urgency", "", "slow, normal or fast, normal if empty")
+	send.StringVar(&txSendCfg.Network, "network", "", "network the transfer is meant for, transfer is rejected if currency is configured for another one")
+	for _, name := range []string{"currency", "to", "amount"} {
+		_ = txSendCmd.MarkFlagRequired(name)
+	}
+
+	list := txListCmd.Flags()
+	list.StringVar(&txListCfg.Currency, "currency", "", "only transactions of the currency: eth or btc")
+	list.StringVar(&txListCfg.Network, "network", "", "only transactions of the network, e.g. mainnet")
+	list.StringVar(&txListCfg.Status, "status", "", "only transactions with the status: sent, confirmed or failed")
+	list.StringVar(&txListCfg.To, "to", "", "only transactions to the receiver address")
+	list.StringVar(&txListCfg.Since, "since", "", "only transactions created at or after the time, RFC3339 or date, e.g. 2020-09-01")
+	list.StringVar(&txListCfg.Until, "until", "", "only transactions created before the time, RFC3339 or date, e.g. 2020-10-01")
+	list.IntVar(&txListCfg.Limit, "limit", 100, "maximum amount of transactions, 0 means no limit")
+}
+
+// cmdTxSend sends transaction through console service, operator who runs CLI is recorded to the audit log.
+func cmdTxSend(cmd *cobra.Command, args []string) (err error) {
+	if err = checkOutput(); err != nil {
+		return err
+	}
+
+	transaction := console.Transaction{
+		Currency: strings.ToLower(txSendCfg.Currency),
+		Amount:   txSendCfg.Amount,
+		To:       txSendCfg.To,
+		Urgency:  txSendCfg.Urgency,
+		Network:  txSendCfg.Network,
+	}
+
+	// transfer is not bound to signals, so it is never interrupted between signing and storing.
+	ctx := context.Background()
+	return withConsole(cmd, func(log logger.Logger, service *console.Service) error {
+		request, err := json.Marshal(transaction)
+		if err != nil {
+			return Error.Wrap(err)
+		}
+
+		caller := audit.CallerFromContext(withOperator(ctx))
+		caller.RequestHash = audit.HashRequest(request)
+		ctx := audit.WithCaller(logger.WithContext(ctx, log), caller)
+
+		tx, err := service.CommitTx(ctx, transaction)
+		if err != nil {
+			return Error.Wrap(err)
+		}
+
+		return printTransactions([]payments.Transaction{tx})
+	})
+}
+
+// cmdTxList prints transactions matching the filter flags.
+func cmdTxList(cmd *cobra.Command, args []string) (err error) {
+	if err = checkOutput(); err != nil {
+		return err
+	}
+
+	filter := payments.TransactionFilter{
+		Network: txListCfg.Network,
+		To:      txListCfg.To,
+		Limit:   txListCfg.Limit,
+	}
+	if txListCfg.Currency != "" {
+		filter.Currency, err = payments.PaymentCurrencyFromString(strings.ToLower(txListCfg.Currency))
+		if err != nil {
+			return Error.Wrap(err)
+		}
+	}
+	if txListCfg.Status != "" {
+		status, err := payments.TransactionStatusFromString(txListCfg.Status)
+		if err != nil {
+			return Error.Wrap(err)
+		}
+		filter.Status = &status
+	}
+	if filter.Since, err = parseTime(txListCfg.Since); err != nil {
+		return Error.New("invalid --since: %v", err)
+	}
+	if filter.Until, err = parseTime(txListCfg.Until); err != nil {
+		return Error.New("invalid --until: %v", err)
+	}
+
+	ctx, cancel := withSignals(context.Background())
+	defer cancel()
+
+	return withConsole(cmd, func(log logger.Logger, service *console.Service) error {
+		transactions, err := service.ListTx(ctx, filter)
+		if err != nil {
+			return Error.Wrap(err)
+		}
+
+		return printTransactions(transactions)
+	})
+}
+
+// cmdTxShow prints all outputs of the transaction.
+func cmdTxShow(cmd *cobra.Command, args []string) (err error) {
+	if err = checkOutput(); err != nil {
+		return err
+	}
+
+	ctx, cancel := withSignals(context.Background())
+	defer cancel()
+
+	return withConsole(cmd, func(log logger.Logger, service *console.Service) error {
+		outputs, err := service.GetTx(ctx, args[0])
+		if err != nil {
+			return Error.Wrap(err)
+		}
+
+		return printTransactions(outputs)
+	})
+}
+
+// withConsole runs fn with console service built from config the same way as for web server,
+// so transfers pass the same validation and limits.
+func withConsole(cmd *cobra.Command, fn func(log logger.Logger, service *console.Service) error) (err error) {
+	log := zaplog.NewLog()
+
+	runCfg, err = readConfig(cmd.Flags())
+	if err != nil {
+		log.Error("Could not read config", Error.Wrap(err))
+		return Error.Wrap(err)
+	}
+
+	log, err = zaplog.New(runCfg.Log)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	db, err := paxfuldb.NewDatabase(runCfg.DatabaseURL)
+	if err != nil {
+		log.Error("could not connect to paxfuldb", Error.Wrap(err))
+		return Error.Wrap(err)
+	}
+	defer func() {
+		err = errs.Combine(err, db.Close())
+	}()
+
+	service, err := newConsoleService(log, db, runCfg.Config)
+	if err != nil {
+		log.Error("could not create payment service", Error.Wrap(err))
+		return Error.Wrap(err)
+	}
+
+	return fn(log, service)
+}
+
+// newConsoleService creates console service with payment providers from the config.
+func newConsoleService(log logger.Logger, db paxful.DB, config paxful.Config) (*console.Service, error) {
+	provider, err := newPaymentProvider(log, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return console.NewService(log, config.Console, provider, db.Transactions(), audit.NewService(db.Audit()), console.NewEventBus()), nil
+}
+
+// newPaymentProvider creates ethereum and bitcoin payment services from the config.
+// metrics are not exposed by CLI, so they are registered in a throwaway registry.
+func newPaymentProvider(log logger.Logger, config paxful.Config) (payments.PaymentProvider, error) {
+	registry := prometheus.NewRegistry()
+
+	eth, err := paymentseth.NewTransactions(log, config.Payments.Ethereum, config.Payments.CommissionPercent, registry)
+	if err != nil {
+		return payments.PaymentProvider{}, err
+	}
+	btc, err := paymentsbtc.NewTransactions(log, config.Payments.Bitcoin, config.Payments.CommissionPercent, registry)
+	if err != nil {
+		return payments.PaymentProvider{}, err
+	}
+
+	return payments.NewPaymentProvider(eth, btc), nil
+}
+
+// parseTime parses RFC3339 time or date, empty string is zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+
+	return time.Parse("2006-01-02", value)
+}
+
+// checkOutput checks that output format is supported before anything is done.
+func checkOutput() error {
+	switch txOutput {
+	case outputTable, outputJSON, outputCSV:
+		return nil
+	default:
+		return Error.New("output format %q is not supported, use table, json or csv", txOutput)
+	}
+}
+
+// transactionHeader is a header of table and csv output.
+var transactionHeader = []string{"ID", "OUTPUT", "CURRENCY", "NETWORK", "AMOUNT", "FEE", "FROM", "TO", "STATUS", "GAS USED", "CREATED AT"}
+
+// transactionRow returns fields of transaction in transactionHeader order.
+func transactionRow(tx payments.Transaction) []string {
+	return []string{
+		tx.ID,
+		strconv.Itoa(tx.OutputIndex),
+		string(tx.Currency),
+		tx.Network,
+		strconv.FormatFloat(tx.Amount, 'f', -1, 64),
+		strconv.FormatInt(tx.Fee, 10),
+		tx.From,
+		tx.To,
+		tx.Status.String(),
+		strconv.FormatUint(tx.GasUsed, 10),
+		tx.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// printTransactions writes transactions to stdout in txOutput format.
+func printTransactions(transactions []payments.Transaction) error {
+	switch txOutput {
+	case outputJSON:
+		if transactions == nil {
+			transactions = []payments.Transaction{}
+		}
+		data, err := json.MarshalIndent(transactions, "", "    ")
+		if err != nil {
+			return Error.Wrap(err)
+		}
+		fmt.Println(string(data))
+		return nil
+	case outputCSV:
+		writer := csv.NewWriter(os.Stdout)
+		_ = writer.Write(transactionHeader)
+		for _, tx := range transactions {
+			_ = writer.Write(transactionRow(tx))
+		}
+		writer.Flush()
+		return Error.Wrap(writer.Error())
+	default:
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.Join(transactionHeader, "\t"))
+		for _, tx := range transactions {
+			fmt.Fprintln(writer, strings.Join(transactionRow(tx), "\t"))
+		}
+		return Error.Wrap(writer.Flush())
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"paxful/internal/keystore"
+	"paxful/internal/logger/zaplog"
+	"paxful/payments"
+	"paxful/payments/paymentsbtc"
+)
+
+// commands
+var (
+	walletCmd = &cobra.Command{
+		Use:   "wallet",
+		Short: "hot wallet keys related commands, private keys are never printed unless explicitly asked",
+	}
+	walletNewCmd = &cobra.Command{
+		Use:         "new",
+		Short:       "generates new key and stores it in encrypted keystore",
+		Args:        cobra.NoArgs,
+		RunE:        cmdWalletNew,
+		Annotations: map[string]string{"type": "setup"},
+	}
+	walletImportCmd = &cobra.Command{
+		Use:         "import",
+		Short:       "imports hex encoded private key from stdin into encrypted keystore",
+		Args:        cobra.NoArgs,
+		RunE:        cmdWalletImport,
+		Annotations: map[string]string{"type": "setup"},
+	}
+	walletAddressCmd = &cobra.Command{
+		Use:         "address",
+		Short:       "prints ethereum and bitcoin addresses of the key",
+		Args:        cobra.NoArgs,
+		RunE:        cmdWalletAddress,
+		Annotations: map[string]string{"type": "setup"},
+	}
+	walletBalanceCmd = &cobra.Command{
+		Use:         "balance",
+		Short:       "prints balances of the key addresses through configured nodes",
+		Args:        cobra.NoArgs,
+		RunE:        cmdWalletBalance,
+		Annotations: map[string]string{"type": "run"},
+	}
+	walletExportPublicCmd = &cobra.Command{
+		Use:         "export-public",
+		Short:       "prints public key and addresses as json",
+		Args:        cobra.NoArgs,
+		RunE:        cmdWalletExportPublic,
+		Annotations: map[string]string{"type": "setup"},
+	}
+
+	walletCfg struct {
+		Name         string
+		Keystore     string
+		PasswordFile string
+		BTCNetwork   string
+		// ShowPrivateKey makes export-public print decrypted private key too.
+		ShowPrivateKey bool
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(walletCmd)
+	walletCmd.AddCommand(walletNewCmd)
+	walletCmd.AddCommand(walletImportCmd)
+	walletCmd.AddCommand(walletAddressCmd)
+	walletCmd.AddCommand(walletBalanceCmd)
+	walletCmd.AddCommand(walletExportPublicCmd)
+
+	flags := walletCmd.PersistentFlags()
+	flags.StringVar(&walletCfg.Name, "name", "hot", "name of the key in keystore")
+	flags.StringVar(&walletCfg.Keystore, "keystore", filepath.Join(defaultConfigDir, "keystore"), "keystore directory")
+	flags.StringVar(&walletCfg.PasswordFile, "password-file", "", "file with keystore password, password is prompted if neither it nor "+envPrefix+"WALLET_PASSWORD is set")
+	flags.StringVar(&walletCfg.BTCNetwork, "btc-network", string(paymentsbtc.NetworkMainnet), "bitcoin network of the address: mainnet, testnet or regtest")
+
+	walletExportPublicCmd.Flags().BoolVar(&walletCfg.ShowPrivateKey, "unsafe-show-private-key", false, "also print decrypted private key, requires password")
+}
+
+// walletKey describes public part of the key.
+type walletKey struct {
+	Name       string `json:"name"`
+	PublicKey  string `json:"publicKey"`
+	ETHAddress string `json:"ethAddress"`
+	BTCAddress string `json:"btcAddress"`
+	// PrivateKey is set only on explicit request.
+	PrivateKey string `json:"privateKey,omitempty"`
+}
+
+// newWalletKey derives addresses of the public key.
+func newWalletKey(name string, publicKey *ecdsa.PublicKey) (walletKey, error) {
+	btcAddress, err := paymentsbtc.Address(publicKey, paymentsbtc.Network(walletCfg.BTCNetwork))
+	if err != nil {
+		return walletKey{}, Error.Wrap(err)
+	}
+
+	return walletKey{
+		Name:       name,
+		PublicKey:  hex.EncodeToString(crypto.CompressPubkey(publicKey)),
+		ETHAddress: crypto.PubkeyToAddress(*publicKey).Hex(),
+		BTCAddress: btcAddress,
+	}, nil
+}
+
+// print writes key name and addresses to stdout.
+func (key walletKey) print() {
+	fmt.Printf("name:        %s\n", key.Name)
+	fmt.Printf("eth address: %s\n", key.ETHAddress)
+	fmt.Printf("btc address: %s\n", key.BTCAddress)
+}
+
+// cmdWalletNew generates new key, only its addresses are printed.
+func cmdWalletNew(cmd *cobra.Command, args []string) error {
+	password, err := walletPassword(walletCfg.PasswordFile, true)
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := keystore.New(walletCfg.Keystore).Generate(walletCfg.Name, password)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	key, err := newWalletKey(walletCfg.Name, publicKey)
+	if err != nil {
+		return err
+	}
+
+	key.print()
+	return nil
+}
+
+// cmdWalletImport imports private key read from stdin, so it does not stay in shell history.
+func cmdWalletImport(cmd *cobra.Command, args []string) error {
+	raw, err := readSecret("private key: ")
+	if err != nil {
+		return err
+	}
+
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(raw, "0x"))
+	if err != nil {
+		return Error.New("private key must be 32 hex encoded bytes")
+	}
+
+	password, err := walletPassword(walletCfg.PasswordFile, true)
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := keystore.New(walletCfg.Keystore).Import(walletCfg.Name, privateKey, password)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	key, err := newWalletKey(walletCfg.Name, publicKey)
+	if err != nil {
+		return err
+	}
+
+	key.print()
+	return nil
+}
+
+// cmdWalletAddress prints addresses of the key, password is not needed.
+func cmdWalletAddress(cmd *cobra.Command, args []string) error {
+	key, err := loadWalletKey()
+	if err != nil {
+		return err
+	}
+
+	key.print()
+	return nil
+}
+
+// cmdWalletBalance prints balances of the key addresses queried through nodes from config.
+func cmdWalletBalance(cmd *cobra.Command, args []string) error {
+	config, err := readConfig(cmd.Flags())
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	// bitcoin address is derived for the network node is configured for, unless it is set explicitly.
+	if !cmd.Flags().Changed("btc-network") {
+		walletCfg.BTCNetwork = config.Payments.Bitcoin.Network.Name
+	}
+
+	key, err := loadWalletKey()
+	if err != nil {
+		return err
+	}
+
+	log, err := zaplog.New(config.Log)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	provider, err := newPaymentProvider(log, config.Config)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	ctx, cancel := withSignals(context.Background())
+	defer cancel()
+
+	addresses := map[payments.PaymentCurrency]string{
+		payments.PaymentCurrencyETH: key.ETHAddress,
+		payments.PaymentCurrencyBTC: key.BTCAddress,
+	}
+
+	fmt.Printf("name: %s\n", key.Name)
+	for _, currency := range provider.Currencies() {
+		transactions, err := provider.GetByCurrency(currency)
+		if err != nil {
+			return Error.Wrap(err)
+		}
+
+		// node of one currency could be unavailable, balance of the other one is still printed.
+		balance, err := transactions.AddressBalance(ctx, addresses[currency])
+		if err != nil {
+			fmt.Printf("%s: %s balance is unavailable: %v\n", currency, addresses[currency], err)
+			continue
+		}
+		fmt.Printf("%s: %s %v\n", currency, addresses[currency], balance)
+	}
+
+	return nil
+}
+
+// cmdWalletExportPublic prints public part of the key as json, private key is added only with --unsafe-show-private-key.
+func cmdWalletExportPublic(cmd *cobra.Command, args []string) error {
+	key, err := loadWalletKey()
+	if err != nil {
+		return err
+	}
+
+	if walletCfg.ShowPrivateKey {
+		password, err := walletPassword(walletCfg.PasswordFile, false)
+		if err != nil {
+			return err
+		}
+
+		privateKey, err := keystore.New(walletCfg.Keystore).PrivateKey(walletCfg.Name, password)
+		if err != nil {
+			return Error.Wrap(err)
+		}
+
+		fmt.Fprintln(os.Stderr, "WARNING: output contains private key, anyone who sees it controls the funds")
+		key.PrivateKey = hex.EncodeToString(crypto.FromECDSA(privateKey))
+	}
+
+	data, err := json.MarshalIndent(key, "", "    ")
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	fmt.Println(string(data))
+	return nil
+}
+
+// loadWalletKey reads public key from keystore and derives its addresses.
+func loadWalletKey() (walletKey, error) {
+	publicKey, err := keystore.New(walletCfg.Keystore).PublicKey(walletCfg.Name)
+	if err != nil {
+		return walletKey{}, Error.Wrap(err)
+	}
+
+	return newWalletKey(walletCfg.Name, publicKey)
+}
+
+// walletPassword returns keystore password from the password file, PAXFUL_WALLET_PASSWORD or terminal prompt.
+// new password is asked twice when prompted.
+func walletPassword(passwordFile string, confirm bool) (string, error) {
+	if passwordFile != "" {
+		data, err := ioutil.ReadFile(passwordFile)
+		if err != nil {
+			return "", Error.New("could not read password file %s", passwordFile)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if password, ok := os.LookupEnv(envPrefix + "WALLET_PASSWORD"); ok {
+		return password, nil
+	}
+
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return "", Error.New("password is not set, use --password-file or %sWALLET_PASSWORD", envPrefix)
+	}
+
+	password, err := readSecret("password: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		repeated, err := readSecret("repeat password: ")
+		if err != nil {
+			return "", err
+		}
+		if repeated != password {
+			return "", Error.New("passwords do not match")
+		}
+	}
+
+	return password, nil
+}
+
+// readSecret reads a line from stdin, input is not echoed if stdin is a terminal.
+func readSecret(prompt string) (string, error) {
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, prompt)
+		secret, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", Error.Wrap(err)
+		}
+		return strings.TrimSpace(string(secret)), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", Error.Wrap(err)
+	}
+
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package console
+
+import (
+	"sync"
+
+	"paxful/payments"
+)
+
+// ensures that EventBus implements payments.Publisher.
+var _ payments.Publisher = (*EventBus)(nil)
+
+// subscriberBuffer is an amount of events buffered for a single subscriber.
+const subscriberBuffer = 64
+
+// EventBus is an in-process fan-out of transaction events to live subscribers.
+// It does not keep history, subscribers which need to resume should replay outbox events from the database.
+//
+// architecture: Service
+type EventBus struct {
+	mu          sync.Mutex
+	nextID      int
+	subscribers map[int]chan payments.Event
+}
+
+// NewEventBus is a constructor for EventBus.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[int]chan payments.Event),
+	}
+}
+
+// Publish sends event to all current subscribers without blocking.
+// subscriber which does not keep up is dropped and its channel is closed.
+func (bus *EventBus) Publish(event payments.Event) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	for id, events := range bus.subscribers {
+		select {
+		case events <- event:
+		default:
+			delete(bus.subscribers, id)
+			close(events)
+		}
+	}
+}
+
+// Subscribe returns channel of events published after the call and function to unsubscribe.
+// channel is closed when subscriber is dropped or unsubscribed.
+func (bus *EventBus) Subscribe() (<-chan payments.Event, func()) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	id := bus.nextID
+	bus.nextID++
+
+	events := make(chan payments.Event, subscriberBuffer)
+	bus.subscribers[id] = events
+
+	return events, func() {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+
+		if _, ok := bus.subscribers[id]; ok {
+			delete(bus.subscribers, id)
+			close(events)
+		}
+	}
+}
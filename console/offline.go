@@ -0,0 +1,117 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package console
+
+import (
+	"context"
+	"encoding/json"
+
+	"paxful/audit"
+	"paxful/internal/logger"
+	"paxful/payments"
+)
+
+// PrepareTx validates transfer from the cold wallet address and returns it unsigned,
+// so it could be signed on an offline host. transfer policy is the same as for the hot wallet.
+func (service *Service) PrepareTx(ctx context.Context, transaction Transaction, from string) (payments.UnsignedTransaction, error) {
+	request, transactions, err := service.parse(transaction)
+	if err != nil {
+		return payments.UnsignedTransaction{}, err
+	}
+
+	offline, err := service.offline(request.Currency, transactions)
+	if err != nil {
+		return payments.UnsignedTransaction{}, err
+	}
+
+	unsigned, err := offline.Prepare(ctx, request, from)
+	if err != nil {
+		return payments.UnsignedTransaction{}, wrapPaymentsError(err)
+	}
+
+	return unsigned, nil
+}
+
+// BroadcastTx sends transfer signed offline and stores it like any other transfer.
+// every attempt is recorded to the audit log with the caller taken from ctx.
+func (service *Service) BroadcastTx(ctx context.Context, signed payments.SignedTransaction) (tx payments.Transaction, err error) {
+	defer func() { service.auditBroadcast(ctx, signed, err) }()
+
+	if !service.acquire() {
+		return payments.Transaction{}, UnavailableError.New("service is shutting down")
+	}
+	defer service.release()
+
+	// policy could be changed since transfer was prepared, so it is checked again.
+	_, transactions, err := service.parse(Transaction{
+		Currency: string(signed.Currency),
+		Amount:   signed.Amount,
+		To:       signed.To,
+		Urgency:  string(signed.Urgency),
+		Network:  signed.Network,
+	})
+	if err != nil {
+		return payments.Transaction{}, err
+	}
+
+	offline, err := service.offline(signed.Currency, transactions)
+	if err != nil {
+		return payments.Transaction{}, err
+	}
+
+	tx, err = offline.Broadcast(ctx, signed)
+	if err != nil {
+		return payments.Transaction{}, wrapPaymentsError(err)
+	}
+
+	tx.ExplorerURL = service.explorerURL(tx)
+	return tx, service.store(ctx, tx)
+}
+
+// offline returns payment service of the currency which supports offline signing.
+func (service *Service) offline(currency payments.PaymentCurrency, transactions payments.Transactions) (payments.OfflineTransactions, error) {
+	offline, ok := transactions.(payments.OfflineTransactions)
+	if !ok {
+		return nil, ValidationError.New("offline signing is not supported for %s", currency)
+	}
+
+	return offline, nil
+}
+
+// auditBroadcastDetails is a content of audit log entry details for broadcast requests.
+type auditBroadcastDetails struct {
+	Currency payments.PaymentCurrency `json:"currency"`
+	From     string                   `json:"from"`
+	To       string                   `json:"to"`
+	Amount   float64                  `json:"amount"`
+	TxID     string                   `json:"txId,omitempty"`
+}
+
+// auditBroadcast records broadcast attempt outcome to the audit log.
+// raw transaction is not recorded, id is enough to find it in the network.
+func (service *Service) auditBroadcast(ctx context.Context, signed payments.SignedTransaction, err error) {
+	outcome := auditOutcome(err)
+
+	caller := audit.CallerFromContext(ctx)
+	if caller.RequestHash == "" {
+		body, _ := json.Marshal(signed)
+		caller.RequestHash = audit.HashRequest(body)
+	}
+
+	details, _ := json.Marshal(auditBroadcastDetails{
+		Currency: signed.Currency,
+		From:     signed.From,
+		To:       signed.To,
+		Amount:   signed.Amount,
+		TxID:     signed.ID,
+	})
+
+	// transfer could be already sent, so audit record should not be lost because of canceled request.
+	auditCtx := audit.WithCaller(context.Background(), caller)
+	auditErr := service.audit.Record(auditCtx, audit.ActionBroadcastTx, outcome, err, string(details))
+	if auditErr != nil {
+		logger.FromContext(ctx, service.log).Error("could not record broadcast to audit log", auditErr,
+			logger.String("outcome", string(outcome)), logger.String("details", string(details)))
+	}
+}
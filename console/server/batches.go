@@ -0,0 +1,84 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"paxful/batches"
+	"paxful/console"
+	"paxful/internal/logger"
+)
+
+// batchResponse is a batch with its progress summary.
+type batchResponse struct {
+	batches.Batch
+	Summary batches.Summary `json:"summary"`
+}
+
+// invalidBatchResponse lists invalid items of rejected batch.
+type invalidBatchResponse struct {
+	Error string                `json:"error"`
+	Items []batches.InvalidItem `json:"items,omitempty"`
+}
+
+// CreateBatch is a web api handler that accepts list of transfers which are sent in background.
+// batch is rejected as a whole if any transfer is invalid.
+func (server *Server) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := server.withCaller(r)
+	log := logger.FromContext(ctx, server.log)
+
+	var transactions []console.Transaction
+	err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&transactions)
+	if err != nil {
+		log.Error("can not decode request body", Error.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	batch, err := server.batches.Create(ctx, transactions)
+	if err != nil {
+		log.Error("can not create batch", Error.Wrap(err))
+		if batches.ValidationError.Has(err) {
+			response := invalidBatchResponse{Error: err.Error()}
+
+			var invalid *batches.InvalidItemsError
+			if errors.As(err, &invalid) {
+				response = invalidBatchResponse{Error: "batch contains invalid items", Items: invalid.Items}
+			}
+
+			server.serveJSON(w, http.StatusBadRequest, response)
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	server.serveJSON(w, http.StatusAccepted, batchResponse{Batch: batch, Summary: batch.Summary()})
+}
+
+// GetBatch is a web api handler that returns per-item results and summary of the batch.
+func (server *Server) GetBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	batch, err := server.batches.Get(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		logger.FromContext(ctx, server.log).Error("can not get batch", Error.Wrap(err))
+		if batches.ErrNotFound.Has(err) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	server.serveJSON(w, http.StatusOK, batchResponse{Batch: batch, Summary: batch.Summary()})
+}
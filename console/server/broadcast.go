@@ -0,0 +1,45 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"paxful/console"
+	"paxful/internal/logger"
+	"paxful/payments"
+)
+
+// BroadcastTx is a web api handler that sends transfer signed offline and returns stored transaction.
+func (server *Server) BroadcastTx(w http.ResponseWriter, r *http.Request) {
+	ctx := server.withCaller(r)
+	log := logger.FromContext(ctx, server.log)
+
+	var signed payments.SignedTransaction
+	err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&signed)
+	if err != nil {
+		log.Error("can not decode request body", Error.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := server.service.BroadcastTx(ctx, signed)
+	if err != nil {
+		log.Error("can not broadcast transaction", Error.Wrap(err))
+		switch {
+		case console.ValidationError.Has(err):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case console.UnavailableError.Has(err):
+			w.Header().Set("Connection", "close")
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		default:
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	server.serveJSON(w, http.StatusCreated, tx)
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"paxful/console"
+	"paxful/internal/logger"
+	"paxful/jobs"
+)
+
+// preferAsync checks whether client asked for asynchronous processing with "Prefer: respond-async" header.
+func preferAsync(r *http.Request) bool {
+	for _, value := range r.Header[http.CanonicalHeaderKey("Prefer")] {
+		for _, preference := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(preference), "respond-async") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// enqueueTx stores transfer in the job queue and answers with job id which could be used to check its progress.
+func (server *Server) enqueueTx(ctx context.Context, w http.ResponseWriter, transaction console.Transaction) error {
+	job, err := server.jobs.Enqueue(ctx, transaction)
+	if err != nil {
+		logger.FromContext(ctx, server.log).Error("can not enqueue transaction", Error.Wrap(err))
+		if console.ValidationError.Has(err) {
+			server.service.RejectTx(ctx, err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return err
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	server.serveJSON(w, http.StatusAccepted, job)
+
+	return nil
+}
+
+// GetJob is a web api handler that returns status of asynchronous transfer.
+func (server *Server) GetJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	job, err := server.jobs.Get(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		logger.FromContext(ctx, server.log).Error("can not get job", Error.Wrap(err))
+		if jobs.ErrNotFound.Has(err) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	server.serveJSON(w, http.StatusOK, job)
+}
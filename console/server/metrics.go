@@ -0,0 +1,100 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package server
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"paxful/console"
+	"paxful/payments"
+)
+
+// outcomes of a transfer request.
+const (
+	outcomeSuccess     = "success"
+	outcomeBadRequest  = "bad_request"
+	outcomeValidation  = "validation_error"
+	outcomeUnavailable = "unavailable"
+	outcomeNoFunds     = "insufficient_funds"
+	outcomeGasPrice    = "gas_price_too_high"
+	outcomeQueued      = "queued"
+	outcomeInternal    = "internal_error"
+)
+
+// metrics holds web server instrumentation.
+type metrics struct {
+	commits        *prometheus.CounterVec
+	commitDuration *prometheus.HistogramVec
+}
+
+// newMetrics creates web server metrics and registers them in the registerer.
+func newMetrics(registerer prometheus.Registerer) (*metrics, error) {
+	m := &metrics{
+		commits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "paxful",
+			Subsystem: "console",
+			Name:      "commit_tx_total",
+			Help:      "Amount of transfer requests by currency and outcome.",
+		}, []string{"currency", "outcome"}),
+		commitDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "paxful",
+			Subsystem: "console",
+			Name:      "commit_tx_duration_seconds",
+			Help:      "Latency of transfer requests by currency.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"currency"}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.commits, m.commitDuration} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// observeCommit records outcome and latency of the transfer request started at start.
+func (m *metrics) observeCommit(currency string, start time.Time, outcome string) {
+	m.commits.WithLabelValues(currency, outcome).Inc()
+	m.commitDuration.WithLabelValues(currency).Observe(time.Since(start).Seconds())
+}
+
+// commitOutcome classifies error returned by console service.
+func commitOutcome(err error) string {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case console.ValidationError.Has(err):
+		return outcomeValidation
+	case console.UnavailableError.Has(err):
+		return outcomeUnavailable
+	case console.InsufficientFundsError.Has(err):
+		return outcomeNoFunds
+	case console.GasPriceTooHighError.Has(err):
+		return outcomeGasPrice
+	default:
+		return outcomeInternal
+	}
+}
+
+// enqueueOutcome classifies error returned on enqueuing asynchronous transfer.
+func enqueueOutcome(err error) string {
+	if err == nil {
+		return outcomeQueued
+	}
+
+	return commitOutcome(err)
+}
+
+// currencyLabel keeps metrics cardinality bounded for unknown currencies.
+func currencyLabel(currency string) string {
+	if _, err := payments.PaymentCurrencyFromString(currency); err != nil {
+		return "unknown"
+	}
+
+	return currency
+}
@@ -0,0 +1,172 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"paxful/audit"
+	"paxful/internal/logger"
+	"paxful/internal/ratelimit"
+)
+
+// apiKeyHeader is a header which is used to identify api clients.
+const apiKeyHeader = "X-API-Key"
+
+// rateLimit is a middleware that limits amount of requests per client.
+// read (GET, HEAD) and write routes have separate limits.
+func (server *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiters := server.limiters.Load().(*limiters)
+		if !limiters.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limiter := limiters.write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			limiter = limiters.read
+		}
+
+		allowed, retryAfter, err := limiter.Allow(r.Context(), limiters.clientKey(r))
+		if err != nil {
+			server.log.Error("can not check rate limit", Error.Wrap(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientKey identifies client by api key if it is one of configured keys, or by remote ip otherwise,
+// so clients could not get a new bucket by sending a new key. bucket key is the key fingerprint.
+func (limiters *limiters) clientKey(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		fingerprint := sha256.Sum256([]byte(key))
+		if limiters.apiKeys[fingerprint] {
+			return "key:" + hex.EncodeToString(fingerprint[:])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// callerIdentity identifies client for the audit log by api key fingerprint, so the key itself is never stored.
+// only configured keys are trusted, so clients could not choose their identity by sending any key.
+func (limiters *limiters) callerIdentity(r *http.Request) string {
+	key := r.Header.Get(apiKeyHeader)
+	if key == "" {
+		return "anonymous"
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	if !limiters.apiKeys[hash] {
+		return "unverified"
+	}
+
+	return "apikey:" + hex.EncodeToString(hash[:8])
+}
+
+// callerIdentity identifies client for the audit log with current configured api keys.
+func (server *Server) callerIdentity(r *http.Request) string {
+	return server.limiters.Load().(*limiters).callerIdentity(r)
+}
+
+// withCaller returns request context which carries audit caller of the request.
+func (server *Server) withCaller(r *http.Request) context.Context {
+	return audit.WithCaller(r.Context(), audit.Caller{
+		Identity:   server.callerIdentity(r),
+		RemoteAddr: r.RemoteAddr,
+	})
+}
+
+// limiters are rate limiters of read and write requests.
+type limiters struct {
+	enabled bool
+	read    *ratelimit.Limiter
+	write   *ratelimit.Limiter
+	// apiKeys are sha256 hashes of configured api keys.
+	apiKeys map[[sha256.Size]byte]bool
+}
+
+// newLimiters creates read and write limiters on top of the same store.
+// buckets are kept in the store, so recreated limiters continue with the same state of clients.
+func newLimiters(config ratelimit.Config, store ratelimit.Store) *limiters {
+	apiKeys := make(map[[sha256.Size]byte]bool, len(config.APIKeys))
+	for _, key := range config.APIKeys {
+		if key != "" {
+			apiKeys[sha256.Sum256([]byte(key))] = true
+		}
+	}
+
+	return &limiters{
+		enabled: config.Enabled,
+		read:    ratelimit.NewLimiter(store, config.Read, "read:"),
+		write:   ratelimit.NewLimiter(store, config.Write, "write:"),
+		apiKeys: apiKeys,
+	}
+}
+
+// requestIDHeader is a header which is used to correlate requests with log messages.
+const requestIDHeader = "X-Request-ID"
+
+// requestLog is a middleware which puts request scoped logger with request id into request context.
+// request id is taken from the request header, or generated if it is not present.
+func (server *Server) requestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		log := server.log.With(
+			logger.String("requestID", requestID),
+			logger.String("method", r.Method),
+			logger.String("path", r.URL.Path),
+		)
+
+		ctx := logger.WithRequestID(r.Context(), requestID)
+		ctx = logger.WithContext(ctx, log)
+
+		log.Debug("request received", logger.String("remoteAddr", r.RemoteAddr))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newRequestID generates random request id.
+func newRequestID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+
+	"paxful/internal/logger"
+	"paxful/internal/logger/zaplog/zaplogtest"
+)
+
+func TestRequestLog(t *testing.T) {
+	log, logs := zaplogtest.NewObserver(zapcore.InfoLevel)
+	server := &Server{log: log}
+
+	var requestID string
+	handler := server.requestLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = logger.RequestID(r.Context())
+		logger.FromContext(r.Context(), nil).Info("handled")
+	}))
+
+	// request id of the caller is kept, so its requests could be correlated.
+	req := httptest.NewRequest(http.MethodPost, "/transactions", nil)
+	req.Header.Set(requestIDHeader, "caller-id")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	if requestID != "caller-id" {
+		t.Fatalf("request id in context %q, expected %q", requestID, "caller-id")
+	}
+	if header := recorder.Header().Get(requestIDHeader); header != "caller-id" {
+		t.Fatalf("request id header %q, expected %q", header, "caller-id")
+	}
+
+	entries := logs.TakeAll()
+	if len(entries) != 1 {
+		t.Fatalf("%d messages are logged, expected 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	expected := map[string]string{
+		"requestID": "caller-id",
+		"method":    http.MethodPost,
+		"path":      "/transactions",
+	}
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Fatalf("message field %s is %v, expected %q", key, fields[key], value)
+		}
+	}
+
+	// request id is generated if caller did not send it.
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/transactions", nil))
+
+	if requestID == "" || requestID == "caller-id" {
+		t.Fatalf("generated request id %q", requestID)
+	}
+	if header := recorder.Header().Get(requestIDHeader); header != requestID {
+		t.Fatalf("request id header %q, expected %q", header, requestID)
+	}
+
+	entries = logs.TakeAll()
+	if len(entries) != 1 || entries[0].ContextMap()["requestID"] != requestID {
+		t.Fatalf("messages are not correlated with generated request id %q: %v", requestID, entries)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"paxful/console"
+	"paxful/internal/logger"
+	"paxful/schedules"
+)
+
+// scheduleTx stores transfer with executeAt to be sent later by scheduler.
+func (server *Server) scheduleTx(ctx context.Context, w http.ResponseWriter, transaction console.Transaction) {
+	schedule, err := server.schedules.Create(ctx, transaction)
+	if err != nil {
+		logger.FromContext(ctx, server.log).Error("can not schedule transaction", Error.Wrap(err))
+		if schedules.ValidationError.Has(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	server.serveJSON(w, http.StatusAccepted, schedule)
+}
+
+// ListScheduled is a web api handler that returns all scheduled transfers.
+func (server *Server) ListScheduled(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	list, err := server.schedules.List(ctx)
+	if err != nil {
+		logger.FromContext(ctx, server.log).Error("can not list scheduled transfers", Error.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if list == nil {
+		list = []schedules.Schedule{}
+	}
+
+	server.serveJSON(w, http.StatusOK, list)
+}
+
+// CancelScheduled is a web api handler that cancels scheduled transfer before it runs.
+func (server *Server) CancelScheduled(w http.ResponseWriter, r *http.Request) {
+	ctx := server.withCaller(r)
+
+	err := server.schedules.Cancel(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		logger.FromContext(ctx, server.log).Error("can not cancel scheduled transfer", Error.Wrap(err))
+		switch {
+		case schedules.ErrNotFound.Has(err):
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		case schedules.ErrNotActive.Has(err):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
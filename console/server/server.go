@@ -6,15 +6,30 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/zeebo/errs"
 	"golang.org/x/sync/errgroup"
 
+	"paxful/audit"
+	"paxful/batches"
 	"paxful/console"
+	"paxful/internal/health"
 	"paxful/internal/logger"
+	"paxful/internal/ratelimit"
+	"paxful/jobs"
+	"paxful/schedules"
+	"paxful/webhooks"
 )
 
 var (
@@ -22,9 +37,15 @@ var (
 	Error = errs.Class("payment console web server error")
 )
 
+// maxBodySize is a maximal size of request body.
+const maxBodySize = 1 << 20
+
 // Config contains configuration for paxful payment http server.
 type Config struct {
-	Address string `json:"address" help:"url paxful payments web server" default:"127.0.0.1:8081"`
+	Address      string           `json:"address" help:"url paxful payments web server" default:"127.0.0.1:8081" validate:"required,hostport"`
+	DrainTimeout time.Duration    `json:"drainTimeout" help:"how long to wait for in-flight requests on shutdown, 0 means no limit" default:"30s"`
+	RateLimit    ratelimit.Config `json:"rateLimit"`
+	Async        bool             `json:"async" help:"answer every transfer request with 202 and send it by job queue" default:"false"`
 }
 
 // Server represents main admin portal http server with all endpoints.
@@ -34,25 +55,84 @@ type Server struct {
 	log    logger.Logger
 	config Config
 
-	service *console.Service
+	service   *console.Service
+	webhooks  *webhooks.Service
+	batches   *batches.Service
+	schedules *schedules.Service
+	jobs      *jobs.Service
+	health    *health.Service
+	metrics   *metrics
+
+	// shuttingDown is set to 1 when server starts shutdown.
+	shuttingDown int32
+	// closing is closed when server starts shutdown, so long-lived streams could finish.
+	closing     chan struct{}
+	closingOnce sync.Once
+
+	// limiters holds current *limiters, they are replaced as a whole on reload.
+	limiters atomic.Value
+	limits   ratelimit.Store
 
 	server   http.Server
 	listener net.Listener
 }
 
 // NewServer returns new instance of paxful trading console.
-func NewServer(log logger.Logger, service *console.Service, config Config, listener net.Listener) (*Server, error) {
+// limits is used to keep rate limiter state of the clients.
+// server metrics are registered in the registry, and all registry metrics are exposed on /metrics.
+func NewServer(log logger.Logger, service *console.Service, webhooks *webhooks.Service, batches *batches.Service, schedules *schedules.Service, jobs *jobs.Service, health *health.Service, config Config, listener net.Listener, limits ratelimit.Store, registry *prometheus.Registry) (*Server, error) {
+	metrics, err := newMetrics(registry)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
 	server := Server{
-		log:      log,
-		service:  service,
-		config:   config,
-		listener: listener,
+		log:       log,
+		service:   service,
+		webhooks:  webhooks,
+		batches:   batches,
+		schedules: schedules,
+		jobs:      jobs,
+		health:    health,
+		metrics:   metrics,
+		config:    config,
+		listener:  listener,
+		closing:   make(chan struct{}),
+		limits:    limits,
 	}
 
+	server.limiters.Store(newLimiters(config.RateLimit, limits))
+
 	router := mux.NewRouter()
 	router.StrictSlash(true)
+	router.Use(server.requestLog)
+
+	// probes are not rate limited, so they must be registered before api routes.
+	router.Handle("/livez", http.HandlerFunc(server.Liveness)).Methods(http.MethodGet)
+	router.Handle("/healthz", http.HandlerFunc(server.Health)).Methods(http.MethodGet)
+	router.Handle("/readyz", http.HandlerFunc(server.Readiness)).Methods(http.MethodGet)
+	router.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{})).Methods(http.MethodGet)
+
+	api := router.PathPrefix("/").Subrouter()
+	api.Use(server.rateLimit)
 
-	router.Handle("/", http.HandlerFunc(server.CommitTx)).Methods(http.MethodPost)
+	api.Handle("/", http.HandlerFunc(server.CommitTx)).Methods(http.MethodPost)
+	api.Handle("/broadcast", http.HandlerFunc(server.BroadcastTx)).Methods(http.MethodPost)
+
+	api.Handle("/batches", http.HandlerFunc(server.CreateBatch)).Methods(http.MethodPost)
+	api.Handle("/batches/{id}", http.HandlerFunc(server.GetBatch)).Methods(http.MethodGet)
+
+	api.Handle("/jobs/{id}", http.HandlerFunc(server.GetJob)).Methods(http.MethodGet)
+
+	api.Handle("/scheduled", http.HandlerFunc(server.ListScheduled)).Methods(http.MethodGet)
+	api.Handle("/scheduled/{id}", http.HandlerFunc(server.CancelScheduled)).Methods(http.MethodDelete)
+
+	api.Handle("/balances", http.HandlerFunc(server.Balances)).Methods(http.MethodGet)
+	api.Handle("/transactions/stream", http.HandlerFunc(server.StreamTransactions)).Methods(http.MethodGet)
+
+	api.Handle("/webhooks", http.HandlerFunc(server.CreateWebhook)).Methods(http.MethodPost)
+	api.Handle("/webhooks", http.HandlerFunc(server.ListWebhooks)).Methods(http.MethodGet)
+	api.Handle("/webhooks/{id}", http.HandlerFunc(server.DeleteWebhook)).Methods(http.MethodDelete)
 
 	server.server = http.Server{
 		Handler: router,
@@ -67,41 +147,102 @@ func (server *Server) Run(ctx context.Context) (err error) {
 	var group errgroup.Group
 	group.Go(func() error {
 		<-ctx.Done()
-		return Error.Wrap(server.server.Shutdown(context.Background()))
+		atomic.StoreInt32(&server.shuttingDown, 1)
+		server.closingOnce.Do(func() { close(server.closing) })
+
+		shutdownCtx, shutdownCancel := withTimeout(context.Background(), server.config.DrainTimeout)
+		defer shutdownCancel()
+
+		// stops accepting new connections and waits for in-flight requests.
+		return Error.Wrap(server.server.Shutdown(shutdownCtx))
 	})
 	group.Go(func() error {
 		defer cancel()
-		return Error.Wrap(server.server.Serve(server.listener))
+
+		err := server.server.Serve(server.listener)
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+
+		return Error.Wrap(err)
 	})
 
 	return Error.Wrap(group.Wait())
 }
 
+// Reload replaces rate limits, other settings of the server could not be changed without restart.
+func (server *Server) Reload(config Config) {
+	server.limiters.Store(newLimiters(config.RateLimit, server.limits))
+}
+
 // Close closes server and underlying listener.
 func (server *Server) Close() error {
+	server.closingOnce.Do(func() { close(server.closing) })
 	return Error.Wrap(server.server.Close())
 }
 
 // CommitTx is a web api handler that is used to commit a transaction.
 func (server *Server) CommitTx(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	start := time.Now()
+	log := logger.FromContext(ctx, server.log)
 
 	var transaction console.Transaction
 
-	err := json.NewDecoder(r.Body).Decode(&transaction)
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		log.Error("can not read request body", Error.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	ctx = audit.WithCaller(ctx, audit.Caller{
+		Identity:    server.callerIdentity(r),
+		RemoteAddr:  r.RemoteAddr,
+		RequestHash: audit.HashRequest(body),
+	})
+
+	err = json.Unmarshal(body, &transaction)
 	if err != nil {
-		server.log.Error("can not decode request body", Error.Wrap(err))
+		log.Error("can not decode request body", Error.Wrap(err))
+		server.service.RejectTx(ctx, err)
+		server.metrics.observeCommit(currencyLabel(transaction.Currency), start, outcomeBadRequest)
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	err = server.service.CommitTx(ctx, transaction)
+	if transaction.Scheduled() {
+		server.scheduleTx(ctx, w, transaction)
+		return
+	}
+
+	if server.config.Async || preferAsync(r) {
+		err = server.enqueueTx(ctx, w, transaction)
+		server.metrics.observeCommit(currencyLabel(transaction.Currency), start, enqueueOutcome(err))
+		return
+	}
+
+	_, err = server.service.CommitTx(ctx, transaction)
+	server.metrics.observeCommit(currencyLabel(transaction.Currency), start, commitOutcome(err))
 	if err != nil {
-		server.log.Error("can not commit trasnaction", Error.Wrap(err))
+		log.Error("can not commit trasnaction", Error.Wrap(err))
 		if console.ValidationError.Has(err) {
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
+		if console.InsufficientFundsError.Has(err) {
+			http.Error(w, "insufficient funds", http.StatusUnprocessableEntity)
+			return
+		}
+		if console.GasPriceTooHighError.Has(err) {
+			http.Error(w, "gas price exceeds maximum, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		if console.UnavailableError.Has(err) {
+			w.Header().Set("Connection", "close")
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
 
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -113,7 +254,77 @@ func (server *Server) CommitTx(w http.ResponseWriter, r *http.Request) {
 
 	err = json.NewEncoder(w).Encode("transaction committed successfully")
 	if err != nil {
-		server.log.Error("registration handler could not encode userID", Error.Wrap(err))
+		log.Error("registration handler could not encode userID", Error.Wrap(err))
+		return
+	}
+}
+
+// Balances is a web api handler that returns hot wallet balances with pending outgoing amounts.
+func (server *Server) Balances(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	balances, err := server.service.Balances(ctx)
+	if err != nil {
+		logger.FromContext(ctx, server.log).Error("can not get balances", Error.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+
+	server.serveJSON(w, http.StatusOK, balances)
+}
+
+// Liveness is a web api handler that reports that process is alive and serves requests.
+func (server *Server) Liveness(w http.ResponseWriter, r *http.Request) {
+	server.serveJSON(w, http.StatusOK, health.Report{Status: health.StatusOK})
+}
+
+// Health is a web api handler that reports status of every component the service depends on.
+func (server *Server) Health(w http.ResponseWriter, r *http.Request) {
+	server.serveReport(w, server.health.Health(r.Context()))
+}
+
+// Readiness is a web api handler that reports whether service is ready to receive traffic.
+func (server *Server) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := server.health.Readiness(r.Context())
+	if atomic.LoadInt32(&server.shuttingDown) == 1 {
+		report.Status = health.StatusFailed
+		report.Components = append(report.Components, health.Result{
+			Component: "server",
+			Status:    health.StatusFailed,
+			Error:     "server is shutting down",
+		})
+	}
+
+	server.serveReport(w, report)
+}
+
+// serveReport writes health report, responds with 503 if any of the components is not healthy.
+func (server *Server) serveReport(w http.ResponseWriter, report health.Report) {
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	server.serveJSON(w, status, report)
+}
+
+// serveJSON writes response encoded as json with the status code.
+func (server *Server) serveJSON(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		server.log.Error("could not encode response", Error.Wrap(err))
+	}
+}
+
+// withTimeout returns context with the timeout, zero or negative timeout means no deadline.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
 }
@@ -0,0 +1,149 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"paxful/internal/logger"
+	"paxful/payments"
+)
+
+const (
+	// heartbeatInterval defines how often comment is sent to keep idle stream open.
+	heartbeatInterval = 15 * time.Second
+	// replayBatchSize is an amount of stored events read at once on resume.
+	replayBatchSize = 100
+)
+
+// StreamTransactions is a web api handler that pushes transaction status transitions as server-sent events.
+// events could be filtered by currency query parameter, and stream is resumed after Last-Event-ID header
+// (or lastEventId query parameter) by replaying stored events.
+func (server *Server) StreamTransactions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logger.FromContext(ctx, server.log)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var currency payments.PaymentCurrency
+	if value := r.URL.Query().Get("currency"); value != "" {
+		var err error
+		currency, err = payments.PaymentCurrencyFromString(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+
+	var lastID int64
+	resume := lastEventID != ""
+	if resume {
+		var err error
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastID < 0 {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// subscribe before replay, so no event is lost between replay and live stream.
+	live, unsubscribe := server.service.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	_, err := fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+	if err != nil {
+		return
+	}
+	flusher.Flush()
+
+	send := func(event payments.Event) error {
+		if currency != "" && event.Transaction.Currency != currency {
+			return nil
+		}
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		if err != nil {
+			return err
+		}
+
+		flusher.Flush()
+		return nil
+	}
+
+	// ids are assigned when db transaction starts, so live events could come out of order,
+	// only events which are already sent by replay are skipped.
+	replayed := make(map[int64]bool)
+	for resume {
+		events, err := server.service.EventsAfter(ctx, lastID, replayBatchSize)
+		if err != nil {
+			log.Error("can not replay transaction events", Error.Wrap(err))
+			return
+		}
+
+		for _, event := range events {
+			lastID = event.ID
+			replayed[event.ID] = true
+			if err := send(event); err != nil {
+				return
+			}
+		}
+
+		resume = len(events) == replayBatchSize
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-server.closing:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-live:
+			if !ok {
+				// subscriber was dropped because it did not keep up, client will resume with Last-Event-ID.
+				log.Warn("transaction events subscriber dropped")
+				return
+			}
+
+			if replayed[event.ID] {
+				delete(replayed, event.ID)
+				continue
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		}
+	}
+}
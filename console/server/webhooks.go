@@ -0,0 +1,88 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"paxful/internal/logger"
+	"paxful/payments"
+	"paxful/webhooks"
+)
+
+// createWebhookRequest is a body of webhook subscription creation request.
+type createWebhookRequest struct {
+	URL    string               `json:"url"`
+	Events []payments.EventType `json:"events"`
+}
+
+// CreateWebhook is a web api handler that registers webhook subscription.
+// response contains secret which is used to sign webhook requests, it is never shown again.
+func (server *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := server.withCaller(r)
+	log := logger.FromContext(ctx, server.log)
+
+	var request createWebhookRequest
+	err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&request)
+	if err != nil {
+		log.Error("can not decode request body", Error.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := server.webhooks.Create(ctx, request.URL, request.Events)
+	if err != nil {
+		log.Error("can not create webhook subscription", Error.Wrap(err))
+		if webhooks.ValidationError.Has(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	server.serveJSON(w, http.StatusCreated, subscription)
+}
+
+// ListWebhooks is a web api handler that returns all webhook subscriptions.
+func (server *Server) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	subscriptions, err := server.webhooks.List(ctx)
+	if err != nil {
+		logger.FromContext(ctx, server.log).Error("can not list webhook subscriptions", Error.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if subscriptions == nil {
+		subscriptions = []webhooks.Subscription{}
+	}
+
+	server.serveJSON(w, http.StatusOK, subscriptions)
+}
+
+// DeleteWebhook is a web api handler that removes webhook subscription.
+func (server *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := server.withCaller(r)
+
+	err := server.webhooks.Delete(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		logger.FromContext(ctx, server.log).Error("can not delete webhook subscription", Error.Wrap(err))
+		if webhooks.ErrNotFound.Has(err) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
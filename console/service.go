@@ -5,9 +5,15 @@ package console
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/zeebo/errs"
 
+	"paxful/audit"
+	"paxful/internal/logger"
 	"paxful/payments"
 )
 
@@ -15,49 +21,401 @@ import (
 var (
 	Error           = errs.Class("payment console service error")
 	ValidationError = errs.Class("payment console service validation error")
+	// UnavailableError indicates that service is shutting down and does not accept new transfers.
+	UnavailableError = errs.Class("payment console service unavailable")
+	// InsufficientFundsError indicates that hot wallet can not cover transfer amount and fee.
+	InsufficientFundsError = errs.Class("payment console service insufficient funds")
+	// GasPriceTooHighError indicates that network fee exceeds configured maximum.
+	GasPriceTooHighError = errs.Class("payment console service gas price too high")
+	// BroadcastError indicates that transfer could be sent to the network even though sending failed.
+	BroadcastError = errs.Class("payment console service broadcast outcome unknown")
 )
 
+// Config contains transfer policy of the console service, every field could be reloaded without restart.
+type Config struct {
+	MaxAmount MaxAmount `json:"maxAmount"`
+	AllowList []string  `json:"allowList" help:"receiver addresses transfers are allowed to, empty list allows any address" reload:"true"`
+}
+
+// MaxAmount limits amount of a single transfer per currency.
+type MaxAmount struct {
+	ETH float64 `json:"eth" help:"maximum amount of a single ethereum transfer, 0 means no limit" default:"0" validate:"min=0" reload:"true"`
+	BTC float64 `json:"btc" help:"maximum amount of a single bitcoin transfer, 0 means no limit" default:"0" validate:"min=0" reload:"true"`
+}
+
 // Service exposes all payment console related logic.
 type Service struct {
+	log      logger.Logger
 	payments payments.PaymentProvider
 	txDB     payments.TransactionsDB
+	audit    *audit.Service
+	events   *EventBus
+
+	// config holds current Config, it is replaced as a whole on reload.
+	config atomic.Value
+
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+	// pending is an amount of in-flight transfers.
+	pending int64
 }
 
 // NewService is a constructor for payments console Service.
 //
 // architecture: Service
-func NewService(provider payments.PaymentProvider, txDB payments.TransactionsDB) *Service {
-	return &Service{
+func NewService(log logger.Logger, config Config, provider payments.PaymentProvider, txDB payments.TransactionsDB, audit *audit.Service, events *EventBus) *Service {
+	service := &Service{
+		log:      log,
 		payments: provider,
 		txDB:     txDB,
+		audit:    audit,
+		events:   events,
+	}
+	service.config.Store(config)
+
+	return service
+}
+
+// Reload replaces transfer policy, transfers which are already in-flight are not affected.
+func (service *Service) Reload(config Config) {
+	service.config.Store(config)
+}
+
+// CommitTx will commit transaction through payment service and returns sent transaction.
+// every attempt is recorded to the audit log with the caller taken from ctx.
+func (service *Service) CommitTx(ctx context.Context, transaction Transaction) (tx payments.Transaction, err error) {
+	defer func() { service.auditCommit(ctx, transaction, tx, err) }()
+
+	if !service.acquire() {
+		return payments.Transaction{}, UnavailableError.New("service is shutting down")
 	}
+	defer service.release()
+
+	return service.commitTx(ctx, transaction)
+}
+
+// Validate checks transfer request without sending it, returns ValidationError if it is invalid.
+func (service *Service) Validate(ctx context.Context, transaction Transaction) error {
+	_, _, err := service.parse(transaction)
+	return err
 }
 
-// CommitTx will commit transaction through payment service.
-func (service *Service) CommitTx(ctx context.Context, transaction Transaction) error {
+// Balance describes hot wallet balance of the currency.
+type Balance struct {
+	Currency payments.PaymentCurrency `json:"currency"`
+	Network  string                   `json:"network"`
+	// Balance is a balance reported by the node.
+	Balance float64 `json:"balance"`
+	// PendingOutgoing is a sum of sent values and fees of transfers which are not yet included to the block.
+	PendingOutgoing float64 `json:"pendingOutgoing"`
+	// Available is a balance without pending outgoing transfers.
+	Available float64 `json:"available"`
+}
+
+// Balances returns hot wallet balances of all supported currencies.
+func (service *Service) Balances(ctx context.Context) ([]Balance, error) {
+	sent, err := service.txDB.ListByStatus(ctx, payments.TransactionStatusSuccess)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	pending := make(map[payments.PaymentCurrency]float64)
+	for _, tx := range sent {
+		// transfers of other networks are not paid from the hot wallet of configured one,
+		// and mined transfers are already taken from the balance reported by the node.
+		if tx.Mined || !service.sameNetwork(tx) {
+			continue
+		}
+		pending[tx.Currency] += tx.Outgoing()
+	}
+
+	var balances []Balance
+	for _, currency := range service.payments.Currencies() {
+		transactions, err := service.payments.GetByCurrency(currency)
+		if err != nil {
+			return nil, Error.Wrap(err)
+		}
+
+		balance, err := transactions.Balance(ctx)
+		if err != nil {
+			return nil, Error.Wrap(err)
+		}
+
+		balances = append(balances, Balance{
+			Currency:        currency,
+			Network:         transactions.Network().Name,
+			Balance:         balance,
+			PendingOutgoing: pending[currency],
+			Available:       balance - pending[currency],
+		})
+	}
+
+	return balances, nil
+}
+
+// ListTx returns stored transactions matching the filter, newest first.
+func (service *Service) ListTx(ctx context.Context, filter payments.TransactionFilter) ([]payments.Transaction, error) {
+	transactions, err := service.txDB.Find(ctx, filter)
+	for i := range transactions {
+		transactions[i].ExplorerURL = service.explorerURL(transactions[i])
+	}
+	return transactions, Error.Wrap(err)
+}
+
+// GetTx returns all outputs of stored transaction, error has payments.ErrTransactionNotFound class if there is none.
+func (service *Service) GetTx(ctx context.Context, id string) ([]payments.Transaction, error) {
+	outputs, err := service.txDB.Get(ctx, id)
+	for i := range outputs {
+		outputs[i].ExplorerURL = service.explorerURL(outputs[i])
+	}
+	return outputs, Error.Wrap(err)
+}
+
+// sameNetwork returns true if transaction is sent to the network payment service of its currency is configured for.
+func (service *Service) sameNetwork(tx payments.Transaction) bool {
+	transactions, err := service.payments.GetByCurrency(tx.Currency)
+	if err != nil {
+		return false
+	}
+
+	return transactions.Network().CheckNetwork(tx.Network) == nil
+}
+
+// explorerURL returns explorer url of the transaction, explorer of configured network
+// is used only for transactions of the same network.
+func (service *Service) explorerURL(tx payments.Transaction) string {
+	if !service.sameNetwork(tx) {
+		return ""
+	}
+
+	transactions, _ := service.payments.GetByCurrency(tx.Currency)
+	return transactions.Network().TransactionURL(tx.ID)
+}
+
+// Subscribe returns channel of live transaction events and function to unsubscribe.
+func (service *Service) Subscribe() (<-chan payments.Event, func()) {
+	return service.events.Subscribe()
+}
+
+// EventsAfter returns up to limit stored transaction events with id greater than afterID.
+func (service *Service) EventsAfter(ctx context.Context, afterID int64, limit int) ([]payments.Event, error) {
+	events, err := service.txDB.Events(ctx, afterID, limit)
+	return events, Error.Wrap(err)
+}
+
+// RejectTx records transfer request which could not be parsed to the audit log.
+func (service *Service) RejectTx(ctx context.Context, reason error) {
+	service.auditCommit(ctx, Transaction{}, payments.Transaction{}, ValidationError.Wrap(reason))
+}
+
+// parse validates transfer request and converts it to the transaction of supported currency.
+func (service *Service) parse(transaction Transaction) (payments.Transaction, payments.Transactions, error) {
 	currency, err := payments.PaymentCurrencyFromString(transaction.Currency)
 	if err != nil {
-		return ValidationError.Wrap(err)
+		return payments.Transaction{}, nil, ValidationError.Wrap(err)
+	}
+
+	urgency, err := payments.UrgencyFromString(transaction.Urgency)
+	if err != nil {
+		return payments.Transaction{}, nil, ValidationError.Wrap(err)
 	}
 
 	transactions, err := service.payments.GetByCurrency(currency)
 	if err != nil {
-		return ValidationError.Wrap(err)
+		return payments.Transaction{}, nil, ValidationError.Wrap(err)
+	}
+
+	if err = transactions.Network().CheckNetwork(transaction.Network); err != nil {
+		return payments.Transaction{}, nil, ValidationError.Wrap(err)
+	}
+
+	if transaction.Amount <= 0 {
+		return payments.Transaction{}, nil, ValidationError.New("amount must be positive")
+	}
+
+	if err = transactions.ValidateAddress(transaction.To); err != nil {
+		return payments.Transaction{}, nil, ValidationError.Wrap(err)
+	}
+
+	if err = service.checkPolicy(currency, transaction); err != nil {
+		return payments.Transaction{}, nil, err
 	}
 
-	tx, err := transactions.Commit(ctx, payments.Transaction{
+	return payments.Transaction{
 		Currency: currency,
 		Amount:   transaction.Amount,
 		To:       transaction.To,
-	})
-	if err != nil {
-		if payments.ValidationError.Has(err) {
-			return ValidationError.Wrap(err)
+		Urgency:  urgency,
+	}, transactions, nil
+}
+
+// checkPolicy checks transfer against amount limits and receivers allow-list of current config.
+func (service *Service) checkPolicy(currency payments.PaymentCurrency, transaction Transaction) error {
+	config := service.config.Load().(Config)
+
+	maxAmount := config.MaxAmount.ETH
+	if currency == payments.PaymentCurrencyBTC {
+		maxAmount = config.MaxAmount.BTC
+	}
+	if maxAmount > 0 && transaction.Amount > maxAmount {
+		return ValidationError.New("amount exceeds maximum %v %s", maxAmount, currency)
+	}
+
+	if len(config.AllowList) == 0 {
+		return nil
+	}
+	for _, address := range config.AllowList {
+		if strings.EqualFold(address, transaction.To) {
+			return nil
 		}
+	}
+
+	return ValidationError.New("receiver address is not in allow-list")
+}
+
+// commitTx sends transaction and stores it in the database.
+func (service *Service) commitTx(ctx context.Context, transaction Transaction) (payments.Transaction, error) {
+	request, transactions, err := service.parse(transaction)
+	if err != nil {
+		return payments.Transaction{}, err
+	}
+
+	tx, err := transactions.Commit(ctx, request)
+	if err != nil {
+		return payments.Transaction{}, wrapPaymentsError(err)
+	}
+
+	// explorer url is not stored, but it is a part of created event payload.
+	tx.ExplorerURL = service.explorerURL(tx)
+	return tx, service.store(ctx, tx)
+}
+
+// store saves sent transaction to the database and notifies listeners.
+func (service *Service) store(ctx context.Context, tx payments.Transaction) error {
+	log := logger.FromContext(ctx, service.log).With(
+		logger.String("currency", string(tx.Currency)),
+		logger.String("txID", tx.ID),
+	)
+
+	event, err := service.txDB.Commit(ctx, tx)
+	if err != nil {
+		// transaction is already broadcasted, so its id must not be lost.
+		log.Error("transaction was sent, but not stored", err, logger.Any("transaction", tx))
 		return Error.Wrap(err)
 	}
 
-	err = service.txDB.Commit(ctx, tx)
+	service.events.Publish(event)
+	log.Info("transaction committed", logger.Any("amount", tx.Amount), logger.String("to", tx.To), logger.String("network", tx.Network))
+
+	return nil
+}
+
+// wrapPaymentsError converts error of payment service to the console error class of the same meaning.
+func wrapPaymentsError(err error) error {
+	switch {
+	case payments.ValidationError.Has(err):
+		return ValidationError.Wrap(err)
+	case payments.InsufficientFundsError.Has(err):
+		return InsufficientFundsError.Wrap(err)
+	case payments.GasPriceTooHighError.Has(err):
+		return GasPriceTooHighError.Wrap(err)
+	case payments.BroadcastError.Has(err):
+		return BroadcastError.Wrap(err)
+	default:
+		return Error.Wrap(err)
+	}
+}
+
+// auditDetails is a content of audit log entry details for transfer requests.
+type auditDetails struct {
+	Request Transaction `json:"request"`
+	TxID    string      `json:"txId,omitempty"`
+}
+
+// auditCommit records transfer attempt outcome to the audit log.
+// audit failure does not fail the transfer, since assets could be already sent.
+func (service *Service) auditCommit(ctx context.Context, transaction Transaction, tx payments.Transaction, err error) {
+	outcome := auditOutcome(err)
+
+	caller := audit.CallerFromContext(ctx)
+	if caller.RequestHash == "" {
+		body, _ := json.Marshal(transaction)
+		caller.RequestHash = audit.HashRequest(body)
+	}
+
+	details, _ := json.Marshal(auditDetails{Request: transaction, TxID: tx.ID})
+
+	// transfer could be already done, so audit record should not be lost because of canceled request.
+	auditCtx := audit.WithCaller(context.Background(), caller)
+	auditErr := service.audit.Record(auditCtx, audit.ActionCommitTx, outcome, err, string(details))
+	if auditErr != nil {
+		logger.FromContext(ctx, service.log).Error("could not record transfer to audit log", auditErr,
+			logger.String("outcome", string(outcome)), logger.String("details", string(details)))
+	}
+}
+
+// auditOutcome returns audit outcome of transfer attempt which finished with err.
+func auditOutcome(err error) audit.Outcome {
+	switch {
+	case ValidationError.Has(err), UnavailableError.Has(err), InsufficientFundsError.Has(err),
+		GasPriceTooHighError.Has(err):
+		return audit.OutcomeRejected
+	case err != nil:
+		return audit.OutcomeFailed
+	default:
+		return audit.OutcomeSuccess
+	}
+}
+
+// Close stops accepting new transfers. In-flight transfers are not interrupted.
+func (service *Service) Close() {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	service.closed = true
+}
+
+// Drain stops accepting new transfers and waits until all in-flight transfers are finished
+// or ctx is done.
+func (service *Service) Drain(ctx context.Context) error {
+	service.Close()
+
+	done := make(chan struct{})
+	go func() {
+		service.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return Error.New("in-flight transfers were not finished: %v", ctx.Err())
+	}
+}
+
+// acquire registers new in-flight transfer, returns false if service is closed.
+func (service *Service) acquire() bool {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if service.closed {
+		return false
+	}
+
+	service.inflight.Add(1)
+	atomic.AddInt64(&service.pending, 1)
+	return true
+}
+
+// release unregisters finished in-flight transfer.
+func (service *Service) release() {
+	atomic.AddInt64(&service.pending, -1)
+	service.inflight.Done()
+}
 
-	return Error.Wrap(err)
+// Pending returns amount of transfers which are in progress.
+func (service *Service) Pending() int64 {
+	return atomic.LoadInt64(&service.pending)
 }
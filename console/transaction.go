@@ -3,9 +3,48 @@
 
 package console
 
+import (
+	"time"
+)
+
 // Transaction hold information needed to create transaction.
 type Transaction struct {
 	Currency string  `json:"currency"`
 	Amount   float64 `json:"amount"`
 	To       string  `json:"to"`
+	// Urgency is one of slow, normal or fast, normal if empty.
+	Urgency string `json:"urgency,omitempty"`
+	// Network is a name of the network transfer is meant for, transfer is rejected if service
+	// is configured for another one. any network is accepted if empty.
+	Network string `json:"network,omitempty"`
+	// ExecuteAt delays transfer until the time, transfer is sent immediately if empty.
+	ExecuteAt *time.Time `json:"executeAt,omitempty"`
+	// Recurrence repeats delayed transfer, requires ExecuteAt.
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+}
+
+// Scheduled returns true if transfer should not be sent immediately.
+func (transaction Transaction) Scheduled() bool {
+	return transaction.ExecuteAt != nil || transaction.Recurrence != nil
+}
+
+// Recurrence is a rule of repeating scheduled transfer.
+type Recurrence struct {
+	// Every is an interval between runs in go duration format, e.g. "24h".
+	Every string `json:"every"`
+	// Count is a total amount of runs, 0 means that transfer is repeated until canceled.
+	Count int `json:"count,omitempty"`
+}
+
+// Interval returns parsed interval between runs.
+func (recurrence Recurrence) Interval() (time.Duration, error) {
+	interval, err := time.ParseDuration(recurrence.Every)
+	if err != nil {
+		return 0, ValidationError.Wrap(err)
+	}
+	if interval <= 0 {
+		return 0, ValidationError.New("recurrence interval must be positive")
+	}
+
+	return interval, nil
 }
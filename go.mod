@@ -6,8 +6,11 @@ require (
 	github.com/ethereum/go-ethereum v1.9.19
 	github.com/gorilla/mux v1.7.4
 	github.com/lib/pq v1.8.0
+	github.com/prometheus/client_golang v1.7.1
 	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.3
 	github.com/zeebo/errs v1.2.2
 	go.uber.org/zap v1.15.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
 )
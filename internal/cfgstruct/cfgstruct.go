@@ -0,0 +1,370 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+// Package cfgstruct binds config structs to json files, environment variables and command line flags
+// using `json`, `help`, `default`, `validate`, `secret` and `reload` struct tags.
+//
+// `default` tag of a struct field overrides defaults of its fields, so the same struct type could have
+// different defaults in different places, e.g. `default:"maxAttempts=5,initialBackoff=5s"`.
+package cfgstruct
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/pflag"
+	"github.com/zeebo/errs"
+)
+
+// Error is the default cfgstruct error class.
+var Error = errs.Class("config error")
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Field is a single configurable value of config struct.
+type Field struct {
+	// Key is a json path of the field, e.g. server.drainTimeout. Embedded structs do not add path segment.
+	Key string
+	// Flag is a command line flag name, e.g. server.drain-timeout.
+	Flag string
+	// Env is an environment variable name, e.g. PAXFUL_SERVER_DRAIN_TIMEOUT.
+	Env      string
+	Help     string
+	Default  string
+	Validate string
+	// Secret fields are resolvable references and are redacted when config is printed, see Resolve and Redact.
+	Secret bool
+	// Reloadable fields could be changed without restart.
+	Reloadable bool
+
+	value reflect.Value
+}
+
+// Fields returns all configurable fields of the config, which must be a pointer to struct.
+// json key of embedded struct is used only in the file, so its fields are flattened for flags and environment.
+func Fields(config interface{}, envPrefix string) []Field {
+	value := reflect.ValueOf(config)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		panic("cfgstruct: config must be a pointer to struct")
+	}
+
+	var fields []Field
+	walk(value.Elem(), nil, envPrefix, nil, &fields)
+	return fields
+}
+
+// walk collects leaf fields of the struct value, defaults override `default` tags of the fields by json name.
+func walk(value reflect.Value, path []string, envPrefix string, defaults map[string]string, fields *[]Field) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() == reflect.Struct && field.Type != durationType {
+			nested := structDefaults(field.Tag.Get("default"))
+			if field.Anonymous {
+				// fields of embedded struct are fields of the parent, so parent overrides apply to them too.
+				for key, value := range defaults {
+					if _, ok := nested[key]; !ok {
+						nested[key] = value
+					}
+				}
+				walk(fieldValue, path, envPrefix, nested, fields)
+			} else {
+				walk(fieldValue, append(append([]string{}, path...), name), envPrefix, nested, fields)
+			}
+			continue
+		}
+
+		if !supported(field.Type) {
+			continue
+		}
+
+		defaultValue, ok := defaults[name]
+		if !ok {
+			defaultValue = field.Tag.Get("default")
+		}
+
+		segments := append(append([]string{}, path...), name)
+		flags := make([]string, len(segments))
+		envs := make([]string, len(segments))
+		for j, segment := range segments {
+			words := splitWords(segment)
+			flags[j] = strings.ToLower(strings.Join(words, "-"))
+			envs[j] = strings.ToUpper(strings.Join(words, "_"))
+		}
+
+		*fields = append(*fields, Field{
+			Key:        strings.Join(segments, "."),
+			Flag:       strings.Join(flags, "."),
+			Env:        envPrefix + strings.Join(envs, "_"),
+			Help:       field.Tag.Get("help"),
+			Default:    defaultValue,
+			Validate:   field.Tag.Get("validate"),
+			Secret:     field.Tag.Get("secret") == "true",
+			Reloadable: field.Tag.Get("reload") == "true",
+			value:      fieldValue,
+		})
+	}
+}
+
+// structDefaults parses `default` tag of a struct field: comma separated json names with values.
+func structDefaults(tag string) map[string]string {
+	defaults := make(map[string]string)
+	for _, pair := range strings.Split(tag, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		defaults[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return defaults
+}
+
+// supported checks that value of the type could be parsed from string.
+func supported(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Uint64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return typ.Elem().Kind() == reflect.String
+	default:
+		return false
+	}
+}
+
+// splitWords splits camelCase name into lower case words, e.g. gasPriceInWei -> gas, price, in, wei.
+func splitWords(name string) []string {
+	var words []string
+	var word []rune
+
+	runes := []rune(name)
+	for i, r := range runes {
+		upper := unicode.IsUpper(r)
+		// acronyms like URL are kept as a single word.
+		boundary := upper && i > 0 && (!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])))
+		if boundary && len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = nil
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, strings.ToLower(string(word)))
+	}
+
+	return words
+}
+
+// Set parses raw value into the field.
+func (field Field) Set(raw string) error {
+	if err := set(field.value, raw); err != nil {
+		return Error.New("%s: %v", field.Key, err)
+	}
+
+	return nil
+}
+
+// Value returns current value of the field.
+func (field Field) Value() interface{} {
+	return field.value.Interface()
+}
+
+// set parses raw value into the value according to its type.
+func set(value reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			// json config keeps durations in nanoseconds.
+			nanoseconds, parseErr := strconv.ParseInt(raw, 10, 64)
+			if parseErr != nil {
+				return err
+			}
+			duration = time.Duration(nanoseconds)
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetUint(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		list := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			list.Index(i).SetString(item)
+		}
+		value.Set(list)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+
+	return nil
+}
+
+// Diff returns fields of next config which values differ from previous one, configs must be pointers
+// to the same struct type.
+func Diff(previous, next interface{}, envPrefix string) []Field {
+	previousFields := Fields(previous, envPrefix)
+	nextFields := Fields(next, envPrefix)
+
+	var changed []Field
+	for i, field := range nextFields {
+		if !reflect.DeepEqual(previousFields[i].Value(), field.Value()) {
+			changed = append(changed, field)
+		}
+	}
+
+	return changed
+}
+
+// flagValue keeps raw flag value until config is loaded, so flags are applied over file and environment.
+type flagValue struct {
+	typ reflect.Type
+	raw string
+}
+
+// String implements pflag.Value.
+func (flag *flagValue) String() string { return flag.raw }
+
+// Type implements pflag.Value.
+func (flag *flagValue) Type() string {
+	if flag.typ == durationType {
+		return "duration"
+	}
+	if flag.typ.Kind() == reflect.Slice {
+		return "strings"
+	}
+
+	return flag.typ.Kind().String()
+}
+
+// Set implements pflag.Value, value is checked to be parsable, but it is not applied to the config yet.
+func (flag *flagValue) Set(raw string) error {
+	if err := set(reflect.New(flag.typ).Elem(), raw); err != nil {
+		return err
+	}
+
+	flag.raw = raw
+	return nil
+}
+
+// BindFlags registers a flag for every field of the config.
+// config is used only as a template, flags are applied to the config passed to Load.
+func BindFlags(flags *pflag.FlagSet, config interface{}, envPrefix string) {
+	for _, field := range Fields(config, envPrefix) {
+		help := field.Help
+		if help == "" {
+			help = field.Key
+		}
+
+		flags.Var(&flagValue{typ: field.value.Type(), raw: field.Default}, field.Flag, fmt.Sprintf("%s (env %s)", help, field.Env))
+	}
+}
+
+// Load fills config in order of precedence: `default` tags, json file, environment variables with envPrefix
+// and changed flags. file is not read if path is empty, or if it does not exist and optional is true.
+// every invalid value is reported in returned Errors.
+func Load(config interface{}, path string, optional bool, flags *pflag.FlagSet, envPrefix string) error {
+	var errors Errors
+	fields := Fields(config, envPrefix)
+
+	for _, field := range fields {
+		if field.Default == "" {
+			continue
+		}
+		if err := set(field.value, field.Default); err != nil {
+			errors = append(errors, FieldError{Key: field.Key, Message: "invalid default: " + err.Error()})
+		}
+	}
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		switch {
+		case os.IsNotExist(err) && optional:
+		case err != nil:
+			return Error.Wrap(err)
+		default:
+			if err = json.Unmarshal(data, config); err != nil {
+				errors = append(errors, FieldError{Key: path, Message: err.Error()})
+			}
+		}
+	}
+
+	for _, field := range fields {
+		raw, ok := os.LookupEnv(field.Env)
+		if !ok {
+			continue
+		}
+		if err := set(field.value, raw); err != nil {
+			errors = append(errors, FieldError{Key: field.Key, Message: fmt.Sprintf("invalid %s: %v", field.Env, err)})
+		}
+	}
+
+	if flags != nil {
+		for _, field := range fields {
+			flag := flags.Lookup(field.Flag)
+			if flag == nil || !flag.Changed {
+				continue
+			}
+			if err := set(field.value, flag.Value.String()); err != nil {
+				errors = append(errors, FieldError{Key: field.Key, Message: fmt.Sprintf("invalid --%s: %v", field.Flag, err)})
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return errors
+	}
+
+	return nil
+}
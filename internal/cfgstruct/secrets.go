@@ -0,0 +1,209 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package cfgstruct
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// prefixes of secret references.
+const (
+	refEnv       = "env:"
+	refFile      = "file:"
+	refEncrypted = "enc:"
+)
+
+// Redacted replaces values of secret fields when config is printed or logged.
+const Redacted = "[REDACTED]"
+
+// MasterKeySize is a size of AES-256 key which encrypts `enc:` values.
+const MasterKeySize = 32
+
+// Resolve replaces references in string fields with `secret:"true"` tag by values they point to:
+//
+//	env:NAME   - value of environment variable NAME
+//	file:PATH  - content of the file, surrounding whitespace is trimmed
+//	enc:DATA   - base64 encoded AES-256-GCM nonce and ciphertext, decrypted with masterKey
+//
+// values without these prefixes are kept as is, every item of string list is resolved separately.
+// every unresolvable reference is reported in returned Errors, messages never contain secret values.
+func Resolve(config interface{}, envPrefix string, masterKey []byte) error {
+	var unresolved Errors
+	for _, field := range Fields(config, envPrefix) {
+		if !field.Secret {
+			continue
+		}
+
+		switch field.value.Kind() {
+		case reflect.String:
+			resolved, err := resolve(field.value.String(), masterKey)
+			if err != nil {
+				unresolved = append(unresolved, FieldError{Key: field.Key, Message: err.Error()})
+				continue
+			}
+			field.value.SetString(resolved)
+		case reflect.Slice:
+			// slice could share items with another config, so resolved items are set to a new one.
+			items := make([]string, field.value.Len())
+			for i := range items {
+				resolved, err := resolve(field.value.Index(i).String(), masterKey)
+				if err != nil {
+					unresolved = append(unresolved, FieldError{Key: fmt.Sprintf("%s[%d]", field.Key, i), Message: err.Error()})
+				}
+				items[i] = resolved
+			}
+			field.value.Set(reflect.ValueOf(items).Convert(field.value.Type()))
+		}
+	}
+
+	if len(unresolved) > 0 {
+		return unresolved
+	}
+
+	return nil
+}
+
+// resolve returns value the reference points to.
+func resolve(reference string, masterKey []byte) (string, error) {
+	switch {
+	case strings.HasPrefix(reference, refEnv):
+		name := strings.TrimPrefix(reference, refEnv)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(reference, refFile):
+		path := strings.TrimPrefix(reference, refFile)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read secret file %s", path)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.HasPrefix(reference, refEncrypted):
+		return decrypt(masterKey, reference)
+	default:
+		return reference, nil
+	}
+}
+
+// ParseMasterKey decodes hex encoded master key.
+func ParseMasterKey(raw string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(raw))
+	if err != nil || len(key) != MasterKeySize {
+		return nil, Error.New("master key must be %d hex encoded bytes", MasterKeySize)
+	}
+
+	return key, nil
+}
+
+// Encrypt encrypts secret with master key and returns `enc:` reference which could be put to config.
+func Encrypt(masterKey []byte, secret string) (string, error) {
+	gcm, err := newGCM(masterKey)
+	if err != nil {
+		return "", Error.Wrap(err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", Error.Wrap(err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return refEncrypted + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts `enc:` reference created by Encrypt.
+func Decrypt(masterKey []byte, reference string) (string, error) {
+	secret, err := decrypt(masterKey, reference)
+	return secret, Error.Wrap(err)
+}
+
+// decrypt decrypts `enc:` reference, error messages are reported as config field errors.
+func decrypt(masterKey []byte, reference string) (string, error) {
+	if len(masterKey) == 0 {
+		return "", errors.New("master key is not set")
+	}
+
+	gcm, err := newGCM(masterKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(reference, refEncrypted))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is malformed")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	secret, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("could not decrypt value, master key is wrong or value is corrupted")
+	}
+
+	return string(secret), nil
+}
+
+// newGCM creates AES-256-GCM cipher.
+func newGCM(masterKey []byte) (cipher.AEAD, error) {
+	if len(masterKey) != MasterKeySize {
+		return nil, fmt.Errorf("master key must be %d bytes", MasterKeySize)
+	}
+
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Redact returns a copy of the config, which must be a pointer to struct, with non empty secret fields
+// replaced by Redacted, so it could be safely printed or logged.
+func Redact(config interface{}, envPrefix string) interface{} {
+	original := reflect.ValueOf(config)
+	if original.Kind() != reflect.Ptr || original.Elem().Kind() != reflect.Struct {
+		panic("cfgstruct: config must be a pointer to struct")
+	}
+
+	redacted := reflect.New(original.Elem().Type())
+	redacted.Elem().Set(original.Elem())
+
+	for _, field := range Fields(redacted.Interface(), envPrefix) {
+		if !field.Secret {
+			continue
+		}
+
+		switch field.value.Kind() {
+		case reflect.String:
+			if field.value.String() != "" {
+				field.value.SetString(Redacted)
+			}
+		case reflect.Slice:
+			// items are shared with the original config, so they are replaced with a new slice.
+			items := make([]string, field.value.Len())
+			for i := range items {
+				if field.value.Index(i).String() != "" {
+					items[i] = Redacted
+				}
+			}
+			if field.value.Len() > 0 {
+				field.value.Set(reflect.ValueOf(items).Convert(field.value.Type()))
+			}
+		}
+	}
+
+	return redacted.Interface()
+}
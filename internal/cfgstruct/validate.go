@@ -0,0 +1,150 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package cfgstruct
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldError describes invalid value of the config field.
+type FieldError struct {
+	Key     string
+	Message string
+}
+
+// Errors is a list of invalid config fields.
+type Errors []FieldError
+
+// Error implements error interface.
+func (errors Errors) Error() string {
+	messages := make([]string, 0, len(errors))
+	for _, err := range errors {
+		messages = append(messages, err.Key+": "+err.Message)
+	}
+
+	return "invalid config: " + strings.Join(messages, "; ")
+}
+
+// Validate checks every field of the config against rules of its `validate` tag, rules are separated by comma:
+//
+//	required       - value must not be zero
+//	url            - value must be an absolute url, empty value is allowed
+//	hostport       - value must be host:port address, empty value is allowed
+//	hex=N          - value must be N hex encoded bytes, optional 0x prefix, empty value is allowed
+//	min=N, max=N   - numeric value must be within bounds
+//	oneof=a|b|c    - value must be one of listed values, empty value is allowed
+func Validate(config interface{}, envPrefix string) error {
+	var errors Errors
+	for _, field := range Fields(config, envPrefix) {
+		if field.Validate == "" {
+			continue
+		}
+
+		for _, rule := range strings.Split(field.Validate, ",") {
+			if message := check(field.value, rule); message != "" {
+				errors = append(errors, FieldError{Key: field.Key, Message: message})
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return errors
+	}
+
+	return nil
+}
+
+// check returns description of rule violation, or empty string if value satisfies the rule.
+func check(value reflect.Value, rule string) string {
+	name, argument := rule, ""
+	if index := strings.Index(rule, "="); index >= 0 {
+		name, argument = rule[:index], rule[index+1:]
+	}
+
+	text := fmt.Sprint(value.Interface())
+	if value.Kind() == reflect.String {
+		text = value.String()
+	}
+
+	switch name {
+	case "required":
+		if value.IsZero() {
+			return "is required"
+		}
+	case "url":
+		if text == "" {
+			return ""
+		}
+		parsed, err := url.Parse(text)
+		if err != nil || parsed.Scheme == "" {
+			return "must be an absolute url"
+		}
+	case "hostport":
+		if text == "" {
+			return ""
+		}
+		if _, _, err := net.SplitHostPort(text); err != nil {
+			return "must be host:port address"
+		}
+	case "hex":
+		if text == "" {
+			return ""
+		}
+		data, err := hex.DecodeString(strings.TrimPrefix(text, "0x"))
+		size, _ := strconv.Atoi(argument)
+		if err != nil || (size > 0 && len(data) != size) {
+			return fmt.Sprintf("must be %s hex encoded bytes", argument)
+		}
+	case "min", "max":
+		bound, err := strconv.ParseFloat(argument, 64)
+		if err != nil {
+			return "invalid rule " + rule
+		}
+		number, ok := numeric(value)
+		if !ok {
+			return "invalid rule " + rule + " for non numeric value"
+		}
+		if name == "min" && number < bound {
+			return "must be at least " + argument
+		}
+		if name == "max" && number > bound {
+			return "must be at most " + argument
+		}
+	case "oneof":
+		if text == "" {
+			return ""
+		}
+		options := strings.Split(argument, "|")
+		for _, option := range options {
+			if text == option {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(options, ", ")
+	default:
+		return "unknown rule " + rule
+	}
+
+	return ""
+}
+
+// numeric returns value of numeric kinds as float.
+func numeric(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float64:
+		return value.Float(), true
+	default:
+		return 0, false
+	}
+}
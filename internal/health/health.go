@@ -0,0 +1,157 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Config contains configuration for health checks.
+type Config struct {
+	Timeout time.Duration `json:"timeout" help:"maximum duration of a single component check" default:"5s"`
+}
+
+// Kind defines when check should be run.
+type Kind int
+
+const (
+	// KindHealth is a check of a component that is required for the service to work.
+	KindHealth Kind = 0
+	// KindReadiness is a check that should pass only before service starts to receive traffic.
+	KindReadiness Kind = 1
+)
+
+// Status indicates result of a check.
+type Status string
+
+const (
+	// StatusOK indicates that component is healthy.
+	StatusOK Status = "ok"
+	// StatusFailed indicates that component is not healthy.
+	StatusFailed Status = "failed"
+)
+
+// CheckFunc checks a component, returns nil if component is healthy.
+type CheckFunc func(ctx context.Context) error
+
+// Result is a result of a single component check.
+type Result struct {
+	Component string  `json:"component"`
+	Status    Status  `json:"status"`
+	LatencyMS float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report combines results of all component checks.
+type Report struct {
+	Status     Status   `json:"status"`
+	Components []Result `json:"components"`
+}
+
+// check is a registered component check.
+type check struct {
+	component string
+	kind      Kind
+	fn        CheckFunc
+}
+
+// Service runs registered component checks.
+//
+// architecture: Service
+type Service struct {
+	config Config
+
+	mu     sync.Mutex
+	checks []check
+}
+
+// NewService is a constructor for health Service.
+func NewService(config Config) *Service {
+	return &Service{
+		config: config,
+	}
+}
+
+// Register adds new component check.
+func (service *Service) Register(component string, kind Kind, fn CheckFunc) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	service.checks = append(service.checks, check{
+		component: component,
+		kind:      kind,
+		fn:        fn,
+	})
+}
+
+// Health runs all health checks concurrently.
+func (service *Service) Health(ctx context.Context) Report {
+	return service.run(ctx, KindHealth)
+}
+
+// Readiness runs all health and readiness checks concurrently.
+func (service *Service) Readiness(ctx context.Context) Report {
+	return service.run(ctx, KindReadiness)
+}
+
+// run runs checks with kind less or equal to the kind.
+func (service *Service) run(ctx context.Context, kind Kind) Report {
+	service.mu.Lock()
+	var checks []check
+	for _, check := range service.checks {
+		if check.kind <= kind {
+			checks = append(checks, check)
+		}
+	}
+	service.mu.Unlock()
+
+	report := Report{
+		Status:     StatusOK,
+		Components: make([]Result, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			report.Components[i] = service.runCheck(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range report.Components {
+		if result.Status != StatusOK {
+			report.Status = StatusFailed
+		}
+	}
+
+	return report
+}
+
+// runCheck runs single check with configured timeout.
+func (service *Service) runCheck(ctx context.Context, check check) Result {
+	if service.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, service.config.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := check.fn(ctx)
+
+	result := Result{
+		Component: check.component,
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	}
+
+	return result
+}
@@ -0,0 +1,222 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+// Package keystore keeps private keys of hot wallets encrypted with a password.
+// Keys are encrypted with scrypt and AES-128-CTR the same way as ethereum keystore files,
+// public key is kept in plain text, so addresses could be derived without password.
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	ethkeystore "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zeebo/errs"
+)
+
+var (
+	// Error is the default keystore error class.
+	Error = errs.Class("keystore error")
+	// ErrNotFound indicates that there is no key with the name.
+	ErrNotFound = errs.Class("key not found")
+	// ErrExists indicates that key with the name already exists.
+	ErrExists = errs.Class("key already exists")
+	// ErrPassword indicates that key could not be decrypted with the password.
+	ErrPassword = errs.Class("wrong password")
+)
+
+// fileExtension is an extension of key files.
+const fileExtension = ".json"
+
+// namePattern restricts key names, so they are safe to use as file names.
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// file is a key file stored in the keystore.
+type file struct {
+	Name      string                 `json:"name"`
+	PublicKey string                 `json:"publicKey"`
+	Crypto    ethkeystore.CryptoJSON `json:"crypto"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+// Keystore keeps encrypted keys as files in a directory.
+type Keystore struct {
+	dir     string
+	scryptN int
+	scryptP int
+}
+
+// New is a constructor for Keystore in the dir.
+func New(dir string) *Keystore {
+	return &Keystore{
+		dir:     dir,
+		scryptN: ethkeystore.StandardScryptN,
+		scryptP: ethkeystore.StandardScryptP,
+	}
+}
+
+// Generate creates new random key with the name, returns its public key.
+func (keystore *Keystore) Generate(name, password string) (*ecdsa.PublicKey, error) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	return keystore.Import(name, privateKey, password)
+}
+
+// Import stores existing key with the name, returns its public key.
+// returns ErrExists if there is a key with the same name already, existing key is never overwritten.
+func (keystore *Keystore) Import(name string, privateKey *ecdsa.PrivateKey, password string) (*ecdsa.PublicKey, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	if password == "" {
+		return nil, Error.New("password must not be empty")
+	}
+
+	encrypted, err := ethkeystore.EncryptDataV3(crypto.FromECDSA(privateKey), []byte(password), keystore.scryptN, keystore.scryptP)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	data, err := json.MarshalIndent(file{
+		Name:      name,
+		PublicKey: hex.EncodeToString(crypto.CompressPubkey(&privateKey.PublicKey)),
+		Crypto:    encrypted,
+		CreatedAt: time.Now().UTC(),
+	}, "", "    ")
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	if err = os.MkdirAll(keystore.dir, 0700); err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	keyFile, err := os.OpenFile(keystore.path(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, ErrExists.New("%s", name)
+		}
+		return nil, Error.Wrap(err)
+	}
+
+	_, err = keyFile.Write(data)
+	if err = errs.Combine(err, keyFile.Close()); err != nil {
+		return nil, Error.Wrap(errs.Combine(err, os.Remove(keystore.path(name))))
+	}
+
+	return &privateKey.PublicKey, nil
+}
+
+// PublicKey returns public key of the key with the name, password is not needed.
+func (keystore *Keystore) PublicKey(name string) (*ecdsa.PublicKey, error) {
+	keyFile, err := keystore.read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	compressed, err := hex.DecodeString(keyFile.PublicKey)
+	if err != nil {
+		return nil, Error.New("key file %s is corrupted", name)
+	}
+
+	publicKey, err := crypto.DecompressPubkey(compressed)
+	if err != nil {
+		return nil, Error.New("key file %s is corrupted", name)
+	}
+
+	return publicKey, nil
+}
+
+// PrivateKey decrypts the key with the name.
+func (keystore *Keystore) PrivateKey(name, password string) (*ecdsa.PrivateKey, error) {
+	keyFile, err := keystore.read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ethkeystore.DecryptDataV3(keyFile.Crypto, password)
+	if err != nil {
+		if err == ethkeystore.ErrDecrypt {
+			return nil, ErrPassword.New("%s", name)
+		}
+		return nil, Error.Wrap(err)
+	}
+
+	privateKey, err := crypto.ToECDSA(data)
+	if err != nil {
+		return nil, Error.New("key file %s is corrupted", name)
+	}
+
+	return privateKey, nil
+}
+
+// List returns names of all keys sorted alphabetically.
+func (keystore *Keystore) List() ([]string, error) {
+	entries, err := ioutil.ReadDir(keystore.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, Error.Wrap(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), fileExtension)
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileExtension) || !namePattern.MatchString(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// read reads key file with the name.
+func (keystore *Keystore) read(name string) (file, error) {
+	if err := checkName(name); err != nil {
+		return file{}, err
+	}
+
+	data, err := ioutil.ReadFile(keystore.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return file{}, ErrNotFound.New("%s", name)
+		}
+		return file{}, Error.Wrap(err)
+	}
+
+	var keyFile file
+	if err = json.Unmarshal(data, &keyFile); err != nil {
+		return file{}, Error.New("key file %s is corrupted", name)
+	}
+
+	return keyFile, nil
+}
+
+// path returns path to the key file with the name.
+func (keystore *Keystore) path(name string) string {
+	return filepath.Join(keystore.dir, name+fileExtension)
+}
+
+// checkName checks that key name could be used as a file name.
+func checkName(name string) error {
+	if !namePattern.MatchString(name) {
+		return Error.New("key name must be 1 to 64 letters, digits, '-' or '_'")
+	}
+
+	return nil
+}
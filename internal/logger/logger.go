@@ -3,8 +3,70 @@
 
 package logger
 
+import (
+	"context"
+)
+
 // Log exposes functionality to write messages in stdout.
 type Logger interface {
+	// Debug is used to send verbose messages that are useful only for troubleshooting.
+	Debug(msg string, fields ...Field)
+	// Info is used to send messages about regular events, e.g. successful transfers.
+	Info(msg string, fields ...Field)
+	// Warn is used to send messages about unexpected, but recoverable events.
+	Warn(msg string, fields ...Field)
 	// Error is used to send formatted as error message.
-	Error(msg string, err error)
+	Error(msg string, err error, fields ...Field)
+
+	// With creates a child logger which adds fields to every message.
+	With(fields ...Field) Logger
+}
+
+// Field is a key-value pair attached to the log message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Any creates a field with arbitrary value.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// String creates a field with string value.
+func String(key string, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// contextKey is used to store values in context.Context.
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// WithContext returns a copy of ctx which carries the logger.
+func WithContext(ctx context.Context, log Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, log)
+}
+
+// FromContext returns logger carried by ctx, or fallback if there is none.
+func FromContext(ctx context.Context, fallback Logger) Logger {
+	if log, ok := ctx.Value(loggerKey).(Logger); ok {
+		return log
+	}
+
+	return fallback
+}
+
+// WithRequestID returns a copy of ctx which carries the request id.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns request id carried by ctx, or empty string if there is none.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
 }
@@ -4,7 +4,9 @@
 package zaplog
 
 import (
+	"github.com/zeebo/errs"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"paxful/internal/logger"
 )
@@ -12,19 +14,94 @@ import (
 // ensures that zaplog implements logger.Logger.
 var _ logger.Logger = (*zaplog)(nil)
 
+// Error is an error class for logger initialization errors.
+var Error = errs.Class("logger error")
+
+// Config contains configuration for the logger.
+type Config struct {
+	Level  string `json:"level" help:"minimal level of messages to write: debug, info, warn or error" default:"info" validate:"oneof=debug|info|warn|error"`
+	Format string `json:"format" help:"output format: json or console" default:"json" validate:"oneof=json|console"`
+}
+
 // zaplog is an implementation of logger.Logger using zap.
 type zaplog struct {
 	client *zap.Logger
 }
 
-// NewLog is a constructor for a logger.Logger.
+// NewLog is a constructor for a logger.Logger with default configuration.
 func NewLog() logger.Logger {
 	return &zaplog{
 		client: zap.NewExample(),
 	}
 }
 
+// New is a constructor for a logger.Logger which writes messages to stderr
+// with configured level and format.
+func New(config Config) (logger.Logger, error) {
+	level := zap.NewAtomicLevel()
+	if config.Level != "" {
+		if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+			return nil, Error.Wrap(err)
+		}
+	}
+
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Level = level
+	zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	switch config.Format {
+	case "", "json":
+		zapConfig.Encoding = "json"
+	case "console":
+		zapConfig.Encoding = "console"
+	default:
+		return nil, Error.New("unknown log format %q", config.Format)
+	}
+
+	client, err := zapConfig.Build()
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	return &zaplog{client: client}, nil
+}
+
+// NewWithCore is a constructor for a logger.Logger which writes messages to the zap core.
+func NewWithCore(core zapcore.Core) logger.Logger {
+	return &zaplog{client: zap.New(core)}
+}
+
+// Debug is used to send verbose messages that are useful only for troubleshooting.
+func (log zaplog) Debug(msg string, fields ...logger.Field) {
+	log.client.Debug(msg, toZap(fields)...)
+}
+
+// Info is used to send messages about regular events.
+func (log zaplog) Info(msg string, fields ...logger.Field) {
+	log.client.Info(msg, toZap(fields)...)
+}
+
+// Warn is used to send messages about unexpected, but recoverable events.
+func (log zaplog) Warn(msg string, fields ...logger.Field) {
+	log.client.Warn(msg, toZap(fields)...)
+}
+
 // Error is used to send formatted as error message.
-func (log zaplog) Error(msg string, err error) {
-	log.client.Error(msg, zap.Error(err))
+func (log zaplog) Error(msg string, err error, fields ...logger.Field) {
+	log.client.Error(msg, append(toZap(fields), zap.Error(err))...)
+}
+
+// With creates a child logger which adds fields to every message.
+func (log zaplog) With(fields ...logger.Field) logger.Logger {
+	return &zaplog{client: log.client.With(toZap(fields)...)}
+}
+
+// toZap converts logger fields to zap fields.
+func toZap(fields []logger.Field) []zap.Field {
+	zapFields := make([]zap.Field, 0, len(fields)+1)
+	for _, field := range fields {
+		zapFields = append(zapFields, zap.Any(field.Key, field.Value))
+	}
+
+	return zapFields
 }
@@ -0,0 +1,20 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+// Package zaplogtest contains logger helpers for tests.
+package zaplogtest
+
+import (
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"paxful/internal/logger"
+	"paxful/internal/logger/zaplog"
+)
+
+// NewObserver is a constructor for a logger.Logger which keeps messages in memory,
+// so they could be inspected in tests.
+func NewObserver(level zapcore.Level) (logger.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(level)
+	return zaplog.NewWithCore(core), logs
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ensures that memoryStore implements ratelimit.Store.
+var _ Store = (*memoryStore)(nil)
+
+// idleTimeout defines how long unused buckets are kept in memory.
+const idleTimeout = 10 * time.Minute
+
+// memoryStore is an in-memory implementation of ratelimit.Store.
+//
+// architecture: Database
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]Bucket
+	lastSweep time.Time
+}
+
+// NewMemoryStore is a constructor for in-memory ratelimit.Store.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets:   make(map[string]Bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Update atomically loads the bucket by key, applies fn to it and saves the result.
+func (store *memoryStore) Update(ctx context.Context, key string, fn func(bucket Bucket, exists bool) Bucket) (Bucket, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.sweep()
+
+	bucket, exists := store.buckets[key]
+	bucket = fn(bucket, exists)
+	store.buckets[key] = bucket
+
+	return bucket, nil
+}
+
+// sweep removes buckets which were not used for a long time, so memory does not grow unbounded.
+func (store *memoryStore) sweep() {
+	now := time.Now()
+	if now.Sub(store.lastSweep) < idleTimeout {
+		return
+	}
+
+	for key, bucket := range store.buckets {
+		if now.Sub(bucket.UpdatedAt) > idleTimeout {
+			delete(store.buckets, key)
+		}
+	}
+
+	store.lastSweep = now
+}
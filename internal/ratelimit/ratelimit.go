@@ -0,0 +1,107 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// Error is the default rate limiter error class.
+var Error = errs.Class("rate limiter error")
+
+// Config contains configuration for per client rate limiting.
+type Config struct {
+	Enabled bool     `json:"enabled" help:"enables per client rate limiting" default:"true" reload:"true"`
+	APIKeys []string `json:"apiKeys" help:"api keys of clients which are limited by key, other clients are limited by remote ip" secret:"true" reload:"true"`
+	Read    Limit    `json:"read"`
+	Write   Limit    `json:"write"`
+}
+
+// Limit describes token bucket parameters.
+type Limit struct {
+	Rate  float64 `json:"rate" help:"amount of requests per second refilled to the bucket" default:"5" reload:"true"`
+	Burst int     `json:"burst" help:"maximum amount of requests that could be done at once" default:"10" reload:"true"`
+}
+
+// Bucket holds state of a single token bucket.
+type Bucket struct {
+	Tokens    float64   `json:"tokens"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Store exposes functionality to keep token buckets state.
+//
+// architecture: Database
+type Store interface {
+	// Update atomically loads the bucket by key, applies fn to it and saves the result.
+	// exists is false when there is no bucket stored by the key yet.
+	Update(ctx context.Context, key string, fn func(bucket Bucket, exists bool) Bucket) (Bucket, error)
+}
+
+// Limiter is a token bucket rate limiter which keeps its state in the Store.
+//
+// architecture: Service
+type Limiter struct {
+	store  Store
+	limit  Limit
+	prefix string
+
+	// now is used to get current time, could be replaced in tests.
+	now func() time.Time
+}
+
+// NewLimiter is a constructor for a Limiter.
+// prefix is used to separate buckets of different limiters in the same store.
+func NewLimiter(store Store, limit Limit, prefix string) *Limiter {
+	return &Limiter{
+		store:  store,
+		limit:  limit,
+		prefix: prefix,
+		now:    time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of the key.
+// returns false and the time to wait for the next token when the bucket is empty.
+func (limiter *Limiter) Allow(ctx context.Context, key string) (allowed bool, retryAfter time.Duration, err error) {
+	now := limiter.now()
+	burst := float64(limiter.limit.Burst)
+
+	bucket, err := limiter.store.Update(ctx, limiter.prefix+key, func(bucket Bucket, exists bool) Bucket {
+		if !exists {
+			bucket = Bucket{Tokens: burst, UpdatedAt: now}
+		}
+
+		elapsed := now.Sub(bucket.UpdatedAt).Seconds()
+		if elapsed > 0 {
+			bucket.Tokens = math.Min(burst, bucket.Tokens+elapsed*limiter.limit.Rate)
+			bucket.UpdatedAt = now
+		}
+
+		allowed = bucket.Tokens >= 1
+		if allowed {
+			bucket.Tokens--
+		}
+
+		return bucket
+	})
+	if err != nil {
+		return false, 0, Error.Wrap(err)
+	}
+
+	if allowed {
+		return true, 0, nil
+	}
+
+	if limiter.limit.Rate <= 0 {
+		return false, time.Hour, nil
+	}
+
+	wait := (1 - bucket.Tokens) / limiter.limit.Rate
+	return false, time.Duration(wait * float64(time.Second)), nil
+}
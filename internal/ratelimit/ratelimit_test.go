@@ -0,0 +1,113 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// clock is a manually advanced time source for the limiter.
+type clock struct {
+	now time.Time
+}
+
+func (clock *clock) advance(duration time.Duration) {
+	clock.now = clock.now.Add(duration)
+}
+
+func newTestLimiter(limit Limit) (*Limiter, *clock) {
+	fake := &clock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter(NewMemoryStore(), limit, "test:")
+	limiter.now = func() time.Time { return fake.now }
+
+	return limiter, fake
+}
+
+func TestLimiterBurst(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter(Limit{Rate: 1, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := limiter.Allow(ctx, "client")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !allowed {
+			t.Fatalf("request %d within burst is not allowed", i)
+		}
+	}
+
+	allowed, retryAfter, err := limiter.Allow(ctx, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed {
+		t.Fatal("request over burst is allowed")
+	}
+	if retryAfter != time.Second {
+		t.Fatalf("retry after %v, expected %v", retryAfter, time.Second)
+	}
+
+	// buckets are separate per key.
+	allowed, _, err = limiter.Allow(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed {
+		t.Fatal("request of another client is not allowed")
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	ctx := context.Background()
+	limiter, clock := newTestLimiter(Limit{Rate: 2, Burst: 2})
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, err := limiter.Allow(ctx, "client"); err != nil || !allowed {
+			t.Fatalf("request %d within burst: allowed %v, error %v", i, allowed, err)
+		}
+	}
+
+	allowed, retryAfter, err := limiter.Allow(ctx, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed {
+		t.Fatal("request over burst is allowed")
+	}
+	if retryAfter != 500*time.Millisecond {
+		t.Fatalf("retry after %v, expected %v", retryAfter, 500*time.Millisecond)
+	}
+
+	// half of the token is refilled, so request is still rejected.
+	clock.advance(250 * time.Millisecond)
+	allowed, retryAfter, err = limiter.Allow(ctx, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed {
+		t.Fatal("request before refill is allowed")
+	}
+	if retryAfter != 250*time.Millisecond {
+		t.Fatalf("retry after %v, expected %v", retryAfter, 250*time.Millisecond)
+	}
+
+	clock.advance(250 * time.Millisecond)
+	if allowed, _, err := limiter.Allow(ctx, "client"); err != nil || !allowed {
+		t.Fatalf("request after refill: allowed %v, error %v", allowed, err)
+	}
+
+	// refill never exceeds burst.
+	clock.advance(time.Hour)
+	for i := 0; i < 2; i++ {
+		if allowed, _, err := limiter.Allow(ctx, "client"); err != nil || !allowed {
+			t.Fatalf("request %d after long idle: allowed %v, error %v", i, allowed, err)
+		}
+	}
+	if allowed, _, err := limiter.Allow(ctx, "client"); err != nil || allowed {
+		t.Fatalf("request over burst after long idle: allowed %v, error %v", allowed, err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/console"
+)
+
+var (
+	// Error is the default jobs error class.
+	Error = errs.Class("jobs error")
+	// ErrNotFound indicates that job does not exist.
+	ErrNotFound = errs.Class("job not found")
+)
+
+// DB exposes functionality of durable transfer queue.
+//
+// architecture: Database
+type DB interface {
+	// Enqueue stores new job.
+	Enqueue(ctx context.Context, job Job) error
+	// Get returns job by id.
+	Get(ctx context.Context, id string) (Job, error)
+
+	// Claim leases up to limit due queued jobs for the lease duration and increments their attempts,
+	// so concurrent workers never send the same job at once.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]Job, error)
+	// Recover moves jobs whose lease expired while they were processed to unknown status,
+	// since their transfers could be already sent.
+	Recover(ctx context.Context) (int, error)
+	// Finish stores final status of the job.
+	Finish(ctx context.Context, id string, status Status, txID string, lastError string) error
+	// Retry returns job to the queue to be attempted again at nextAttemptAt.
+	// attempt is not counted if countAttempt is false.
+	Retry(ctx context.Context, id string, nextAttemptAt time.Time, countAttempt bool, lastError string) error
+}
+
+// Status indicates state of the job.
+type Status string
+
+const (
+	// StatusQueued indicates that job waits for the worker.
+	StatusQueued Status = "queued"
+	// StatusProcessing indicates that transfer is being sent.
+	StatusProcessing Status = "processing"
+	// StatusSent indicates that transfer was broadcasted.
+	StatusSent Status = "sent"
+	// StatusFailed indicates that transfer was not sent and is not retried anymore.
+	StatusFailed Status = "failed"
+	// StatusUnknown indicates that transfer could be sent, it is not retried and should be checked manually.
+	StatusUnknown Status = "unknown"
+)
+
+// Job is a transfer request which is processed asynchronously.
+type Job struct {
+	ID          string              `json:"id"`
+	Transaction console.Transaction `json:"transaction"`
+	Status      Status              `json:"status"`
+	// Attempts is an amount of started attempts.
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	TxID          string    `json:"txId,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+
+	CreatedBy   string    `json:"createdBy"`
+	RemoteAddr  string    `json:"-"`
+	RequestHash string    `json:"-"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
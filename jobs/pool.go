@@ -0,0 +1,190 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"paxful/audit"
+	"paxful/console"
+	"paxful/internal/logger"
+)
+
+// RetryPolicy defines how failed attempts of the error class are retried.
+type RetryPolicy struct {
+	MaxAttempts    int           `json:"maxAttempts" help:"amount of attempts before job fails, 1 means no retries" validate:"min=0"`
+	InitialBackoff time.Duration `json:"initialBackoff" help:"delay before the first retry, doubled on every next retry"`
+	MaxBackoff     time.Duration `json:"maxBackoff" help:"maximum delay between retries"`
+}
+
+// Config contains configuration for asynchronous transfer processing.
+type Config struct {
+	Workers  int           `json:"workers" help:"amount of transfers sent concurrently" default:"4"`
+	Interval time.Duration `json:"interval" help:"how often idle worker checks the queue" default:"1s"`
+	Lease    time.Duration `json:"lease" help:"how long job is locked by worker while its transfer is sent" default:"5m"`
+
+	// Transient is a policy of node and database errors which happened before transfer was broadcasted.
+	Transient RetryPolicy `json:"transient" default:"maxAttempts=5,initialBackoff=5s,maxBackoff=5m"`
+	// InsufficientFunds is a policy of transfers which hot wallet could not cover, it could be topped up meanwhile.
+	InsufficientFunds RetryPolicy `json:"insufficientFunds" default:"maxAttempts=3,initialBackoff=1m,maxBackoff=30m"`
+	// GasPrice is a policy of transfers rejected because network fee was above the ceiling.
+	GasPrice RetryPolicy `json:"gasPrice" default:"maxAttempts=10,initialBackoff=1m,maxBackoff=15m"`
+}
+
+// Pool is a pool of workers which send queued transfers.
+//
+// Validation errors fail the job immediately, broadcast errors move it to unknown status,
+// since transfer could be already sent, and other error classes are retried according to their policies.
+//
+// architecture: Worker
+type Pool struct {
+	log     logger.Logger
+	config  Config
+	db      DB
+	console *console.Service
+}
+
+// NewPool is a constructor for jobs Pool.
+func NewPool(log logger.Logger, config Config, db DB, console *console.Service) *Pool {
+	return &Pool{
+		log:     log,
+		config:  config,
+		db:      db,
+		console: console,
+	}
+}
+
+// Run runs workers until ctx is done.
+func (pool *Pool) Run(ctx context.Context) error {
+	if _, err := pool.db.Recover(ctx); err != nil {
+		pool.log.Error("could not recover interrupted jobs", err)
+	}
+
+	workers := pool.config.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// work processes jobs one by one, and waits for interval when queue is empty.
+func (pool *Pool) work(ctx context.Context) {
+	interval := pool.config.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	for ctx.Err() == nil {
+		processed, err := pool.ProcessNext(ctx)
+		if err != nil {
+			pool.log.Error("could not process job", err)
+		}
+		if processed && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ProcessNext claims and processes single job, returns false if queue has no due jobs.
+func (pool *Pool) ProcessNext(ctx context.Context) (bool, error) {
+	lease := pool.config.Lease
+	if lease <= 0 {
+		lease = 5 * time.Minute
+	}
+
+	claimed, err := pool.db.Claim(ctx, 1, lease)
+	if err != nil {
+		return false, Error.Wrap(err)
+	}
+	if len(claimed) == 0 {
+		// stale jobs are recovered while queue is idle, so they do not stay in processing forever.
+		_, err = pool.db.Recover(ctx)
+		return false, Error.Wrap(err)
+	}
+
+	return true, pool.process(claimed[0])
+}
+
+// process sends transfer of the job and stores the result.
+func (pool *Pool) process(job Job) error {
+	log := pool.log.With(logger.String("jobID", job.ID), logger.Any("attempt", job.Attempts))
+
+	// transfer is not interrupted by shutdown, console service waits for it while draining.
+	caller := audit.Caller{Identity: job.CreatedBy, RemoteAddr: job.RemoteAddr, RequestHash: job.RequestHash}
+	ctx := audit.WithCaller(logger.WithContext(context.Background(), log), caller)
+
+	tx, err := pool.console.CommitTx(ctx, job.Transaction)
+	if err == nil {
+		log.Info("queued transfer sent", logger.String("txID", tx.ID))
+		return Error.Wrap(pool.db.Finish(ctx, job.ID, StatusSent, tx.ID, ""))
+	}
+
+	switch {
+	case tx.ID != "":
+		// transfer was sent, but not stored, it must never be sent again.
+		return Error.Wrap(pool.db.Finish(ctx, job.ID, StatusSent, tx.ID, err.Error()))
+	case console.UnavailableError.Has(err):
+		// nothing was sent, job is picked up again after restart.
+		return Error.Wrap(pool.db.Retry(ctx, job.ID, time.Now(), false, err.Error()))
+	case console.ValidationError.Has(err):
+		return Error.Wrap(pool.db.Finish(ctx, job.ID, StatusFailed, "", err.Error()))
+	case console.BroadcastError.Has(err):
+		log.Error("queued transfer outcome is unknown", err)
+		return Error.Wrap(pool.db.Finish(ctx, job.ID, StatusUnknown, "", err.Error()))
+	}
+
+	policy := pool.policy(err)
+	if job.Attempts >= policy.MaxAttempts {
+		log.Error("queued transfer failed", err)
+		return Error.Wrap(pool.db.Finish(ctx, job.ID, StatusFailed, "", err.Error()))
+	}
+
+	log.Warn("queued transfer attempt failed, retrying", logger.String("error", err.Error()))
+	next := time.Now().Add(backoff(policy, job.Attempts))
+
+	return Error.Wrap(pool.db.Retry(ctx, job.ID, next, true, err.Error()))
+}
+
+// policy returns retry policy of the error class.
+func (pool *Pool) policy(err error) RetryPolicy {
+	switch {
+	case console.InsufficientFundsError.Has(err):
+		return pool.config.InsufficientFunds
+	case console.GasPriceTooHighError.Has(err):
+		return pool.config.GasPrice
+	default:
+		return pool.config.Transient
+	}
+}
+
+// backoff returns delay after the failed attempt.
+func backoff(policy RetryPolicy, attempts int) time.Duration {
+	delay := policy.InitialBackoff
+	for i := 1; i < attempts && (policy.MaxBackoff <= 0 || delay < policy.MaxBackoff); i++ {
+		delay *= 2
+	}
+	if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+
+	return delay
+}
@@ -0,0 +1,267 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"paxful/audit"
+	"paxful/console"
+	"paxful/internal/cfgstruct"
+	"paxful/internal/logger/zaplog/zaplogtest"
+	"paxful/jobs"
+	"paxful/payments"
+)
+
+func TestPoolRetriesTransientFailure(t *testing.T) {
+	ctx := context.Background()
+
+	var config jobs.Config
+	if err := cfgstruct.Load(&config, "", true, nil, "PAXFUL_TEST_"); err != nil {
+		t.Fatal(err)
+	}
+	if config.Transient.MaxAttempts <= 1 {
+		t.Fatalf("transient failures are not retried by default, max attempts %d", config.Transient.MaxAttempts)
+	}
+
+	eth := &flakyTransactions{failures: 1}
+	log, _ := zaplogtest.NewObserver(zapcore.InfoLevel)
+	service := console.NewService(log, console.Config{}, payments.NewPaymentProvider(eth, eth), &memoryTransactionsDB{},
+		audit.NewService(&memoryAuditDB{}), console.NewEventBus())
+
+	db := newMemoryJobsDB()
+	err := db.Enqueue(ctx, jobs.Job{
+		ID:            "job",
+		Transaction:   console.Transaction{Currency: "eth", Amount: 1, To: "receiver"},
+		Status:        jobs.StatusQueued,
+		NextAttemptAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := jobs.NewPool(log, config, db, service)
+
+	start := time.Now()
+	processed, err := pool.ProcessNext(ctx)
+	if err != nil || !processed {
+		t.Fatalf("first attempt: processed %v, error %v", processed, err)
+	}
+
+	job, err := db.Get(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != jobs.StatusQueued || job.Attempts != 1 {
+		t.Fatalf("job after transient failure: status %q, attempts %d", job.Status, job.Attempts)
+	}
+	if delay := job.NextAttemptAt.Sub(start); delay < config.Transient.InitialBackoff {
+		t.Fatalf("retry is scheduled after %v, expected at least %v", delay, config.Transient.InitialBackoff)
+	}
+
+	// retry is not due until backoff passes.
+	processed, err = pool.ProcessNext(ctx)
+	if err != nil || processed {
+		t.Fatalf("attempt before backoff: processed %v, error %v", processed, err)
+	}
+
+	db.due("job")
+	processed, err = pool.ProcessNext(ctx)
+	if err != nil || !processed {
+		t.Fatalf("second attempt: processed %v, error %v", processed, err)
+	}
+
+	job, err = db.Get(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != jobs.StatusSent || job.TxID != "sent" || job.Attempts != 2 {
+		t.Fatalf("job after retry: status %q, txID %q, attempts %d", job.Status, job.TxID, job.Attempts)
+	}
+}
+
+// flakyTransactions fails the amount of first commits with node error, which is not broadcast one.
+type flakyTransactions struct {
+	mu       sync.Mutex
+	failures int
+}
+
+func (transactions *flakyTransactions) Commit(ctx context.Context, tx payments.Transaction) (payments.Transaction, error) {
+	transactions.mu.Lock()
+	defer transactions.mu.Unlock()
+
+	if transactions.failures > 0 {
+		transactions.failures--
+		return payments.Transaction{}, errors.New("connection refused")
+	}
+
+	tx.ID = "sent"
+	return tx, nil
+}
+
+func (transactions *flakyTransactions) Ping(ctx context.Context) error { return nil }
+
+func (transactions *flakyTransactions) Balance(ctx context.Context) (float64, error) { return 0, nil }
+
+func (transactions *flakyTransactions) AddressBalance(ctx context.Context, address string) (float64, error) {
+	return 0, nil
+}
+
+func (transactions *flakyTransactions) Status(ctx context.Context, id string) (payments.Receipt, error) {
+	return payments.Receipt{}, nil
+}
+
+func (transactions *flakyTransactions) ValidateAddress(address string) error { return nil }
+
+func (transactions *flakyTransactions) Network() payments.NetworkConfig {
+	return payments.NetworkConfig{Name: "test"}
+}
+
+func (transactions *flakyTransactions) VerifyNetwork(ctx context.Context) error { return nil }
+
+// memoryTransactionsDB accepts sent transactions without storing them.
+type memoryTransactionsDB struct{}
+
+func (db *memoryTransactionsDB) Commit(ctx context.Context, tx payments.Transaction) (payments.Event, error) {
+	return payments.Event{}, nil
+}
+
+func (db *memoryTransactionsDB) List(ctx context.Context) ([]payments.Transaction, error) {
+	return nil, nil
+}
+
+func (db *memoryTransactionsDB) ListByStatus(ctx context.Context, status payments.TransactionStatus) ([]payments.Transaction, error) {
+	return nil, nil
+}
+
+func (db *memoryTransactionsDB) Find(ctx context.Context, filter payments.TransactionFilter) ([]payments.Transaction, error) {
+	return nil, nil
+}
+
+func (db *memoryTransactionsDB) Get(ctx context.Context, id string) ([]payments.Transaction, error) {
+	return nil, payments.ErrTransactionNotFound.New("%s", id)
+}
+
+func (db *memoryTransactionsDB) UpdateStatus(ctx context.Context, id string, outputIndex int, receipt payments.Receipt) (payments.Event, error) {
+	return payments.Event{}, nil
+}
+
+func (db *memoryTransactionsDB) MarkMined(ctx context.Context, id string, gasUsed uint64) error {
+	return nil
+}
+
+func (db *memoryTransactionsDB) Events(ctx context.Context, afterID int64, limit int) ([]payments.Event, error) {
+	return nil, nil
+}
+
+// memoryAuditDB keeps audit entries in memory.
+type memoryAuditDB struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (db *memoryAuditDB) Append(ctx context.Context, entry audit.Entry) (audit.Entry, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.entries = append(db.entries, entry)
+	return entry, nil
+}
+
+func (db *memoryAuditDB) List(ctx context.Context) ([]audit.Entry, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return append([]audit.Entry{}, db.entries...), nil
+}
+
+// memoryJobsDB is an in-memory transfer queue.
+type memoryJobsDB struct {
+	mu   sync.Mutex
+	jobs map[string]*jobs.Job
+}
+
+func newMemoryJobsDB() *memoryJobsDB {
+	return &memoryJobsDB{jobs: make(map[string]*jobs.Job)}
+}
+
+// due makes the job due now.
+func (db *memoryJobsDB) due(id string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.jobs[id].NextAttemptAt = time.Now()
+}
+
+func (db *memoryJobsDB) Enqueue(ctx context.Context, job jobs.Job) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.jobs[job.ID] = &job
+	return nil
+}
+
+func (db *memoryJobsDB) Get(ctx context.Context, id string) (jobs.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	job, ok := db.jobs[id]
+	if !ok {
+		return jobs.Job{}, jobs.ErrNotFound.New("%s", id)
+	}
+	return *job, nil
+}
+
+func (db *memoryJobsDB) Claim(ctx context.Context, limit int, lease time.Duration) ([]jobs.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var claimed []jobs.Job
+	for _, job := range db.jobs {
+		if len(claimed) >= limit {
+			break
+		}
+		if job.Status != jobs.StatusQueued || job.NextAttemptAt.After(time.Now()) {
+			continue
+		}
+
+		job.Status = jobs.StatusProcessing
+		job.Attempts++
+		job.NextAttemptAt = time.Now().Add(lease)
+		claimed = append(claimed, *job)
+	}
+
+	return claimed, nil
+}
+
+func (db *memoryJobsDB) Recover(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (db *memoryJobsDB) Finish(ctx context.Context, id string, status jobs.Status, txID string, lastError string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	job := db.jobs[id]
+	job.Status, job.TxID, job.LastError = status, txID, lastError
+	return nil
+}
+
+func (db *memoryJobsDB) Retry(ctx context.Context, id string, nextAttemptAt time.Time, countAttempt bool, lastError string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	job := db.jobs[id]
+	job.Status, job.NextAttemptAt, job.LastError = jobs.StatusQueued, nextAttemptAt, lastError
+	if !countAttempt {
+		job.Attempts--
+	}
+	return nil
+}
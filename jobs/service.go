@@ -0,0 +1,84 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"paxful/audit"
+	"paxful/console"
+)
+
+// Service exposes functionality to enqueue transfers and check their progress.
+//
+// architecture: Service
+type Service struct {
+	db      DB
+	console *console.Service
+}
+
+// NewService is a constructor for jobs Service.
+func NewService(db DB, console *console.Service) *Service {
+	return &Service{
+		db:      db,
+		console: console,
+	}
+}
+
+// Enqueue validates transfer and stores it to be sent by worker pool.
+// caller taken from ctx is used to record transfer attempts to the audit log.
+func (service *Service) Enqueue(ctx context.Context, transaction console.Transaction) (Job, error) {
+	if err := service.console.Validate(ctx, transaction); err != nil {
+		return Job{}, err
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return Job{}, Error.Wrap(err)
+	}
+
+	caller := audit.CallerFromContext(ctx)
+	now := time.Now().UTC()
+
+	job := Job{
+		ID:            id,
+		Transaction:   transaction,
+		Status:        StatusQueued,
+		NextAttemptAt: now,
+		CreatedBy:     caller.Identity,
+		RemoteAddr:    caller.RemoteAddr,
+		RequestHash:   caller.RequestHash,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if err = service.db.Enqueue(ctx, job); err != nil {
+		return Job{}, Error.Wrap(err)
+	}
+
+	return job, nil
+}
+
+// Get returns job with its current status.
+func (service *Service) Get(ctx context.Context, id string) (Job, error) {
+	job, err := service.db.Get(ctx, id)
+	if ErrNotFound.Has(err) {
+		return Job{}, err
+	}
+
+	return job, Error.Wrap(err)
+}
+
+// randomHex returns hex encoded random bytes.
+func randomHex(size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paxfuldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/audit"
+)
+
+// ensures that auditLog implements audit.DB.
+var _ audit.DB = (*auditLog)(nil)
+
+// AuditDBError is the error class that indicates about audit DB error.
+var AuditDBError = errs.Class("AuditDB error")
+
+// auditLog is a postgres implementation of audit.DB.
+//
+// architecture: Database
+type auditLog struct {
+	db      *sql.DB
+	metrics *metrics
+}
+
+// Append links entry to the last one in the log, computes its hash and stores it.
+// table is locked for writes, so concurrent appends are serialized and chain is never forked.
+func (auditLog *auditLog) Append(ctx context.Context, entry audit.Entry) (_ audit.Entry, err error) {
+	defer func(start time.Time) { auditLog.metrics.observe("audit_append", start, err) }(time.Now())
+
+	err = withTx(ctx, auditLog.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `LOCK TABLE audit_log IN SHARE ROW EXCLUSIVE MODE;`)
+		if err != nil {
+			return err
+		}
+
+		var lastID int64
+		var lastHash string
+		err = tx.QueryRowContext(ctx, `SELECT id, hash FROM audit_log ORDER BY id DESC LIMIT 1;`).Scan(&lastID, &lastHash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		entry.ID = lastID + 1
+		entry.PrevHash = lastHash
+		// postgres keeps timestamps with microsecond precision.
+		entry.CreatedAt = entry.CreatedAt.UTC().Truncate(time.Microsecond)
+		entry.Hash = entry.ComputeHash()
+
+		statement := `INSERT INTO audit_log (id, action, actor, remote_addr, request_hash, outcome, error_class, details, created_at, prev_hash, hash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`
+
+		_, err = tx.ExecContext(ctx, statement, entry.ID, entry.Action, entry.Actor, entry.RemoteAddr, entry.RequestHash,
+			entry.Outcome, entry.ErrorClass, entry.Details, entry.CreatedAt, entry.PrevHash, entry.Hash)
+		return err
+	})
+	if err != nil {
+		return audit.Entry{}, AuditDBError.Wrap(err)
+	}
+
+	return entry, nil
+}
+
+// List returns all entries ordered by id.
+func (auditLog *auditLog) List(ctx context.Context) (_ []audit.Entry, err error) {
+	defer func(start time.Time) { auditLog.metrics.observe("audit_list", start, err) }(time.Now())
+
+	statement := `SELECT id, action, actor, remote_addr, request_hash, outcome, error_class, details, created_at, prev_hash, hash
+		FROM audit_log ORDER BY id;`
+
+	rows, err := auditLog.db.QueryContext(ctx, statement)
+	if err != nil {
+		return nil, AuditDBError.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	var entries []audit.Entry
+	for rows.Next() {
+		var entry audit.Entry
+
+		err = rows.Scan(&entry.ID, &entry.Action, &entry.Actor, &entry.RemoteAddr, &entry.RequestHash, &entry.Outcome,
+			&entry.ErrorClass, &entry.Details, &entry.CreatedAt, &entry.PrevHash, &entry.Hash)
+		if err != nil {
+			return nil, AuditDBError.Wrap(err)
+		}
+
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, AuditDBError.Wrap(err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,200 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paxfuldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/batches"
+)
+
+// ensures that batchesDB implements batches.DB.
+var _ batches.DB = (*batchesDB)(nil)
+
+// BatchesDBError is the error class that indicates about batches DB error.
+var BatchesDBError = errs.Class("BatchesDB error")
+
+// batchesDB is a postgres implementation of batches.DB.
+//
+// architecture: Database
+type batchesDB struct {
+	db      *sql.DB
+	metrics *metrics
+}
+
+// Create stores new batch with all its items.
+func (batchesDB *batchesDB) Create(ctx context.Context, batch batches.Batch) (err error) {
+	defer func(start time.Time) { batchesDB.metrics.observe("batches_create", start, err) }(time.Now())
+
+	err = withTx(ctx, batchesDB.db, func(tx *sql.Tx) (err error) {
+		statement := `INSERT INTO batches (id, status, created_by, remote_addr, created_at) VALUES ($1, $2, $3, $4, $5);`
+		_, err = tx.ExecContext(ctx, statement, batch.ID, batch.Status, batch.CreatedBy, batch.RemoteAddr, batch.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		insert, err := tx.PrepareContext(ctx, `
+			INSERT INTO batch_items (batch_id, idx, currency, amount, to_address, urgency, status, updated_at, network)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`)
+		if err != nil {
+			return err
+		}
+		defer func() { err = errs.Combine(err, insert.Close()) }()
+
+		for _, item := range batch.Items {
+			_, err = insert.ExecContext(ctx, batch.ID, item.Index, item.Transaction.Currency, item.Transaction.Amount,
+				item.Transaction.To, item.Transaction.Urgency, item.Status, item.UpdatedAt, item.Transaction.Network)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return BatchesDBError.Wrap(err)
+}
+
+// Get returns batch with all its items ordered by index.
+func (batchesDB *batchesDB) Get(ctx context.Context, id string) (_ batches.Batch, err error) {
+	defer func(start time.Time) { batchesDB.metrics.observe("batches_get", start, err) }(time.Now())
+
+	statement := `SELECT id, status, created_by, remote_addr, created_at, completed_at FROM batches WHERE id = $1;`
+	batch, err := scanBatch(batchesDB.db.QueryRowContext(ctx, statement, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return batches.Batch{}, batches.ErrNotFound.New("%s", id)
+		}
+		return batches.Batch{}, BatchesDBError.Wrap(err)
+	}
+
+	batch.Items, err = batchesDB.items(ctx, id)
+	if err != nil {
+		return batches.Batch{}, BatchesDBError.Wrap(err)
+	}
+
+	return batch, nil
+}
+
+// Claim leases the oldest unfinished batch for the lease duration, so concurrent processors
+// never process the same batch at once. returns ErrNotFound if there is nothing to process.
+func (batchesDB *batchesDB) Claim(ctx context.Context, lease time.Duration) (_ batches.Batch, err error) {
+	defer func(start time.Time) { batchesDB.metrics.observe("batches_claim", start, err) }(time.Now())
+
+	statement := `
+		WITH next AS (
+			SELECT id FROM batches
+			WHERE status IN ($1, $2) AND (lease_until IS NULL OR lease_until <= now())
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE batches SET status = $2, lease_until = now() + make_interval(secs => $3)
+		FROM next
+		WHERE batches.id = next.id
+		RETURNING batches.id, batches.status, batches.created_by, batches.remote_addr, batches.created_at, batches.completed_at;`
+
+	batch, err := scanBatch(batchesDB.db.QueryRowContext(ctx, statement, batches.StatusPending, batches.StatusProcessing, lease.Seconds()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return batches.Batch{}, batches.ErrNotFound.New("no pending batches")
+		}
+		return batches.Batch{}, BatchesDBError.Wrap(err)
+	}
+
+	batch.Items, err = batchesDB.items(ctx, batch.ID)
+	if err != nil {
+		return batches.Batch{}, BatchesDBError.Wrap(err)
+	}
+
+	return batch, nil
+}
+
+// Extend prolongs lease of the batch which is being processed.
+func (batchesDB *batchesDB) Extend(ctx context.Context, id string, lease time.Duration) (err error) {
+	defer func(start time.Time) { batchesDB.metrics.observe("batches_extend", start, err) }(time.Now())
+
+	statement := `UPDATE batches SET lease_until = now() + make_interval(secs => $1) WHERE id = $2;`
+	_, err = batchesDB.db.ExecContext(ctx, statement, lease.Seconds(), id)
+
+	return BatchesDBError.Wrap(err)
+}
+
+// UpdateItem stores status, transaction id and error of the batch item.
+func (batchesDB *batchesDB) UpdateItem(ctx context.Context, batchID string, item batches.Item) (err error) {
+	defer func(start time.Time) { batchesDB.metrics.observe("batches_update_item", start, err) }(time.Now())
+
+	statement := `UPDATE batch_items SET status = $1, tx_id = $2, error = $3, updated_at = $4 WHERE batch_id = $5 AND idx = $6;`
+	_, err = batchesDB.db.ExecContext(ctx, statement, item.Status, item.TxID, item.Error, item.UpdatedAt, batchID, item.Index)
+
+	return BatchesDBError.Wrap(err)
+}
+
+// Finish sets final status of the batch and releases its lease.
+func (batchesDB *batchesDB) Finish(ctx context.Context, id string, status batches.Status) (err error) {
+	defer func(start time.Time) { batchesDB.metrics.observe("batches_finish", start, err) }(time.Now())
+
+	statement := `UPDATE batches SET status = $1, completed_at = now(), lease_until = NULL WHERE id = $2;`
+	_, err = batchesDB.db.ExecContext(ctx, statement, status, id)
+
+	return BatchesDBError.Wrap(err)
+}
+
+// Release releases lease of unfinished batch, so it is processed again later.
+func (batchesDB *batchesDB) Release(ctx context.Context, id string) (err error) {
+	defer func(start time.Time) { batchesDB.metrics.observe("batches_release", start, err) }(time.Now())
+
+	_, err = batchesDB.db.ExecContext(ctx, `UPDATE batches SET lease_until = NULL WHERE id = $1;`, id)
+
+	return BatchesDBError.Wrap(err)
+}
+
+// items returns items of the batch ordered by index.
+func (batchesDB *batchesDB) items(ctx context.Context, batchID string) (_ []batches.Item, err error) {
+	statement := `
+		SELECT idx, currency, amount, to_address, urgency, status, tx_id, error, updated_at, network
+		FROM batch_items WHERE batch_id = $1 ORDER BY idx;`
+
+	rows, err := batchesDB.db.QueryContext(ctx, statement, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	var items []batches.Item
+	for rows.Next() {
+		var item batches.Item
+
+		err = rows.Scan(&item.Index, &item.Transaction.Currency, &item.Transaction.Amount, &item.Transaction.To,
+			&item.Transaction.Urgency, &item.Status, &item.TxID, &item.Error, &item.UpdatedAt, &item.Transaction.Network)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// scanBatch reads batch without items from the row.
+func scanBatch(row scanner) (batches.Batch, error) {
+	var batch batches.Batch
+	var completedAt sql.NullTime
+
+	err := row.Scan(&batch.ID, &batch.Status, &batch.CreatedBy, &batch.RemoteAddr, &batch.CreatedAt, &completedAt)
+	if err != nil {
+		return batches.Batch{}, err
+	}
+	if completedAt.Valid {
+		batch.CompletedAt = &completedAt.Time
+	}
+
+	return batch, nil
+}
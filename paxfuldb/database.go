@@ -4,13 +4,20 @@
 package paxfuldb
 
 import (
+	"context"
 	"database/sql"
 
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/zeebo/errs"
 
 	"paxful"
+	"paxful/audit"
+	"paxful/batches"
+	"paxful/jobs"
 	"paxful/payments"
+	"paxful/schedules"
+	"paxful/webhooks"
 )
 
 // ensures that database implements paxful.DB.
@@ -26,7 +33,8 @@ var (
 //
 // architecture: Master Database
 type database struct {
-	db *sql.DB
+	db      *sql.DB
+	metrics *metrics
 }
 
 // NewDatabase returns paxful.DB postgresql implementation.
@@ -36,16 +44,67 @@ func NewDatabase(databaseURL string) (paxful.DB, error) {
 		return nil, Error.Wrap(err)
 	}
 
-	return &database{db: conn}, nil
+	return &database{db: conn, metrics: newMetrics()}, nil
 }
 
 // Transactions provides access to Transactions store.
 func (db *database) Transactions() payments.TransactionsDB {
 	return &transactions{
-		db: db.db,
+		db:      db.db,
+		metrics: db.metrics,
 	}
 }
 
+// Audit provides access to append-only audit log.
+func (db *database) Audit() audit.DB {
+	return &auditLog{
+		db:      db.db,
+		metrics: db.metrics,
+	}
+}
+
+// Webhooks provides access to webhook subscriptions and deliveries.
+func (db *database) Webhooks() webhooks.DB {
+	return &webhooksDB{
+		db:      db.db,
+		metrics: db.metrics,
+	}
+}
+
+// Batches provides access to batch payouts.
+func (db *database) Batches() batches.DB {
+	return &batchesDB{
+		db:      db.db,
+		metrics: db.metrics,
+	}
+}
+
+// Schedules provides access to scheduled transfers.
+func (db *database) Schedules() schedules.DB {
+	return &schedulesDB{
+		db:      db.db,
+		metrics: db.metrics,
+	}
+}
+
+// Jobs provides access to durable transfer queue.
+func (db *database) Jobs() jobs.DB {
+	return &jobsDB{
+		db:      db.db,
+		metrics: db.metrics,
+	}
+}
+
+// Ping verifies a connection to the database is still alive.
+func (db *database) Ping(ctx context.Context) error {
+	return Error.Wrap(db.db.PingContext(ctx))
+}
+
+// Metrics returns collector of database queries metrics.
+func (db *database) Metrics() prometheus.Collector {
+	return db.metrics.queryDuration
+}
+
 // Close closes underlying db connection.
 func (db *database) Close() error {
 	return Error.Wrap(db.db.Close())
@@ -0,0 +1,154 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paxfuldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/jobs"
+)
+
+// ensures that jobsDB implements jobs.DB.
+var _ jobs.DB = (*jobsDB)(nil)
+
+// JobsDBError is the error class that indicates about jobs DB error.
+var JobsDBError = errs.Class("JobsDB error")
+
+// jobColumns is a list of columns that are scanned by scanJob.
+const jobColumns = `id, currency, amount, to_address, urgency, status, attempts, next_attempt_at, tx_id, last_error,
+	created_by, remote_addr, request_hash, created_at, updated_at, network`
+
+// jobsDB is a postgres implementation of jobs.DB.
+//
+// architecture: Database
+type jobsDB struct {
+	db      *sql.DB
+	metrics *metrics
+}
+
+// Enqueue stores new job.
+func (jobsDB *jobsDB) Enqueue(ctx context.Context, job jobs.Job) (err error) {
+	defer func(start time.Time) { jobsDB.metrics.observe("jobs_enqueue", start, err) }(time.Now())
+
+	statement := `INSERT INTO jobs (` + jobColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16);`
+	_, err = jobsDB.db.ExecContext(ctx, statement, job.ID, job.Transaction.Currency, job.Transaction.Amount, job.Transaction.To,
+		job.Transaction.Urgency, job.Status, job.Attempts, job.NextAttemptAt, job.TxID, job.LastError,
+		job.CreatedBy, job.RemoteAddr, job.RequestHash, job.CreatedAt, job.UpdatedAt, job.Transaction.Network)
+
+	return JobsDBError.Wrap(err)
+}
+
+// Get returns job by id.
+func (jobsDB *jobsDB) Get(ctx context.Context, id string) (_ jobs.Job, err error) {
+	defer func(start time.Time) { jobsDB.metrics.observe("jobs_get", start, err) }(time.Now())
+
+	job, err := scanJob(jobsDB.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1;`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return jobs.Job{}, jobs.ErrNotFound.New("%s", id)
+		}
+		return jobs.Job{}, JobsDBError.Wrap(err)
+	}
+
+	return job, nil
+}
+
+// Claim leases up to limit due queued jobs for the lease duration and increments their attempts,
+// so concurrent workers never send the same job at once.
+func (jobsDB *jobsDB) Claim(ctx context.Context, limit int, lease time.Duration) (_ []jobs.Job, err error) {
+	defer func(start time.Time) { jobsDB.metrics.observe("jobs_claim", start, err) }(time.Now())
+
+	statement := `
+		WITH due AS (
+			SELECT id FROM jobs
+			WHERE status = $1 AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE jobs SET status = $3, attempts = attempts + 1, lease_until = now() + make_interval(secs => $4), updated_at = now()
+		FROM due
+		WHERE jobs.id = due.id
+		RETURNING ` + qualify("jobs", jobColumns) + `;`
+
+	rows, err := jobsDB.db.QueryContext(ctx, statement, jobs.StatusQueued, limit, jobs.StatusProcessing, lease.Seconds())
+	if err != nil {
+		return nil, JobsDBError.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	var claimed []jobs.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, JobsDBError.Wrap(err)
+		}
+
+		claimed = append(claimed, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, JobsDBError.Wrap(err)
+	}
+
+	return claimed, nil
+}
+
+// Recover moves jobs whose lease expired while they were processed to unknown status,
+// since their transfers could be already sent.
+func (jobsDB *jobsDB) Recover(ctx context.Context) (_ int, err error) {
+	defer func(start time.Time) { jobsDB.metrics.observe("jobs_recover", start, err) }(time.Now())
+
+	statement := `
+		UPDATE jobs SET status = $1, last_error = $2, lease_until = NULL, updated_at = now()
+		WHERE status = $3 AND lease_until <= now();`
+
+	result, err := jobsDB.db.ExecContext(ctx, statement, jobs.StatusUnknown,
+		"worker was stopped while transfer was sent, outcome is unknown", jobs.StatusProcessing)
+	if err != nil {
+		return 0, JobsDBError.Wrap(err)
+	}
+
+	recovered, err := result.RowsAffected()
+	return int(recovered), JobsDBError.Wrap(err)
+}
+
+// Finish stores final status of the job.
+func (jobsDB *jobsDB) Finish(ctx context.Context, id string, status jobs.Status, txID string, lastError string) (err error) {
+	defer func(start time.Time) { jobsDB.metrics.observe("jobs_finish", start, err) }(time.Now())
+
+	statement := `UPDATE jobs SET status = $1, tx_id = $2, last_error = $3, lease_until = NULL, updated_at = now() WHERE id = $4;`
+	_, err = jobsDB.db.ExecContext(ctx, statement, status, txID, lastError, id)
+
+	return JobsDBError.Wrap(err)
+}
+
+// Retry returns job to the queue to be attempted again at nextAttemptAt.
+// attempt is not counted if countAttempt is false.
+func (jobsDB *jobsDB) Retry(ctx context.Context, id string, nextAttemptAt time.Time, countAttempt bool, lastError string) (err error) {
+	defer func(start time.Time) { jobsDB.metrics.observe("jobs_retry", start, err) }(time.Now())
+
+	statement := `
+		UPDATE jobs SET status = $1, next_attempt_at = $2, last_error = $3, lease_until = NULL, updated_at = now(),
+			attempts = CASE WHEN $4 THEN attempts ELSE attempts - 1 END
+		WHERE id = $5;`
+	_, err = jobsDB.db.ExecContext(ctx, statement, jobs.StatusQueued, nextAttemptAt, lastError, countAttempt, id)
+
+	return JobsDBError.Wrap(err)
+}
+
+// scanJob scans job selected with jobColumns.
+func scanJob(row scanner) (jobs.Job, error) {
+	var job jobs.Job
+
+	err := row.Scan(&job.ID, &job.Transaction.Currency, &job.Transaction.Amount, &job.Transaction.To, &job.Transaction.Urgency,
+		&job.Status, &job.Attempts, &job.NextAttemptAt, &job.TxID, &job.LastError,
+		&job.CreatedBy, &job.RemoteAddr, &job.RequestHash, &job.CreatedAt, &job.UpdatedAt, &job.Transaction.Network)
+
+	return job, err
+}
@@ -0,0 +1,38 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paxfuldb
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics holds database queries instrumentation.
+type metrics struct {
+	queryDuration *prometheus.HistogramVec
+}
+
+// newMetrics is a constructor for database metrics.
+func newMetrics() *metrics {
+	return &metrics{
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "paxful",
+			Subsystem: "db",
+			Name:      "query_duration_seconds",
+			Help:      "Latency of database queries.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"query", "status"}),
+	}
+}
+
+// observe records latency of the query started at start.
+func (m *metrics) observe(query string, start time.Time, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+
+	m.queryDuration.WithLabelValues(query, status).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,330 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paxfuldb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/zeebo/errs"
+)
+
+// MigrationError is the error class that indicates about migration error.
+var MigrationError = errs.Class("migration error")
+
+// migration is a single versioned change of database schema.
+type migration struct {
+	version     int
+	description string
+	query       string
+}
+
+// migrations is an ordered list of all schema changes, new migrations must be appended to the end.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create transactions table",
+		query: `
+			CREATE TABLE IF NOT EXISTS transactions (
+				id            TEXT   NOT NULL,
+				currency      TEXT   NOT NULL,
+				amount        bigint NOT NULL,
+				fee           bigint NOT NULL,
+				fromAddress   TEXT   NOT NULL,
+				toAddress     TEXT   NOT NULL,
+				created_at    timestamp with time zone NOT NULL
+			);`,
+	},
+	{
+		version:     2,
+		description: "create append-only audit log table",
+		query: `
+			CREATE TABLE audit_log (
+				id            bigint PRIMARY KEY NOT NULL,
+				action        TEXT   NOT NULL,
+				actor         TEXT   NOT NULL,
+				remote_addr   TEXT   NOT NULL,
+				request_hash  TEXT   NOT NULL,
+				outcome       TEXT   NOT NULL,
+				error_class   TEXT   NOT NULL,
+				details       TEXT   NOT NULL,
+				created_at    timestamp with time zone NOT NULL,
+				prev_hash     TEXT   NOT NULL,
+				hash          TEXT   NOT NULL
+			);
+
+			CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'audit_log is append-only';
+			END;
+			$$ LANGUAGE plpgsql;
+
+			CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+				FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();`,
+	},
+	{
+		version:     3,
+		description: "add transaction status, outbox and webhooks tables",
+		query: `
+			ALTER TABLE transactions ADD COLUMN status integer NOT NULL DEFAULT 0;
+			ALTER TABLE transactions ADD PRIMARY KEY (id);
+			CREATE INDEX transactions_status_index ON transactions (status);
+
+			CREATE TABLE outbox_events (
+				id              bigserial PRIMARY KEY NOT NULL,
+				type            TEXT   NOT NULL,
+				transaction_id  TEXT   NOT NULL,
+				payload         bytea  NOT NULL,
+				created_at      timestamp with time zone NOT NULL
+			);
+
+			CREATE TABLE webhook_subscriptions (
+				id          TEXT   PRIMARY KEY NOT NULL,
+				url         TEXT   NOT NULL,
+				events      TEXT[] NOT NULL,
+				secret      TEXT   NOT NULL,
+				created_at  timestamp with time zone NOT NULL
+			);
+
+			CREATE TABLE webhook_deliveries (
+				id               bigserial PRIMARY KEY NOT NULL,
+				event_id         bigint  NOT NULL REFERENCES outbox_events (id),
+				subscription_id  TEXT    NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+				status           TEXT    NOT NULL,
+				attempts         integer NOT NULL,
+				next_attempt_at  timestamp with time zone NOT NULL,
+				last_error       TEXT    NOT NULL DEFAULT '',
+				created_at       timestamp with time zone NOT NULL,
+				updated_at       timestamp with time zone NOT NULL DEFAULT now()
+			);
+			CREATE INDEX webhook_deliveries_due_index ON webhook_deliveries (status, next_attempt_at);`,
+	},
+	{
+		version:     4,
+		description: "add estimated, limit and used gas to transactions",
+		query: `
+			ALTER TABLE transactions ADD COLUMN gas_estimated bigint NOT NULL DEFAULT 0;
+			ALTER TABLE transactions ADD COLUMN gas_limit bigint NOT NULL DEFAULT 0;
+			ALTER TABLE transactions ADD COLUMN gas_used bigint NOT NULL DEFAULT 0;`,
+	},
+	{
+		version:     5,
+		description: "add batch payouts",
+		query: `
+			CREATE TABLE batches (
+				id           TEXT    PRIMARY KEY NOT NULL,
+				status       TEXT    NOT NULL,
+				created_by   TEXT    NOT NULL,
+				remote_addr  TEXT    NOT NULL,
+				created_at   timestamp with time zone NOT NULL,
+				completed_at timestamp with time zone,
+				lease_until  timestamp with time zone
+			);
+			CREATE INDEX batches_status_index ON batches (status, created_at);
+			CREATE TABLE batch_items (
+				batch_id    TEXT    NOT NULL REFERENCES batches(id) ON DELETE CASCADE,
+				idx         integer NOT NULL,
+				currency    TEXT    NOT NULL,
+				amount      double precision NOT NULL,
+				to_address  TEXT    NOT NULL,
+				urgency     TEXT    NOT NULL,
+				status      TEXT    NOT NULL,
+				tx_id       TEXT    NOT NULL DEFAULT '',
+				error       TEXT    NOT NULL DEFAULT '',
+				updated_at  timestamp with time zone NOT NULL,
+				PRIMARY KEY (batch_id, idx)
+			);`,
+	},
+	{
+		version:     6,
+		description: "add output index to transactions",
+		query: `
+			ALTER TABLE transactions ADD COLUMN output_index integer NOT NULL DEFAULT 0;
+			ALTER TABLE transactions DROP CONSTRAINT transactions_pkey;
+			ALTER TABLE transactions ADD PRIMARY KEY (id, output_index);`,
+	},
+	{
+		version:     7,
+		description: "add scheduled transfers",
+		query: `
+			CREATE TABLE schedules (
+				id               TEXT    PRIMARY KEY NOT NULL,
+				currency         TEXT    NOT NULL,
+				amount           double precision NOT NULL,
+				to_address       TEXT    NOT NULL,
+				urgency          TEXT    NOT NULL,
+				execute_at       timestamp with time zone NOT NULL,
+				recurrence_every TEXT    NOT NULL,
+				interval_ns      bigint  NOT NULL,
+				count            integer NOT NULL,
+				status           TEXT    NOT NULL,
+				next_run_at      timestamp with time zone NOT NULL,
+				runs             integer NOT NULL DEFAULT 0,
+				last_tx_id       TEXT    NOT NULL DEFAULT '',
+				last_error       TEXT    NOT NULL DEFAULT '',
+				created_by       TEXT    NOT NULL,
+				remote_addr      TEXT    NOT NULL,
+				created_at       timestamp with time zone NOT NULL,
+				lease_until      timestamp with time zone
+			);
+			CREATE INDEX schedules_due_index ON schedules (status, next_run_at);
+			CREATE TABLE schedule_executions (
+				schedule_id TEXT    NOT NULL REFERENCES schedules(id) ON DELETE CASCADE,
+				run         integer NOT NULL,
+				status      TEXT    NOT NULL,
+				tx_id       TEXT    NOT NULL DEFAULT '',
+				error       TEXT    NOT NULL DEFAULT '',
+				created_at  timestamp with time zone NOT NULL DEFAULT now(),
+				updated_at  timestamp with time zone NOT NULL DEFAULT now(),
+				PRIMARY KEY (schedule_id, run)
+			);`,
+	},
+	{
+		version:     8,
+		description: "add transfer jobs queue",
+		query: `
+			CREATE TABLE jobs (
+				id              TEXT    PRIMARY KEY NOT NULL,
+				currency        TEXT    NOT NULL,
+				amount          double precision NOT NULL,
+				to_address      TEXT    NOT NULL,
+				urgency         TEXT    NOT NULL,
+				status          TEXT    NOT NULL,
+				attempts        integer NOT NULL DEFAULT 0,
+				next_attempt_at timestamp with time zone NOT NULL,
+				lease_until     timestamp with time zone,
+				tx_id           TEXT    NOT NULL DEFAULT '',
+				last_error      TEXT    NOT NULL DEFAULT '',
+				created_by      TEXT    NOT NULL,
+				remote_addr     TEXT    NOT NULL,
+				request_hash    TEXT    NOT NULL,
+				created_at      timestamp with time zone NOT NULL,
+				updated_at      timestamp with time zone NOT NULL
+			);
+			CREATE INDEX jobs_due_index ON jobs (status, next_attempt_at);`,
+	},
+	{
+		version:     9,
+		description: "add network to transactions",
+		query: `
+			ALTER TABLE transactions ADD COLUMN network TEXT NOT NULL DEFAULT 'mainnet';
+			ALTER TABLE transactions ALTER COLUMN network DROP DEFAULT;
+			CREATE INDEX transactions_network_status_index ON transactions (currency, network, status);`,
+	},
+	{
+		version:     10,
+		description: "store fractional transaction amounts",
+		query: `
+			ALTER TABLE transactions ALTER COLUMN amount TYPE numeric;`,
+	},
+	{
+		version:     11,
+		description: "forbid audit log truncation",
+		query: `
+			CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+				FOR EACH STATEMENT EXECUTE PROCEDURE audit_log_append_only();`,
+	},
+	{
+		version:     12,
+		description: "add sent value and block inclusion to transactions",
+		query: `
+			ALTER TABLE transactions ADD COLUMN value numeric;
+			UPDATE transactions SET value = amount;
+			ALTER TABLE transactions ALTER COLUMN value SET NOT NULL;
+			ALTER TABLE transactions ADD COLUMN mined boolean NOT NULL DEFAULT false;
+			UPDATE transactions SET mined = true WHERE status <> 0;`,
+	},
+	{
+		version:     13,
+		description: "add network to queued, batched and scheduled transfers",
+		query: `
+			ALTER TABLE batch_items ADD COLUMN network TEXT NOT NULL DEFAULT '';
+			ALTER TABLE schedules ADD COLUMN network TEXT NOT NULL DEFAULT '';
+			ALTER TABLE jobs ADD COLUMN network TEXT NOT NULL DEFAULT '';`,
+	},
+}
+
+// createVersionsTable creates table that keeps applied migrations.
+const createVersionsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version     integer PRIMARY KEY NOT NULL,
+		description TEXT    NOT NULL,
+		applied_at  timestamp with time zone NOT NULL DEFAULT now()
+	);`
+
+// CreateSchema applies all pending migrations, each one in a separate db transaction.
+func (db *database) CreateSchema(ctx context.Context) (err error) {
+	_, err = db.db.ExecContext(ctx, createVersionsTable)
+	if err != nil {
+		return MigrationError.Wrap(err)
+	}
+
+	current, err := db.schemaVersion(ctx)
+	if err != nil {
+		return MigrationError.Wrap(err)
+	}
+
+	for _, migration := range migrations {
+		if migration.version <= current {
+			continue
+		}
+
+		err = db.applyMigration(ctx, migration)
+		if err != nil {
+			return MigrationError.New("version %d (%s): %v", migration.version, migration.description, err)
+		}
+	}
+
+	return nil
+}
+
+// PendingMigrations returns amount of migrations that are not applied yet.
+func (db *database) PendingMigrations(ctx context.Context) (int, error) {
+	var exists bool
+	err := db.db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL;`).Scan(&exists)
+	if err != nil {
+		return 0, MigrationError.Wrap(err)
+	}
+	if !exists {
+		return len(migrations), nil
+	}
+
+	current, err := db.schemaVersion(ctx)
+	if err != nil {
+		return 0, MigrationError.Wrap(err)
+	}
+
+	pending := 0
+	for _, migration := range migrations {
+		if migration.version > current {
+			pending++
+		}
+	}
+
+	return pending, nil
+}
+
+// schemaVersion returns version of the latest applied migration.
+func (db *database) schemaVersion(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	err := db.db.QueryRowContext(ctx, `SELECT max(version) FROM schema_migrations;`).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(version.Int64), nil
+}
+
+// applyMigration runs migration and records its version in the same db transaction.
+func (db *database) applyMigration(ctx context.Context, migration migration) error {
+	return withTx(ctx, db.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, migration.query)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, description) VALUES ($1, $2);`, migration.version, migration.description)
+		return err
+	})
+}
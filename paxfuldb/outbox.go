@@ -0,0 +1,85 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paxfuldb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/payments"
+	"paxful/webhooks"
+)
+
+// insertEvent writes transaction event to the outbox and schedules its delivery
+// to every webhook subscribed to the event type. It must be called inside the same
+// db transaction as the change which caused the event.
+func insertEvent(ctx context.Context, tx *sql.Tx, eventType payments.EventType, transaction payments.Transaction) (payments.Event, error) {
+	event := payments.Event{
+		Type:        eventType,
+		Transaction: transaction,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	err := tx.QueryRowContext(ctx, `SELECT nextval('outbox_events_id_seq');`).Scan(&event.ID)
+	if err != nil {
+		return payments.Event{}, err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return payments.Event{}, err
+	}
+
+	statement := `INSERT INTO outbox_events (id, type, transaction_id, payload, created_at) VALUES ($1, $2, $3, $4, $5);`
+	_, err = tx.ExecContext(ctx, statement, event.ID, event.Type, transaction.ID, payload, event.CreatedAt)
+	if err != nil {
+		return payments.Event{}, err
+	}
+
+	statement = `INSERT INTO webhook_deliveries (event_id, subscription_id, status, attempts, next_attempt_at, created_at)
+		SELECT $1, id, $2, 0, $3, $3 FROM webhook_subscriptions WHERE $4 = ANY(events);`
+	_, err = tx.ExecContext(ctx, statement, event.ID, webhooks.DeliveryStatusPending, event.CreatedAt, string(event.Type))
+	if err != nil {
+		return payments.Event{}, err
+	}
+
+	return event, nil
+}
+
+// Events returns up to limit outbox events with id greater than afterID ordered by id.
+func (transactions *transactions) Events(ctx context.Context, afterID int64, limit int) (_ []payments.Event, err error) {
+	defer func(start time.Time) { transactions.metrics.observe("outbox_events", start, err) }(time.Now())
+
+	statement := `SELECT payload FROM outbox_events WHERE id > $1 ORDER BY id LIMIT $2;`
+
+	rows, err := transactions.db.QueryContext(ctx, statement, afterID, limit)
+	if err != nil {
+		return nil, TransactionDBError.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	var events []payments.Event
+	for rows.Next() {
+		var payload []byte
+		if err = rows.Scan(&payload); err != nil {
+			return nil, TransactionDBError.Wrap(err)
+		}
+
+		var event payments.Event
+		if err = json.Unmarshal(payload, &event); err != nil {
+			return nil, TransactionDBError.Wrap(err)
+		}
+
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, TransactionDBError.Wrap(err)
+	}
+
+	return events, nil
+}
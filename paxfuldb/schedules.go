@@ -0,0 +1,237 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paxfuldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/console"
+	"paxful/schedules"
+)
+
+// ensures that schedulesDB implements schedules.DB.
+var _ schedules.DB = (*schedulesDB)(nil)
+
+// SchedulesDBError is the error class that indicates about schedules DB error.
+var SchedulesDBError = errs.Class("SchedulesDB error")
+
+// scheduleColumns is a list of columns that are scanned by scanSchedule.
+const scheduleColumns = `id, currency, amount, to_address, urgency, execute_at, recurrence_every, interval_ns, count,
+	status, next_run_at, runs, last_tx_id, last_error, created_by, remote_addr, created_at, network`
+
+// schedulesDB is a postgres implementation of schedules.DB.
+//
+// architecture: Database
+type schedulesDB struct {
+	db      *sql.DB
+	metrics *metrics
+}
+
+// Create stores new scheduled transfer.
+func (schedulesDB *schedulesDB) Create(ctx context.Context, schedule schedules.Schedule) (err error) {
+	defer func(start time.Time) { schedulesDB.metrics.observe("schedules_create", start, err) }(time.Now())
+
+	var every string
+	if schedule.Transaction.Recurrence != nil {
+		every = schedule.Transaction.Recurrence.Every
+	}
+
+	statement := `INSERT INTO schedules (` + scheduleColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18);`
+	_, err = schedulesDB.db.ExecContext(ctx, statement, schedule.ID, schedule.Transaction.Currency, schedule.Transaction.Amount,
+		schedule.Transaction.To, schedule.Transaction.Urgency, schedule.Transaction.ExecuteAt, every, int64(schedule.Interval),
+		schedule.Count, schedule.Status, schedule.NextRunAt, schedule.Runs, schedule.LastTxID, schedule.LastError,
+		schedule.CreatedBy, schedule.RemoteAddr, schedule.CreatedAt, schedule.Transaction.Network)
+
+	return SchedulesDBError.Wrap(err)
+}
+
+// List returns all scheduled transfers ordered by next run.
+func (schedulesDB *schedulesDB) List(ctx context.Context) (_ []schedules.Schedule, err error) {
+	defer func(start time.Time) { schedulesDB.metrics.observe("schedules_list", start, err) }(time.Now())
+
+	rows, err := schedulesDB.db.QueryContext(ctx, `SELECT `+scheduleColumns+` FROM schedules ORDER BY next_run_at;`)
+	if err != nil {
+		return nil, SchedulesDBError.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	var list []schedules.Schedule
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, SchedulesDBError.Wrap(err)
+		}
+
+		list = append(list, schedule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, SchedulesDBError.Wrap(err)
+	}
+
+	return list, nil
+}
+
+// Cancel cancels active scheduled transfer, run which is already in progress is not interrupted.
+func (schedulesDB *schedulesDB) Cancel(ctx context.Context, id string) (err error) {
+	defer func(start time.Time) { schedulesDB.metrics.observe("schedules_cancel", start, err) }(time.Now())
+
+	var status schedules.Status
+	statement := `
+		WITH target AS (SELECT id, status FROM schedules WHERE id = $1 FOR UPDATE),
+		canceled AS (UPDATE schedules SET status = $2 FROM target WHERE schedules.id = target.id AND target.status = $3)
+		SELECT status FROM target;`
+
+	err = schedulesDB.db.QueryRowContext(ctx, statement, id, schedules.StatusCanceled, schedules.StatusActive).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return schedules.ErrNotFound.New("%s", id)
+		}
+		return SchedulesDBError.Wrap(err)
+	}
+	if status != schedules.StatusActive {
+		return schedules.ErrNotActive.New("%s is %s", id, status)
+	}
+
+	return nil
+}
+
+// Claim leases the earliest due active schedule for the lease duration, so concurrent schedulers
+// never run the same schedule at once. returns ErrNotFound if nothing is due.
+func (schedulesDB *schedulesDB) Claim(ctx context.Context, lease time.Duration) (_ schedules.Schedule, err error) {
+	defer func(start time.Time) { schedulesDB.metrics.observe("schedules_claim", start, err) }(time.Now())
+
+	statement := `
+		WITH due AS (
+			SELECT id FROM schedules
+			WHERE status = $1 AND next_run_at <= now() AND (lease_until IS NULL OR lease_until <= now())
+			ORDER BY next_run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE schedules SET lease_until = now() + make_interval(secs => $2)
+		FROM due
+		WHERE schedules.id = due.id
+		RETURNING ` + qualify("schedules", scheduleColumns) + `;`
+
+	schedule, err := scanSchedule(schedulesDB.db.QueryRowContext(ctx, statement, schedules.StatusActive, lease.Seconds()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return schedules.Schedule{}, schedules.ErrNotFound.New("no due schedules")
+		}
+		return schedules.Schedule{}, SchedulesDBError.Wrap(err)
+	}
+
+	return schedule, nil
+}
+
+// BeginRun records the start of the run, it is an idempotency key of the transfer.
+// returns false and status of the existing execution if the run was already started.
+func (schedulesDB *schedulesDB) BeginRun(ctx context.Context, id string, run int) (_ bool, _ schedules.ExecutionStatus, err error) {
+	defer func(start time.Time) { schedulesDB.metrics.observe("schedules_begin_run", start, err) }(time.Now())
+
+	statement := `INSERT INTO schedule_executions (schedule_id, run, status) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;`
+	result, err := schedulesDB.db.ExecContext(ctx, statement, id, run, schedules.ExecutionStatusProcessing)
+	if err != nil {
+		return false, "", SchedulesDBError.Wrap(err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, "", SchedulesDBError.Wrap(err)
+	}
+	if inserted == 1 {
+		return true, schedules.ExecutionStatusProcessing, nil
+	}
+
+	var status schedules.ExecutionStatus
+	statement = `SELECT status FROM schedule_executions WHERE schedule_id = $1 AND run = $2;`
+	err = schedulesDB.db.QueryRowContext(ctx, statement, id, run).Scan(&status)
+
+	return false, status, SchedulesDBError.Wrap(err)
+}
+
+// FinishRun stores run result and moves schedule to the next run, or completes it if next is nil.
+func (schedulesDB *schedulesDB) FinishRun(ctx context.Context, id string, execution schedules.Execution, next *time.Time) (err error) {
+	defer func(start time.Time) { schedulesDB.metrics.observe("schedules_finish_run", start, err) }(time.Now())
+
+	err = withTx(ctx, schedulesDB.db, func(tx *sql.Tx) error {
+		statement := `UPDATE schedule_executions SET status = $1, tx_id = $2, error = $3, updated_at = now() WHERE schedule_id = $4 AND run = $5;`
+		_, err := tx.ExecContext(ctx, statement, execution.Status, execution.TxID, execution.Error, id, execution.Run)
+		if err != nil {
+			return err
+		}
+
+		// canceled schedule stays canceled even if its run was in progress.
+		statement = `
+			UPDATE schedules SET
+				runs = $1, last_tx_id = $2, last_error = $3, lease_until = NULL,
+				next_run_at = COALESCE($4::timestamp with time zone, next_run_at),
+				status = CASE WHEN status = $5 AND $4::timestamp with time zone IS NULL THEN $6 ELSE status END
+			WHERE id = $7;`
+		_, err = tx.ExecContext(ctx, statement, execution.Run, execution.TxID, execution.Error, next,
+			schedules.StatusActive, schedules.StatusCompleted, id)
+
+		return err
+	})
+
+	return SchedulesDBError.Wrap(err)
+}
+
+// AbortRun removes started run which did not send anything and releases the lease, so the run is retried.
+func (schedulesDB *schedulesDB) AbortRun(ctx context.Context, id string, run int) (err error) {
+	defer func(start time.Time) { schedulesDB.metrics.observe("schedules_abort_run", start, err) }(time.Now())
+
+	err = withTx(ctx, schedulesDB.db, func(tx *sql.Tx) error {
+		statement := `DELETE FROM schedule_executions WHERE schedule_id = $1 AND run = $2 AND status = $3;`
+		_, err := tx.ExecContext(ctx, statement, id, run, schedules.ExecutionStatusProcessing)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE schedules SET lease_until = NULL WHERE id = $1;`, id)
+		return err
+	})
+
+	return SchedulesDBError.Wrap(err)
+}
+
+// scanSchedule scans schedule selected with scheduleColumns.
+func scanSchedule(row scanner) (schedules.Schedule, error) {
+	var schedule schedules.Schedule
+	var executeAt time.Time
+	var every string
+	var interval int64
+
+	err := row.Scan(&schedule.ID, &schedule.Transaction.Currency, &schedule.Transaction.Amount, &schedule.Transaction.To,
+		&schedule.Transaction.Urgency, &executeAt, &every, &interval, &schedule.Count, &schedule.Status, &schedule.NextRunAt,
+		&schedule.Runs, &schedule.LastTxID, &schedule.LastError, &schedule.CreatedBy, &schedule.RemoteAddr, &schedule.CreatedAt, &schedule.Transaction.Network)
+	if err != nil {
+		return schedules.Schedule{}, err
+	}
+
+	schedule.Transaction.ExecuteAt = &executeAt
+	schedule.Interval = time.Duration(interval)
+	if every != "" {
+		schedule.Transaction.Recurrence = &console.Recurrence{Every: every, Count: schedule.Count}
+	}
+
+	return schedule, nil
+}
+
+// qualify prefixes every column of comma separated list with the table name.
+func qualify(table, columns string) string {
+	list := strings.Split(columns, ",")
+	for i, column := range list {
+		list[i] = table + "." + strings.TrimSpace(column)
+	}
+
+	return strings.Join(list, ", ")
+}
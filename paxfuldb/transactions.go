@@ -6,6 +6,10 @@ package paxfuldb
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/zeebo/errs"
 
 	"paxful/payments"
@@ -21,35 +25,166 @@ var TransactionDBError = errs.Class("TransactionDB error")
 //
 // architecture: Database
 type transactions struct {
-	db *sql.DB
+	db      *sql.DB
+	metrics *metrics
 }
 
+// transactionColumns is a list of columns that are scanned by scanTransaction.
+const transactionColumns = `id, output_index, currency, network, amount, value, fee, fromAddress, toAddress, status, gas_estimated, gas_limit, gas_used, mined, created_at`
+
 // Commit is used to create new transaction record in TransactionDB.
-func (transactions *transactions) Commit(ctx context.Context, transaction payments.Transaction) error {
-	statement := `INSERT INTO transactions (id, currency, amount, fee, fromAddress, toAddress, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7);`
+// EventTransactionCreated is written to the outbox in the same db transaction and returned.
+func (transactions *transactions) Commit(ctx context.Context, transaction payments.Transaction) (event payments.Event, err error) {
+	defer func(start time.Time) { transactions.metrics.observe("transactions_commit", start, err) }(time.Now())
 
-	_, err := transactions.db.ExecContext(ctx, statement, transaction.ID, transaction.Currency, transaction.Amount, transaction.Fee, transaction.From, transaction.To, transaction.CreatedAt)
+	err = withTx(ctx, transactions.db, func(tx *sql.Tx) error {
+		// amount and value are numeric, float is sent as its shortest decimal representation, so it is stored without rounding.
+		statement := `INSERT INTO transactions (` + transactionColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15);`
 
-	return TransactionDBError.Wrap(err)
-}
+		_, err := tx.ExecContext(ctx, statement, transaction.ID, transaction.OutputIndex, transaction.Currency, transaction.Network, transaction.Amount, transaction.Value, transaction.Fee, transaction.From, transaction.To,
+			transaction.Status, transaction.GasEstimated, transaction.GasLimit, transaction.GasUsed, transaction.Mined, transaction.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		event, err = insertEvent(ctx, tx, payments.EventTypeFromStatus(transaction.Status), transaction)
+		return err
+	})
+	if err != nil {
+		return payments.Event{}, TransactionDBError.Wrap(err)
+	}
 
+	return event, nil
+}
 
 // List is used to return all transactions.
-func (transactions *transactions) List(ctx context.Context) ([]payments.Transaction, error) {
-	statement := `SELECT * FROM transactions;`
+func (transactions *transactions) List(ctx context.Context) (_ []payments.Transaction, err error) {
+	defer func(start time.Time) { transactions.metrics.observe("transactions_list", start, err) }(time.Now())
+
+	statement := `SELECT ` + transactionColumns + ` FROM transactions;`
+
+	return transactions.query(ctx, statement)
+}
+
+// ListByStatus is used to return all transactions with the status.
+func (transactions *transactions) ListByStatus(ctx context.Context, status payments.TransactionStatus) (_ []payments.Transaction, err error) {
+	defer func(start time.Time) { transactions.metrics.observe("transactions_list_by_status", start, err) }(time.Now())
 
+	statement := `SELECT ` + transactionColumns + ` FROM transactions WHERE status = $1 ORDER BY created_at;`
+
+	return transactions.query(ctx, statement, status)
+}
+
+// Find returns transactions matching the filter, newest first.
+func (transactions *transactions) Find(ctx context.Context, filter payments.TransactionFilter) (_ []payments.Transaction, err error) {
+	defer func(start time.Time) { transactions.metrics.observe("transactions_find", start, err) }(time.Now())
+
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Currency != "" {
+		where("currency = $%d", filter.Currency)
+	}
+	if filter.Network != "" {
+		where("network = $%d", filter.Network)
+	}
+	if filter.Status != nil {
+		where("status = $%d", *filter.Status)
+	}
+	if filter.To != "" {
+		where("toAddress = $%d", filter.To)
+	}
+	if !filter.Since.IsZero() {
+		where("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("created_at < $%d", filter.Until)
+	}
+
+	statement := `SELECT ` + transactionColumns + ` FROM transactions`
+	if len(conditions) > 0 {
+		statement += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	statement += ` ORDER BY created_at DESC, id, output_index`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		statement += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+
+	return transactions.query(ctx, statement+`;`, args...)
+}
+
+// Get returns all outputs of the transaction ordered by output index.
+func (transactions *transactions) Get(ctx context.Context, id string) (_ []payments.Transaction, err error) {
+	defer func(start time.Time) { transactions.metrics.observe("transactions_get", start, err) }(time.Now())
+
+	statement := `SELECT ` + transactionColumns + ` FROM transactions WHERE id = $1 ORDER BY output_index;`
+
+	outputs, err := transactions.query(ctx, statement, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) == 0 {
+		return nil, payments.ErrTransactionNotFound.New("%s", id)
+	}
+
+	return outputs, nil
+}
+
+// UpdateStatus changes status of the transaction and stores receipt data,
+// corresponding event is written to the outbox in the same db transaction and returned.
+// returned event has zero id if transaction already had the status.
+func (transactions *transactions) UpdateStatus(ctx context.Context, id string, outputIndex int, receipt payments.Receipt) (event payments.Event, err error) {
+	defer func(start time.Time) { transactions.metrics.observe("transactions_update_status", start, err) }(time.Now())
+
+	err = withTx(ctx, transactions.db, func(tx *sql.Tx) error {
+		statement := `UPDATE transactions SET status = $1, gas_used = $2, mined = true WHERE id = $3 AND output_index = $4 AND status <> $1 RETURNING ` + transactionColumns + `;`
+
+		transaction, err := scanTransaction(tx.QueryRowContext(ctx, statement, receipt.Status, receipt.GasUsed, id, outputIndex))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				// transaction does not exist or already has the status, no event should be emitted.
+				return nil
+			}
+			return err
+		}
+
+		event, err = insertEvent(ctx, tx, payments.EventTypeFromStatus(receipt.Status), transaction)
+		return err
+	})
+	if err != nil {
+		return payments.Event{}, TransactionDBError.Wrap(err)
+	}
+
+	return event, nil
+}
+
+// MarkMined marks all not yet confirmed outputs of the transaction as included to the block and stores gas used.
+func (transactions *transactions) MarkMined(ctx context.Context, id string, gasUsed uint64) (err error) {
+	defer func(start time.Time) { transactions.metrics.observe("transactions_mark_mined", start, err) }(time.Now())
+
+	statement := `UPDATE transactions SET mined = true, gas_used = $1 WHERE id = $2 AND status = $3;`
+
+	_, err = transactions.db.ExecContext(ctx, statement, gasUsed, id, payments.TransactionStatusSuccess)
+	return TransactionDBError.Wrap(err)
+}
+
+// query returns transactions selected by the statement.
+func (transactions *transactions) query(ctx context.Context, statement string, args ...interface{}) (_ []payments.Transaction, err error) {
 	var transactionList []payments.Transaction
 
-	rows, err := transactions.db.QueryContext(ctx, statement)
+	rows, err := transactions.db.QueryContext(ctx, statement, args...)
 	if err != nil {
 		return nil, TransactionDBError.Wrap(err)
 	}
 	defer func() { err = errs.Combine(err, rows.Close()) }()
 
 	for rows.Next() {
-		transaction := payments.Transaction{}
-
-		err := rows.Scan(&transaction.ID, &transaction.Currency, &transaction.Amount, &transaction.Fee, &transaction.From, &transaction.To, &transaction.CreatedAt);
+		transaction, err := scanTransaction(rows)
 		if err != nil {
 			return nil, TransactionDBError.Wrap(err)
 		}
@@ -63,3 +198,17 @@ func (transactions *transactions) List(ctx context.Context) ([]payments.Transact
 	return transactionList, nil
 }
 
+// scanner is implemented by sql.Row and sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTransaction scans transaction selected with transactionColumns.
+func scanTransaction(row scanner) (payments.Transaction, error) {
+	transaction := payments.Transaction{}
+
+	err := row.Scan(&transaction.ID, &transaction.OutputIndex, &transaction.Currency, &transaction.Network, &transaction.Amount, &transaction.Value, &transaction.Fee, &transaction.From, &transaction.To,
+		&transaction.Status, &transaction.GasEstimated, &transaction.GasLimit, &transaction.GasUsed, &transaction.Mined, &transaction.CreatedAt)
+
+	return transaction, err
+}
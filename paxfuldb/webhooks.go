@@ -0,0 +1,170 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paxfuldb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/zeebo/errs"
+
+	"paxful/payments"
+	"paxful/webhooks"
+)
+
+// ensures that webhooksDB implements webhooks.DB.
+var _ webhooks.DB = (*webhooksDB)(nil)
+
+// WebhooksDBError is the error class that indicates about webhooks DB error.
+var WebhooksDBError = errs.Class("WebhooksDB error")
+
+// webhooksDB is a postgres implementation of webhooks.DB.
+//
+// architecture: Database
+type webhooksDB struct {
+	db      *sql.DB
+	metrics *metrics
+}
+
+// CreateSubscription stores new subscription.
+func (webhooksDB *webhooksDB) CreateSubscription(ctx context.Context, subscription webhooks.Subscription) (err error) {
+	defer func(start time.Time) { webhooksDB.metrics.observe("webhooks_create_subscription", start, err) }(time.Now())
+
+	events := make([]string, 0, len(subscription.Events))
+	for _, event := range subscription.Events {
+		events = append(events, string(event))
+	}
+
+	statement := `INSERT INTO webhook_subscriptions (id, url, events, secret, created_at) VALUES ($1, $2, $3, $4, $5);`
+	_, err = webhooksDB.db.ExecContext(ctx, statement, subscription.ID, subscription.URL, pq.Array(events), subscription.Secret, subscription.CreatedAt)
+
+	return WebhooksDBError.Wrap(err)
+}
+
+// ListSubscriptions returns all subscriptions without secrets.
+func (webhooksDB *webhooksDB) ListSubscriptions(ctx context.Context) (_ []webhooks.Subscription, err error) {
+	defer func(start time.Time) { webhooksDB.metrics.observe("webhooks_list_subscriptions", start, err) }(time.Now())
+
+	rows, err := webhooksDB.db.QueryContext(ctx, `SELECT id, url, events, created_at FROM webhook_subscriptions ORDER BY created_at;`)
+	if err != nil {
+		return nil, WebhooksDBError.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	var subscriptions []webhooks.Subscription
+	for rows.Next() {
+		var subscription webhooks.Subscription
+		var events []string
+
+		err = rows.Scan(&subscription.ID, &subscription.URL, pq.Array(&events), &subscription.CreatedAt)
+		if err != nil {
+			return nil, WebhooksDBError.Wrap(err)
+		}
+
+		for _, event := range events {
+			subscription.Events = append(subscription.Events, payments.EventType(event))
+		}
+
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, WebhooksDBError.Wrap(err)
+	}
+
+	return subscriptions, nil
+}
+
+// DeleteSubscription removes subscription with all its pending deliveries.
+func (webhooksDB *webhooksDB) DeleteSubscription(ctx context.Context, id string) (err error) {
+	defer func(start time.Time) { webhooksDB.metrics.observe("webhooks_delete_subscription", start, err) }(time.Now())
+
+	result, err := webhooksDB.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1;`, id)
+	if err != nil {
+		return WebhooksDBError.Wrap(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return WebhooksDBError.Wrap(err)
+	}
+	if affected == 0 {
+		return webhooks.ErrNotFound.New("%s", id)
+	}
+
+	return nil
+}
+
+// ClaimDeliveries leases up to limit due pending deliveries for the lease duration,
+// so concurrent dispatchers never send the same delivery at once.
+func (webhooksDB *webhooksDB) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) (_ []webhooks.Delivery, err error) {
+	defer func(start time.Time) { webhooksDB.metrics.observe("webhooks_claim_deliveries", start, err) }(time.Now())
+
+	statement := `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries AS deliveries
+		SET next_attempt_at = now() + make_interval(secs => $3), updated_at = now()
+		FROM due, outbox_events AS events, webhook_subscriptions AS subscriptions
+		WHERE deliveries.id = due.id
+			AND events.id = deliveries.event_id
+			AND subscriptions.id = deliveries.subscription_id
+		RETURNING deliveries.id, deliveries.event_id, events.type, events.payload, deliveries.attempts,
+			subscriptions.id, subscriptions.url, subscriptions.secret;`
+
+	rows, err := webhooksDB.db.QueryContext(ctx, statement, webhooks.DeliveryStatusPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, WebhooksDBError.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	var deliveries []webhooks.Delivery
+	for rows.Next() {
+		var delivery webhooks.Delivery
+
+		err = rows.Scan(&delivery.ID, &delivery.EventID, &delivery.EventType, &delivery.Payload, &delivery.Attempts,
+			&delivery.SubscriptionID, &delivery.URL, &delivery.Secret)
+		if err != nil {
+			return nil, WebhooksDBError.Wrap(err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, WebhooksDBError.Wrap(err)
+	}
+
+	return deliveries, nil
+}
+
+// MarkDelivered marks delivery as successfully sent.
+func (webhooksDB *webhooksDB) MarkDelivered(ctx context.Context, id int64) (err error) {
+	defer func(start time.Time) { webhooksDB.metrics.observe("webhooks_mark_delivered", start, err) }(time.Now())
+
+	statement := `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, last_error = '', updated_at = now() WHERE id = $2;`
+	_, err = webhooksDB.db.ExecContext(ctx, statement, webhooks.DeliveryStatusDelivered, id)
+
+	return WebhooksDBError.Wrap(err)
+}
+
+// MarkFailed records failed attempt, delivery is moved to dead-letter state if dead is true.
+func (webhooksDB *webhooksDB) MarkFailed(ctx context.Context, id int64, nextAttemptAt time.Time, dead bool, lastError string) (err error) {
+	defer func(start time.Time) { webhooksDB.metrics.observe("webhooks_mark_failed", start, err) }(time.Now())
+
+	status := webhooks.DeliveryStatusPending
+	if dead {
+		status = webhooks.DeliveryStatusDead
+	}
+
+	statement := `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, next_attempt_at = $2, last_error = $3, updated_at = now() WHERE id = $4;`
+	_, err = webhooksDB.db.ExecContext(ctx, statement, status, nextAttemptAt, lastError, id)
+
+	return WebhooksDBError.Wrap(err)
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package payments
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/internal/logger"
+)
+
+// MonitorConfig contains configuration for hot wallet balance monitor.
+type MonitorConfig struct {
+	Interval time.Duration `json:"interval" help:"how often hot wallet balances are refreshed for metrics and checked against low watermark" default:"1m"`
+}
+
+// BalanceMonitor periodically checks hot wallet balances and emits alert
+// when balance drops below low watermark, and when it recovers.
+// last received balances are cached, so metrics do not query nodes on every scrape.
+//
+// architecture: Worker
+type BalanceMonitor struct {
+	log        logger.Logger
+	config     MonitorConfig
+	provider   PaymentProvider
+	watermarks map[PaymentCurrency]float64
+
+	// low keeps currencies which are already alerted, so alert is emitted once per drop.
+	low map[PaymentCurrency]bool
+
+	// balances keeps last received balance of every currency for metrics.
+	mu       sync.Mutex
+	balances map[PaymentCurrency]float64
+}
+
+// NewBalanceMonitor is a constructor for BalanceMonitor.
+// currencies with zero watermark are not alerted, but their balances are cached as well.
+func NewBalanceMonitor(log logger.Logger, config MonitorConfig, provider PaymentProvider, watermarks map[PaymentCurrency]float64) *BalanceMonitor {
+	return &BalanceMonitor{
+		log:        log,
+		config:     config,
+		provider:   provider,
+		watermarks: watermarks,
+		low:        make(map[PaymentCurrency]bool),
+		balances:   make(map[PaymentCurrency]float64),
+	}
+}
+
+// Run checks balances every interval until ctx is done.
+func (monitor *BalanceMonitor) Run(ctx context.Context) error {
+	interval := monitor.config.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := monitor.Check(ctx); err != nil {
+			monitor.log.Error("could not check hot wallet balances", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Balance returns hot wallet balance of the currency received by the last check,
+// false is returned if balance is not received yet or the last check failed.
+func (monitor *BalanceMonitor) Balance(currency PaymentCurrency) (float64, bool) {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	balance, ok := monitor.balances[currency]
+	return balance, ok
+}
+
+// Check refreshes cached balance of every currency and compares it with low watermark of the currency.
+func (monitor *BalanceMonitor) Check(ctx context.Context) error {
+	var group errs.Group
+	for _, currency := range monitor.provider.Currencies() {
+		transactions, err := monitor.provider.GetByCurrency(currency)
+		if err != nil {
+			group.Add(err)
+			continue
+		}
+
+		balance, err := transactions.Balance(ctx)
+		monitor.cache(currency, balance, err)
+		if err != nil {
+			group.Add(err)
+			continue
+		}
+
+		watermark := monitor.watermarks[currency]
+		if watermark <= 0 {
+			continue
+		}
+
+		log := monitor.log.With(
+			logger.String("currency", string(currency)),
+			logger.Any("balance", balance),
+			logger.Any("lowWatermark", watermark),
+		)
+
+		switch {
+		case balance < watermark && !monitor.low[currency]:
+			monitor.low[currency] = true
+			log.Warn("ALERT: hot wallet balance is below low watermark")
+		case balance >= watermark && monitor.low[currency]:
+			monitor.low[currency] = false
+			log.Info("hot wallet balance recovered above low watermark")
+		}
+	}
+
+	return group.Err()
+}
+
+// cache stores received balance, failed check removes the stale one.
+func (monitor *BalanceMonitor) cache(currency PaymentCurrency, balance float64, err error) {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	if err != nil {
+		delete(monitor.balances, currency)
+		return
+	}
+
+	monitor.balances[currency] = balance
+}
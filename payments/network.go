@@ -0,0 +1,41 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package payments
+
+import (
+	"strings"
+
+	"github.com/zeebo/errs"
+)
+
+// NetworkMismatchError indicates that node or transfer belongs to another network than configured one.
+var NetworkMismatchError = errs.Class("network mismatch")
+
+// NetworkConfig describes blockchain network transfers of a currency are sent to.
+// every transaction is tagged with the network name, so services of different networks
+// could share the database without touching transactions of each other.
+type NetworkConfig struct {
+	Name          string `json:"name" help:"name of the network transactions are tagged with, e.g. mainnet, testnet or goerli" default:"mainnet" validate:"required"`
+	ExplorerURL   string `json:"explorerUrl" help:"explorer url of a transaction, {id} is replaced with transaction id, e.g. https://etherscan.io/tx/{id}"`
+	Confirmations int64  `json:"confirmations" help:"amount of blocks including the transaction block before transaction is confirmed" default:"1" validate:"min=1"`
+}
+
+// TransactionURL returns explorer url of the transaction, empty if explorer is not configured.
+func (network NetworkConfig) TransactionURL(id string) string {
+	if network.ExplorerURL == "" || id == "" {
+		return ""
+	}
+
+	return strings.Replace(network.ExplorerURL, "{id}", id, -1)
+}
+
+// CheckNetwork returns NetworkMismatchError if transaction of the network could not be handled by the service
+// of configured network, transactions without network are accepted.
+func (network NetworkConfig) CheckNetwork(name string) error {
+	if name != "" && name != network.Name {
+		return NetworkMismatchError.New("transaction is for %q network, service is configured for %q", name, network.Name)
+	}
+
+	return nil
+}
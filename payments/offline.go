@@ -0,0 +1,44 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// OfflineTransactions is implemented by payment services which support signing on an air-gapped host,
+// so the key of a cold wallet is never present on an online one.
+//
+// architecture: Service
+type OfflineTransactions interface {
+	// Prepare returns unsigned transfer from the address with all parameters needed for signing filled.
+	Prepare(ctx context.Context, tx Transaction, from string) (UnsignedTransaction, error)
+	// Broadcast checks that signed transfer matches its parameters and sends it to the network.
+	Broadcast(ctx context.Context, signed SignedTransaction) (Transaction, error)
+}
+
+// UnsignedTransaction is a transfer prepared on an online host to be signed on an offline one.
+type UnsignedTransaction struct {
+	Currency PaymentCurrency `json:"currency"`
+	// Network is a name of the network transfer is prepared for, it could not be broadcasted to another one.
+	Network string  `json:"network"`
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+	Amount  float64 `json:"amount"`
+	Urgency Urgency `json:"urgency,omitempty"`
+	// Params are currency specific parameters of signing, e.g. nonce, gas and chain id.
+	Params    json.RawMessage `json:"params"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// SignedTransaction is a transfer signed offline and ready to be broadcasted.
+type SignedTransaction struct {
+	UnsignedTransaction
+	// ID is an id the transaction will have in the network.
+	ID string `json:"id"`
+	// Raw is a hex encoded signed transaction in the network format.
+	Raw string `json:"raw"`
+}
@@ -41,6 +41,11 @@ func (provider *PaymentProvider) GetByCurrency(currency PaymentCurrency) (Transa
 	}
 }
 
+// Currencies returns all supported currencies.
+func (provider *PaymentProvider) Currencies() []PaymentCurrency {
+	return []PaymentCurrency{PaymentCurrencyETH, PaymentCurrencyBTC}
+}
+
 // PaymentCurrency indicates type of supported currencies to transfer.
 type PaymentCurrency string
 
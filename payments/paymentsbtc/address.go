@@ -0,0 +1,159 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paymentsbtc
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Network defines bitcoin network, it affects address prefix.
+type Network string
+
+const (
+	// NetworkMainnet is the main bitcoin network.
+	NetworkMainnet Network = "mainnet"
+	// NetworkTestnet is the public test network.
+	NetworkTestnet Network = "testnet"
+	// NetworkRegtest is a local regression test network.
+	NetworkRegtest Network = "regtest"
+)
+
+// humanReadablePart returns bech32 prefix of segwit addresses in the network.
+func (network Network) humanReadablePart() (string, error) {
+	switch network {
+	case NetworkMainnet:
+		return "bc", nil
+	case NetworkTestnet:
+		return "tb", nil
+	case NetworkRegtest:
+		return "bcrt", nil
+	default:
+		return "", Error.New("bitcoin network %q is not supported", network)
+	}
+}
+
+// chain returns chain name reported by the node in the network.
+func (network Network) chain() string {
+	switch network {
+	case NetworkMainnet:
+		return "main"
+	case NetworkTestnet:
+		return "test"
+	default:
+		return string(network)
+	}
+}
+
+// legacyPrefixes returns first characters of base58 addresses in the network.
+func (network Network) legacyPrefixes() string {
+	if network == NetworkMainnet {
+		return "13"
+	}
+
+	return "mn2"
+}
+
+// Address returns native segwit (P2WPKH) address of the public key in the network.
+func Address(publicKey *ecdsa.PublicKey, network Network) (string, error) {
+	hrp, err := network.humanReadablePart()
+	if err != nil {
+		return "", err
+	}
+
+	sha := sha256.Sum256(crypto.CompressPubkey(publicKey))
+	hash := ripemd160.New()
+	_, _ = hash.Write(sha[:])
+
+	// witness version 0 followed by 20 bytes of public key hash.
+	program, err := convertBits(hash.Sum(nil), 8, 5)
+	if err != nil {
+		return "", err
+	}
+
+	return bech32Encode(hrp, append([]byte{0}, program...)), nil
+}
+
+// bech32Encode encodes 5 bit groups with checksum as described in BIP-173.
+func bech32Encode(hrp string, data []byte) string {
+	checksum := bech32Checksum(hrp, data)
+
+	var address strings.Builder
+	address.WriteString(hrp)
+	address.WriteByte('1')
+	for _, value := range append(data, checksum...) {
+		address.WriteByte(bech32Alphabet[value])
+	}
+
+	return address.String()
+}
+
+// bech32Checksum returns 6 groups of checksum of the data.
+func bech32Checksum(hrp string, data []byte) []byte {
+	values := make([]byte, 0, len(hrp)*2+1+len(data)+6)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	values = append(values, data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+
+	polymod := bech32Polymod(values) ^ 1
+
+	checksum := make([]byte, 6)
+	for i := range checksum {
+		checksum[i] = byte((polymod >> uint(5*(5-i))) & 31)
+	}
+
+	return checksum
+}
+
+// bech32Polymod computes BCH checksum of the values.
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+	checksum := uint32(1)
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+
+	return checksum
+}
+
+// convertBits regroups bytes of fromBits size into groups of toBits size, last group is padded with zeros.
+func convertBits(data []byte, fromBits, toBits uint) ([]byte, error) {
+	var result []byte
+	var accumulator, bits uint
+	maxValue := uint(1)<<toBits - 1
+
+	for _, value := range data {
+		if uint(value)>>fromBits != 0 {
+			return nil, Error.New("invalid data for bits conversion")
+		}
+		accumulator = accumulator<<fromBits | uint(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(accumulator>>bits&maxValue))
+		}
+	}
+	if bits > 0 {
+		result = append(result, byte(accumulator<<(toBits-bits)&maxValue))
+	}
+
+	return result, nil
+}
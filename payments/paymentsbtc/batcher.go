@@ -0,0 +1,247 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paymentsbtc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"paxful/internal/logger"
+	"paxful/payments"
+)
+
+// satoshisPerBitcoin is an amount of satoshis in one bitcoin.
+const satoshisPerBitcoin = 1e8
+
+// confirmation targets in blocks used by node fee estimation for every urgency.
+var confTargets = map[payments.Urgency]int{
+	payments.UrgencySlow:   24,
+	payments.UrgencyNormal: 6,
+	payments.UrgencyFast:   2,
+}
+
+// payout is a queued transfer waiting to be sent in a multi-output transaction.
+// satoshis is an amount sent to the receiver, commission is already applied to it.
+type payout struct {
+	tx       payments.Transaction
+	satoshis int64
+	result   chan payoutResult
+}
+
+// payoutResult is a sent transfer or an error why it was not sent.
+type payoutResult struct {
+	tx  payments.Transaction
+	err error
+}
+
+// batcher aggregates payouts collected during the window, or until size is reached,
+// and sends them as a single transaction with an output per payout.
+type batcher struct {
+	log     logger.Logger
+	rpc     *rpcClient
+	timeout time.Duration
+	window  time.Duration
+	size    int
+
+	mu    sync.Mutex
+	queue []*payout
+	timer *time.Timer
+}
+
+// newBatcher is a constructor for batcher, timeout limits every node call of a batch.
+func newBatcher(log logger.Logger, rpc *rpcClient, timeout time.Duration, window time.Duration, size int) *batcher {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &batcher{
+		log:     log,
+		rpc:     rpc,
+		timeout: timeout,
+		window:  window,
+		size:    size,
+	}
+}
+
+// add queues payout, result is sent to payout result channel when its transaction is broadcasted or failed.
+func (batcher *batcher) add(queuing *payout) {
+	var ready [][]*payout
+
+	batcher.mu.Lock()
+	// every row must map to its own output, so the same receiver waits for the next transaction.
+	for _, queued := range batcher.queue {
+		if queued.tx.To == queuing.tx.To {
+			ready = append(ready, batcher.take())
+			break
+		}
+	}
+
+	batcher.queue = append(batcher.queue, queuing)
+	switch {
+	case len(batcher.queue) >= batcher.size || batcher.window <= 0:
+		ready = append(ready, batcher.take())
+	case batcher.timer == nil:
+		batcher.timer = time.AfterFunc(batcher.window, batcher.flush)
+	}
+	batcher.mu.Unlock()
+
+	for _, payouts := range ready {
+		go batcher.send(payouts)
+	}
+}
+
+// flush sends all queued payouts.
+func (batcher *batcher) flush() {
+	batcher.mu.Lock()
+	payouts := batcher.take()
+	batcher.mu.Unlock()
+
+	if len(payouts) > 0 {
+		batcher.send(payouts)
+	}
+}
+
+// take removes all payouts from the queue, must be called under mutex.
+func (batcher *batcher) take() []*payout {
+	if batcher.timer != nil {
+		batcher.timer.Stop()
+		batcher.timer = nil
+	}
+
+	payouts := batcher.queue
+	batcher.queue = nil
+
+	return payouts
+}
+
+// send broadcasts single transaction paying to all payouts and reports results.
+// fee of the transaction is split between payouts equally, since every output adds the same size.
+func (batcher *batcher) send(payouts []*payout) {
+	// payouts could be broadcasted, so sending is not bound to any request context,
+	// but it is bounded by deadline, so hung node does not block queued payouts forever.
+	ctx := context.Background()
+	if batcher.timeout > 0 {
+		var cancel context.CancelFunc
+		// sendmany and gettransaction are called once.
+		ctx, cancel = context.WithTimeout(ctx, 2*batcher.timeout)
+		defer cancel()
+	}
+
+	amounts := make(map[string]float64, len(payouts))
+	confTarget := confTargets[payments.UrgencySlow]
+	for _, payout := range payouts {
+		amounts[payout.tx.To] = toBitcoins(payout.satoshis)
+		if target, ok := confTargets[payout.tx.Urgency]; ok && target < confTarget {
+			confTarget = target
+		}
+	}
+
+	var txID string
+	err := batcher.rpc.call(ctx, "sendmany", &txID, "", amounts, 1, "", []string{}, true, confTarget)
+	if err != nil {
+		// node answered with an error, so nothing was sent and payouts are retried one by one,
+		// so a single rejected output does not fail the others.
+		var response *rpcErrorResponse
+		if len(payouts) > 1 && errors.As(err, &response) {
+			batcher.log.Warn("batch is rejected by the node, sending payouts separately", logger.String("error", err.Error()))
+			for _, single := range payouts {
+				batcher.send([]*payout{single})
+			}
+			return
+		}
+
+		err = classify(err)
+		for _, payout := range payouts {
+			payout.result <- payoutResult{err: err}
+		}
+		return
+	}
+
+	log := batcher.log.With(logger.String("txID", txID), logger.Any("outputs", len(payouts)))
+
+	var sent struct {
+		Fee     float64 `json:"fee"`
+		Details []struct {
+			Address  string `json:"address"`
+			Category string `json:"category"`
+			Vout     int    `json:"vout"`
+		} `json:"details"`
+	}
+	err = batcher.rpc.call(ctx, "gettransaction", &sent, txID)
+	if err != nil {
+		// coins are sent, so rows are stored with unknown outputs to be checked manually.
+		log.Error("could not get outputs of sent transaction, payouts are stored with unknown status", Error.Wrap(err))
+	}
+
+	vouts := make(map[string]int, len(sent.Details))
+	for _, detail := range sent.Details {
+		if detail.Category == "send" {
+			vouts[detail.Address] = detail.Vout
+		}
+	}
+
+	// wallet reports fee as a negative amount.
+	fee := toSatoshis(math.Abs(sent.Fee))
+	share, remainder := fee/int64(len(payouts)), fee%int64(len(payouts))
+
+	createdAt := time.Now().UTC()
+	for position, payout := range payouts {
+		tx := payout.tx
+		tx.ID = txID
+		tx.CreatedAt = createdAt
+
+		// output index is a part of the stored row key, so it is never guessed,
+		// negative index keeps rows of the same transaction distinct.
+		vout, ok := vouts[tx.To]
+		if !ok {
+			if err == nil {
+				log.Error("could not get output of sent payout, payout is stored with unknown status", Error.New("no output to %s", tx.To))
+			}
+			tx.OutputIndex = -(position + 1)
+			tx.Status = payments.TransactionStatusUnknown
+			payout.result <- payoutResult{tx: tx}
+			continue
+		}
+		tx.OutputIndex = vout
+		tx.Fee = share
+		if position == 0 {
+			tx.Fee += remainder
+		}
+
+		payout.result <- payoutResult{tx: tx}
+	}
+
+	log.Debug("bitcoin transaction sent", logger.Any("fee", fee))
+}
+
+// classify converts node errors to payments error classes.
+func classify(err error) error {
+	var response *rpcErrorResponse
+	if errors.As(err, &response) {
+		switch response.Code {
+		case rpcInsufficientFunds:
+			return payments.InsufficientFundsError.Wrap(err)
+		case rpcInvalidAddress:
+			return payments.ValidationError.Wrap(err)
+		default:
+			// node answered with an error, so nothing was sent.
+			return Error.Wrap(err)
+		}
+	}
+
+	return payments.BroadcastError.Wrap(Error.Wrap(err))
+}
+
+// toSatoshis converts bitcoins to satoshis.
+func toSatoshis(amount float64) int64 {
+	return int64(math.Round(amount * satoshisPerBitcoin))
+}
+
+// toBitcoins converts satoshis to bitcoins.
+func toBitcoins(amount int64) float64 {
+	return float64(amount) / satoshisPerBitcoin
+}
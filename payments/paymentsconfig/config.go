@@ -10,7 +10,7 @@ import (
 
 // Config defines global payments config.
 type Config struct {
-	CommissionPercent float64            `json:"commissionPercent"`
+	CommissionPercent float64            `json:"commissionPercent" help:"commission in percents applied to transfers" default:"0" validate:"min=0,max=100" reload:"true"`
 	Ethereum          paymentseth.Config `json:"ethereum"`
 	Bitcoin           paymentsbtc.Config `json:"bitcoin"`
 }
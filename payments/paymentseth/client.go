@@ -0,0 +1,43 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paymentseth
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ensures that nodes implements Client.
+var _ Client = (*nodes)(nil)
+
+// Client is a part of ethereum node api transfers depend on. it is implemented by the failover client
+// on top of configured nodes, and could be implemented on top of simulated chain in tests.
+type Client interface {
+	// ChainID returns chain id of the node.
+	ChainID(ctx context.Context) (*big.Int, error)
+	// PendingNonceAt returns nonce of the account including pending transactions.
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	// SuggestGasPrice returns gas price suggested by the node.
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	// EstimateGas returns gas needed for the call.
+	EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error)
+	// SendTransaction sends signed transaction to the network.
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	// TransactionReceipt returns receipt of mined transaction, ethereum.NotFound if it is not mined yet.
+	TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error)
+	// PendingBalanceAt returns balance of the account including pending transactions.
+	PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error)
+	// BalanceAt returns balance of the account at the block, latest block if number is nil.
+	BalanceAt(ctx context.Context, account common.Address, number *big.Int) (*big.Int, error)
+	// HeaderByNumber returns block header with the number, latest header if number is nil.
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	// BlockByNumber returns block with the number, latest block if number is nil.
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	// SyncProgress returns sync progress of the node, nil if it is not syncing.
+	SyncProgress(ctx context.Context) (*ethereum.SyncProgress, error)
+}
@@ -0,0 +1,252 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paymentseth
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"paxful/payments"
+)
+
+// GasPriceStrategy defines how gas price is chosen.
+type GasPriceStrategy string
+
+const (
+	// GasPriceStrategyNode uses gas price suggested by the node.
+	GasPriceStrategyNode GasPriceStrategy = "node"
+	// GasPriceStrategyPercentile uses percentile of gas prices paid in recent blocks.
+	GasPriceStrategyPercentile GasPriceStrategy = "percentile"
+	// GasPriceStrategyFixed uses configured gas price.
+	GasPriceStrategyFixed GasPriceStrategy = "fixed"
+)
+
+// CeilingPolicy defines what happens with transfer when gas price exceeds the ceiling.
+type CeilingPolicy string
+
+const (
+	// CeilingPolicyReject rejects transfer immediately.
+	CeilingPolicyReject CeilingPolicy = "reject"
+	// CeilingPolicyWait keeps transfer until gas price drops below the ceiling, or rejects it after max wait.
+	CeilingPolicyWait CeilingPolicy = "wait"
+)
+
+// GasOracleConfig contains configuration for gas price oracle.
+type GasOracleConfig struct {
+	Strategy         GasPriceStrategy `json:"strategy" help:"gas price strategy: node, percentile or fixed (uses gasPriceInWei), fixed if empty and gasPriceInWei is set, node otherwise" default:"" validate:"oneof=node|percentile|fixed" reload:"true"`
+	Blocks           int              `json:"blocks" help:"amount of recent blocks used by percentile strategy" default:"20" validate:"min=1" reload:"true"`
+	SlowPercentile   float64          `json:"slowPercentile" help:"percentile of recent gas prices for slow transfers" default:"30" validate:"min=0,max=100" reload:"true"`
+	NormalPercentile float64          `json:"normalPercentile" help:"percentile of recent gas prices for normal transfers" default:"60" validate:"min=0,max=100" reload:"true"`
+	FastPercentile   float64          `json:"fastPercentile" help:"percentile of recent gas prices for fast transfers" default:"90" validate:"min=0,max=100" reload:"true"`
+	SlowMultiplier   float64          `json:"slowMultiplier" help:"multiplier of node or fixed gas price for slow transfers" default:"0.9" reload:"true"`
+	FastMultiplier   float64          `json:"fastMultiplier" help:"multiplier of node or fixed gas price for fast transfers" default:"1.25" reload:"true"`
+	MaxGasPriceInWei int64            `json:"maxGasPriceInWei" help:"hard maximum gas price, 0 means no limit" default:"0" validate:"min=0" reload:"true"`
+	OnCeiling        CeilingPolicy    `json:"onCeiling" help:"what to do when gas price exceeds maximum: reject or wait" default:"reject" validate:"oneof=reject|wait" reload:"true"`
+	MaxWait          time.Duration    `json:"maxWait" help:"how long transfer waits for gas price to drop with wait policy" default:"5m" reload:"true"`
+	PollInterval     time.Duration    `json:"pollInterval" help:"how often gas price is checked with wait policy" default:"15s" reload:"true"`
+}
+
+// gasOracle chooses gas price for the transfer according to the strategy and urgency.
+type gasOracle struct {
+	config        GasOracleConfig
+	fixedGasPrice int64
+	eth           Client
+	metrics       *metrics
+
+	mu sync.Mutex
+	// cache keeps sorted gas prices of recent blocks until new block arrives.
+	cacheHead   uint64
+	cachePrices []*big.Int
+}
+
+// newGasOracle is a constructor for gasOracle.
+func newGasOracle(config Config, eth Client, metrics *metrics) *gasOracle {
+	oracle := &gasOracle{
+		config:        config.GasOracle,
+		fixedGasPrice: config.GasPriceInWei,
+		eth:           eth,
+		metrics:       metrics,
+	}
+
+	// keeps previous behaviour when strategy is not configured.
+	if oracle.config.Strategy == "" {
+		oracle.config.Strategy = GasPriceStrategyNode
+		if config.GasPriceInWei != 0 {
+			oracle.config.Strategy = GasPriceStrategyFixed
+		}
+	}
+
+	return oracle
+}
+
+// GasPrice returns gas price for the urgency which does not exceed the ceiling.
+// depending on ceiling policy it waits for the price to drop or returns GasPriceTooHighError.
+func (oracle *gasOracle) GasPrice(ctx context.Context, urgency payments.Urgency) (*big.Int, error) {
+	price, err := oracle.price(ctx, urgency)
+	if err != nil || oracle.withinCeiling(price) {
+		return price, err
+	}
+
+	if oracle.config.OnCeiling != CeilingPolicyWait {
+		return nil, oracle.tooHigh(price)
+	}
+
+	pollInterval := oracle.config.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = 15 * time.Second
+	}
+
+	deadline := time.NewTimer(oracle.config.MaxWait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, oracle.tooHigh(price)
+		case <-ticker.C:
+		}
+
+		price, err = oracle.price(ctx, urgency)
+		if err != nil || oracle.withinCeiling(price) {
+			return price, err
+		}
+	}
+}
+
+// price returns gas price for the urgency according to the strategy.
+func (oracle *gasOracle) price(ctx context.Context, urgency payments.Urgency) (*big.Int, error) {
+	switch oracle.config.Strategy {
+	case GasPriceStrategyFixed:
+		return oracle.multiply(big.NewInt(oracle.fixedGasPrice), urgency), nil
+	case GasPriceStrategyPercentile:
+		return oracle.percentile(ctx, urgency)
+	case GasPriceStrategyNode:
+		start := time.Now()
+		price, err := oracle.eth.SuggestGasPrice(ctx)
+		oracle.metrics.observe("SuggestGasPrice", start, err)
+		if err != nil {
+			return nil, Error.Wrap(err)
+		}
+
+		return oracle.multiply(price, urgency), nil
+	default:
+		return nil, Error.New("unknown gas price strategy %q", oracle.config.Strategy)
+	}
+}
+
+// multiply applies urgency multiplier to the price.
+func (oracle *gasOracle) multiply(price *big.Int, urgency payments.Urgency) *big.Int {
+	multiplier := 1.0
+	switch urgency {
+	case payments.UrgencySlow:
+		multiplier = oracle.config.SlowMultiplier
+	case payments.UrgencyFast:
+		multiplier = oracle.config.FastMultiplier
+	}
+	if multiplier <= 0 {
+		return price
+	}
+
+	result, _ := new(big.Float).Mul(new(big.Float).SetInt(price), big.NewFloat(multiplier)).Int(nil)
+	return result
+}
+
+// percentile returns percentile of gas prices paid in recent blocks for the urgency.
+func (oracle *gasOracle) percentile(ctx context.Context, urgency payments.Urgency) (*big.Int, error) {
+	prices, err := oracle.recentPrices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(prices) == 0 {
+		// empty blocks, falling back to node suggestion with urgency multiplier, the same as node strategy.
+		start := time.Now()
+		price, err := oracle.eth.SuggestGasPrice(ctx)
+		oracle.metrics.observe("SuggestGasPrice", start, err)
+		if err != nil {
+			return nil, Error.Wrap(err)
+		}
+
+		return oracle.multiply(price, urgency), nil
+	}
+
+	percentile := oracle.config.NormalPercentile
+	switch urgency {
+	case payments.UrgencySlow:
+		percentile = oracle.config.SlowPercentile
+	case payments.UrgencyFast:
+		percentile = oracle.config.FastPercentile
+	}
+	percentile = math.Max(0, math.Min(100, percentile))
+
+	index := int(math.Ceil(percentile/100*float64(len(prices)))) - 1
+	if index < 0 {
+		index = 0
+	}
+
+	return new(big.Int).Set(prices[index]), nil
+}
+
+// recentPrices returns sorted gas prices of transactions in recent blocks.
+func (oracle *gasOracle) recentPrices(ctx context.Context) ([]*big.Int, error) {
+	start := time.Now()
+	head, err := oracle.eth.HeaderByNumber(ctx, nil)
+	oracle.metrics.observe("HeaderByNumber", start, err)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	oracle.mu.Lock()
+	defer oracle.mu.Unlock()
+
+	if oracle.cachePrices != nil && oracle.cacheHead == head.Number.Uint64() {
+		return oracle.cachePrices, nil
+	}
+
+	blocks := oracle.config.Blocks
+	if blocks <= 0 {
+		blocks = 20
+	}
+
+	prices := []*big.Int{}
+	number := new(big.Int).Set(head.Number)
+	for i := 0; i < blocks && number.Sign() >= 0; i++ {
+		start = time.Now()
+		block, err := oracle.eth.BlockByNumber(ctx, number)
+		oracle.metrics.observe("BlockByNumber", start, err)
+		if err != nil {
+			return nil, Error.Wrap(err)
+		}
+
+		for _, tx := range block.Transactions() {
+			prices = append(prices, tx.GasPrice())
+		}
+
+		number.Sub(number, big.NewInt(1))
+	}
+
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Cmp(prices[j]) < 0 })
+
+	oracle.cacheHead = head.Number.Uint64()
+	oracle.cachePrices = prices
+
+	return prices, nil
+}
+
+// withinCeiling checks that price does not exceed maximum gas price.
+func (oracle *gasOracle) withinCeiling(price *big.Int) bool {
+	return oracle.config.MaxGasPriceInWei == 0 || price.Cmp(big.NewInt(oracle.config.MaxGasPriceInWei)) <= 0
+}
+
+// tooHigh returns error which indicates that price exceeds the ceiling.
+func (oracle *gasOracle) tooHigh(price *big.Int) error {
+	return payments.GasPriceTooHighError.New("gas price %s wei exceeds maximum %d wei", price, oracle.config.MaxGasPriceInWei)
+}
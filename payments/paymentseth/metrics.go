@@ -0,0 +1,75 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paymentseth
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics holds ethereum node rpc instrumentation.
+type metrics struct {
+	rpcDuration *prometheus.HistogramVec
+
+	nodeUp      *prometheus.GaugeVec
+	nodeHead    *prometheus.GaugeVec
+	nodeLatency *prometheus.GaugeVec
+	failovers   prometheus.Counter
+}
+
+// newMetrics creates ethereum metrics and registers them in the registerer.
+func newMetrics(registerer prometheus.Registerer) (*metrics, error) {
+	m := &metrics{
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "paxful",
+			Subsystem: "eth",
+			Name:      "rpc_duration_seconds",
+			Help:      "Latency of ethereum node rpc calls.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "status"}),
+		nodeUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "paxful",
+			Subsystem: "eth",
+			Name:      "node_up",
+			Help:      "Whether ethereum node could be used, 0 means its circuit is open or it is on another chain.",
+		}, []string{"node"}),
+		nodeHead: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "paxful",
+			Subsystem: "eth",
+			Name:      "node_head_block",
+			Help:      "Latest block reported by ethereum node.",
+		}, []string{"node"}),
+		nodeLatency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "paxful",
+			Subsystem: "eth",
+			Name:      "node_latency_seconds",
+			Help:      "Smoothed latency of ethereum node health checks.",
+		}, []string{"node"}),
+		failovers: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "paxful",
+			Subsystem: "eth",
+			Name:      "node_failovers_total",
+			Help:      "Amount of switches to another ethereum node because current one failed.",
+		}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.rpcDuration, m.nodeUp, m.nodeHead, m.nodeLatency, m.failovers} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// observe records latency of the rpc method call started at start.
+func (m *metrics) observe(method string, start time.Time, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+
+	m.rpcDuration.WithLabelValues(method, status).Observe(time.Since(start).Seconds())
+}
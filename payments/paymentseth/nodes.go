@@ -0,0 +1,633 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paymentseth
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/zeebo/errs"
+
+	"paxful/internal/logger"
+	"paxful/payments"
+)
+
+// FailoverConfig defines how ethereum nodes are checked and selected.
+type FailoverConfig struct {
+	FallbackURLs     []string      `json:"fallbackUrls" help:"ethereum node rpc urls which are used when primary url fails, could contain api keys" secret:"true"`
+	HealthInterval   time.Duration `json:"healthInterval" help:"how often latency and latest block of every node are checked" default:"15s"`
+	FailureThreshold int           `json:"failureThreshold" help:"consecutive failures after which node is not used until cooldown passes" default:"3" validate:"min=1"`
+	Cooldown         time.Duration `json:"cooldown" help:"how long failed node is not used before it is tried again" default:"30s"`
+	BroadcastNodes   int           `json:"broadcastNodes" help:"amount of nodes every transaction is sent to for propagation" default:"2" validate:"min=1"`
+}
+
+// node is a single ethereum node endpoint.
+type node struct {
+	// name is a host of the node, url could contain api key, so it is never logged.
+	name   string
+	client *ethclient.Client
+
+	mu sync.Mutex
+	// verified is set once node reports expected chain id, mismatch is set if it reports another one.
+	verified  bool
+	mismatch  error
+	failures  int
+	openUntil time.Time
+	latency   time.Duration
+	head      uint64
+}
+
+// available returns true if node is on expected chain and its circuit is closed or cooldown has passed.
+func (node *node) available(now time.Time) bool {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	return node.mismatch == nil && !now.Before(node.openUntil)
+}
+
+// state returns verification, latency and latest block of the node.
+func (node *node) state() (verified bool, latency time.Duration, head uint64) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	return node.verified, node.latency, node.head
+}
+
+// nodes is an ethereum client on top of several nodes. calls go to the current node, and switch
+// to another available one when it fails. node is switched to only if its latest block is not older
+// than blocks already seen, so reads never go back in chain history.
+type nodes struct {
+	log     logger.Logger
+	config  FailoverConfig
+	chainID *big.Int
+	metrics *metrics
+
+	endpoints []*node
+
+	mu      sync.Mutex
+	current *node
+	// floor is the latest block seen through any call, nodes behind it are not switched to.
+	floor uint64
+}
+
+// dialNodes creates client of the nodes, primary url is preferred until latency of nodes is known.
+// nodes are checked for expected chain id on the first use.
+func dialNodes(log logger.Logger, urls []string, chainID *big.Int, config FailoverConfig, metrics *metrics) (*nodes, error) {
+	nodes := &nodes{
+		log:     log,
+		config:  config,
+		chainID: chainID,
+		metrics: metrics,
+	}
+
+	names := make(map[string]bool)
+	for _, rawURL := range urls {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || parsed.Host == "" {
+			nodes.close()
+			return nil, Error.New("node url #%d is not valid", len(nodes.endpoints)+1)
+		}
+
+		client, err := ethclient.Dial(rawURL)
+		if err != nil {
+			nodes.close()
+			return nil, Error.Wrap(err)
+		}
+
+		name := parsed.Host
+		for i := 2; names[name]; i++ {
+			name = parsed.Host + "#" + strconv.Itoa(i)
+		}
+		names[name] = true
+
+		nodes.endpoints = append(nodes.endpoints, &node{name: name, client: client})
+		metrics.nodeUp.WithLabelValues(name).Set(1)
+	}
+
+	return nodes, nil
+}
+
+// close closes connections to all nodes.
+func (nodes *nodes) close() {
+	for _, endpoint := range nodes.endpoints {
+		endpoint.client.Close()
+	}
+}
+
+// Run checks latency and latest block of every node each health interval until ctx is done.
+func (nodes *nodes) Run(ctx context.Context) error {
+	interval := nodes.config.HealthInterval
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		nodes.check(ctx, interval)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// check asks every node for the latest block, including nodes with open circuit, so recovered nodes
+// are used again before cooldown passes. faster node which is not behind becomes current one.
+func (nodes *nodes) check(ctx context.Context, timeout time.Duration) {
+	var group sync.WaitGroup
+	for _, endpoint := range nodes.endpoints {
+		group.Add(1)
+		go func(endpoint *node) {
+			defer group.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			if err := nodes.verify(checkCtx, endpoint); err != nil {
+				return
+			}
+
+			start := time.Now()
+			head, err := endpoint.client.HeaderByNumber(checkCtx, nil)
+			if err != nil {
+				if ctx.Err() == nil {
+					nodes.fail(endpoint, err)
+				}
+				return
+			}
+
+			nodes.succeed(endpoint, head.Number.Uint64(), time.Since(start))
+		}(endpoint)
+	}
+	group.Wait()
+
+	nodes.rebalance()
+}
+
+// rebalance makes the fastest available node current if it is noticeably faster and not behind current one.
+func (nodes *nodes) rebalance() {
+	nodes.mu.Lock()
+	defer nodes.mu.Unlock()
+
+	if nodes.current == nil {
+		return
+	}
+
+	_, currentLatency, currentHead := nodes.current.state()
+	for _, endpoint := range nodes.candidates(map[*node]bool{nodes.current: true}) {
+		verified, latency, head := endpoint.state()
+		if !verified || latency == 0 || head < currentHead || head < nodes.floor {
+			continue
+		}
+
+		// candidates are ordered by latency, small differences are ignored, so current node does not flap.
+		if currentLatency == 0 || latency < currentLatency*4/5 {
+			nodes.log.Info("switching to faster ethereum node",
+				logger.String("from", nodes.current.name), logger.String("to", endpoint.name))
+			nodes.current = endpoint
+		}
+		return
+	}
+}
+
+// candidates returns available nodes which are not excluded: current node first,
+// then nodes ordered by latency, nodes with unknown latency are kept in configuration order.
+func (nodes *nodes) candidates(exclude map[*node]bool) []*node {
+	now := time.Now()
+
+	var candidates []*node
+	for _, endpoint := range nodes.endpoints {
+		if !exclude[endpoint] && endpoint.available(now) {
+			candidates = append(candidates, endpoint)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i] == nodes.current || candidates[j] == nodes.current {
+			return candidates[i] == nodes.current
+		}
+
+		_, left, _ := candidates[i].state()
+		_, right, _ := candidates[j].state()
+		if left == 0 || right == 0 {
+			return left != 0 && right == 0
+		}
+		return left < right
+	})
+
+	return candidates
+}
+
+// pick returns node calls should go to, nodes from tried are skipped.
+// node is verified and checked to be not behind blocks seen before it is returned.
+func (nodes *nodes) pick(ctx context.Context, tried map[*node]bool) (*node, error) {
+	nodes.mu.Lock()
+	candidates := nodes.candidates(tried)
+	current, floor := nodes.current, nodes.floor
+	nodes.mu.Unlock()
+
+	var group errs.Group
+	for _, endpoint := range candidates {
+		if err := nodes.prepare(ctx, endpoint, floor); err != nil {
+			tried[endpoint] = true
+			group.Add(err)
+			continue
+		}
+
+		if endpoint != current {
+			nodes.switchTo(endpoint, current)
+		}
+		return endpoint, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	return nil, Error.New("no ethereum node is available: %v", group.Err())
+}
+
+// prepare verifies chain id of the node and checks that its latest block is not behind the floor.
+func (nodes *nodes) prepare(ctx context.Context, endpoint *node, floor uint64) error {
+	if err := nodes.verify(ctx, endpoint); err != nil {
+		return err
+	}
+
+	if _, _, head := endpoint.state(); head >= floor {
+		return nil
+	}
+
+	// latest block of the node could be already newer than the last health check shows.
+	head, err := endpoint.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		if ctx.Err() == nil {
+			nodes.fail(endpoint, err)
+		}
+		return Error.New("%s: %v", endpoint.name, err)
+	}
+
+	nodes.observeHead(endpoint, head.Number.Uint64())
+	if head.Number.Uint64() < floor {
+		return Error.New("%s is behind: block %d, seen %d", endpoint.name, head.Number.Uint64(), floor)
+	}
+
+	return nil
+}
+
+// verify checks that node reports expected chain id, node on another chain is never used.
+func (nodes *nodes) verify(ctx context.Context, endpoint *node) error {
+	endpoint.mu.Lock()
+	verified, mismatch := endpoint.verified, endpoint.mismatch
+	endpoint.mu.Unlock()
+
+	if verified {
+		return nil
+	}
+	if mismatch != nil {
+		return mismatch
+	}
+
+	chainID, err := endpoint.client.ChainID(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			nodes.fail(endpoint, err)
+		}
+		return Error.New("%s: %v", endpoint.name, err)
+	}
+
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+
+	if chainID.Cmp(nodes.chainID) != 0 {
+		endpoint.mismatch = payments.NetworkMismatchError.New("%s chain id %s, expected %s", endpoint.name, chainID, nodes.chainID)
+		nodes.metrics.nodeUp.WithLabelValues(endpoint.name).Set(0)
+		nodes.log.Error("ethereum node is on another chain, it is not used", endpoint.mismatch)
+		return endpoint.mismatch
+	}
+
+	endpoint.verified = true
+	return nil
+}
+
+// verifyAll checks chain id of every node. returns NetworkMismatchError if any node is on another chain,
+// unreachable nodes are verified on the first use, but at least one node must be verified.
+func (nodes *nodes) verifyAll(ctx context.Context) error {
+	var group errs.Group
+	verified := false
+	for _, endpoint := range nodes.endpoints {
+		err := nodes.verify(ctx, endpoint)
+		if payments.NetworkMismatchError.Has(err) {
+			return err
+		}
+
+		group.Add(err)
+		verified = verified || err == nil
+	}
+
+	if !verified {
+		return Error.New("no ethereum node could be verified: %v", group.Err())
+	}
+
+	return nil
+}
+
+// switchTo makes the node current one, switching from failed node is counted as failover.
+func (nodes *nodes) switchTo(endpoint, previous *node) {
+	nodes.mu.Lock()
+	defer nodes.mu.Unlock()
+
+	if nodes.current != previous {
+		// another call has already switched.
+		return
+	}
+	nodes.current = endpoint
+
+	if previous != nil {
+		nodes.metrics.failovers.Inc()
+		nodes.log.Warn("switching to another ethereum node",
+			logger.String("from", previous.name), logger.String("to", endpoint.name))
+	}
+}
+
+// fail records failed call, circuit of the node is opened after FailureThreshold consecutive failures.
+func (nodes *nodes) fail(endpoint *node, err error) {
+	threshold := nodes.config.FailureThreshold
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+
+	endpoint.failures++
+	if endpoint.failures < threshold {
+		return
+	}
+
+	// after cooldown a single failure opens circuit again.
+	endpoint.failures = threshold - 1
+	endpoint.openUntil = time.Now().Add(nodes.config.Cooldown)
+	nodes.metrics.nodeUp.WithLabelValues(endpoint.name).Set(0)
+	nodes.log.Error("ethereum node is not used until cooldown passes", err,
+		logger.String("node", endpoint.name), logger.Any("cooldown", nodes.config.Cooldown.String()))
+}
+
+// succeed records successful health check with the latest block and latency, circuit of the node is closed.
+func (nodes *nodes) succeed(endpoint *node, head uint64, latency time.Duration) {
+	endpoint.mu.Lock()
+	endpoint.failures = 0
+	endpoint.openUntil = time.Time{}
+	// latency is smoothed, so a single slow response does not change the order of nodes.
+	if endpoint.latency == 0 {
+		endpoint.latency = latency
+	} else {
+		endpoint.latency = (endpoint.latency*7 + latency*3) / 10
+	}
+	smoothed := endpoint.latency
+	endpoint.mu.Unlock()
+
+	nodes.observeHead(endpoint, head)
+	nodes.metrics.nodeUp.WithLabelValues(endpoint.name).Set(1)
+	nodes.metrics.nodeLatency.WithLabelValues(endpoint.name).Set(smoothed.Seconds())
+}
+
+// observeHead records the latest block of the node, floor is raised if the node is current one.
+func (nodes *nodes) observeHead(endpoint *node, head uint64) {
+	endpoint.mu.Lock()
+	if head > endpoint.head {
+		endpoint.head = head
+	}
+	endpoint.mu.Unlock()
+
+	nodes.metrics.nodeHead.WithLabelValues(endpoint.name).Set(float64(head))
+
+	nodes.mu.Lock()
+	if endpoint == nodes.current && head > nodes.floor {
+		nodes.floor = head
+	}
+	nodes.mu.Unlock()
+}
+
+// call runs fn with the client of current node, and retries it with other nodes while nodes fail.
+// errors returned by the node itself, e.g. reverted estimation, are not retried.
+func (nodes *nodes) call(ctx context.Context, fn func(client *ethclient.Client) error) error {
+	return nodes.callExcept(ctx, make(map[*node]bool), func(endpoint *node) error {
+		return fn(endpoint.client)
+	})
+}
+
+// callExcept is the same as call, but nodes from tried are skipped and fn gets the node it is called with.
+func (nodes *nodes) callExcept(ctx context.Context, tried map[*node]bool, fn func(endpoint *node) error) error {
+	var failures errs.Group
+	for {
+		endpoint, err := nodes.pick(ctx, tried)
+		if err != nil {
+			failures.Add(err)
+			return failures.Err()
+		}
+
+		err = fn(endpoint)
+		if !nodeFailure(ctx, err) {
+			return err
+		}
+
+		nodes.fail(endpoint, err)
+		tried[endpoint] = true
+		failures.Add(Error.New("%s: %v", endpoint.name, err))
+	}
+}
+
+// nodeFailure returns true if err means that node could not serve the call,
+// so it could be retried with another node.
+func nodeFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+
+	// node has responded with json-rpc error.
+	var rpcErr rpc.Error
+	return !errors.As(err, &rpcErr)
+}
+
+// alreadyKnown returns true if node rejected transaction because it already has it.
+func alreadyKnown(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "already known") || strings.Contains(message, "known transaction") ||
+		strings.Contains(message, "already imported")
+}
+
+// SendTransaction sends transaction to current node and to other verified nodes up to BroadcastNodes
+// at the same time for faster propagation. transaction is sent if any node accepts it or already has it.
+func (nodes *nodes) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	tried := make(map[*node]bool)
+
+	primary, err := nodes.pick(ctx, tried)
+	if err != nil {
+		return err
+	}
+
+	targets := []*node{primary}
+	nodes.mu.Lock()
+	candidates := nodes.candidates(map[*node]bool{primary: true})
+	nodes.mu.Unlock()
+	for _, endpoint := range candidates {
+		if len(targets) >= nodes.config.BroadcastNodes {
+			break
+		}
+		if verified, _, _ := endpoint.state(); verified {
+			targets = append(targets, endpoint)
+		}
+	}
+
+	results := make([]error, len(targets))
+	var group sync.WaitGroup
+	for i, endpoint := range targets {
+		tried[endpoint] = true
+
+		group.Add(1)
+		go func(i int, endpoint *node) {
+			defer group.Done()
+
+			results[i] = endpoint.client.SendTransaction(ctx, tx)
+			if nodeFailure(ctx, results[i]) {
+				nodes.fail(endpoint, results[i])
+			}
+		}(i, endpoint)
+	}
+	group.Wait()
+
+	allFailed := true
+	for _, err := range results {
+		if err == nil || alreadyKnown(err) {
+			return nil
+		}
+		allFailed = allFailed && nodeFailure(ctx, err)
+	}
+
+	// rejection of the primary node is the reason transaction is not sent.
+	if !allFailed {
+		return results[0]
+	}
+
+	// none of the nodes has responded, transaction is sent to the rest of nodes one by one.
+	return nodes.callExcept(ctx, tried, func(endpoint *node) error {
+		err := endpoint.client.SendTransaction(ctx, tx)
+		if err != nil && alreadyKnown(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// HeaderByNumber returns block header with the number, latest header if number is nil.
+func (nodes *nodes) HeaderByNumber(ctx context.Context, number *big.Int) (header *types.Header, err error) {
+	// head is attributed to the node which answered, it could differ from current one after failover.
+	var answered *node
+	err = nodes.callExcept(ctx, make(map[*node]bool), func(endpoint *node) error {
+		answered = endpoint
+		header, err = endpoint.client.HeaderByNumber(ctx, number)
+		return err
+	})
+	if err == nil && number == nil {
+		nodes.observeHead(answered, header.Number.Uint64())
+	}
+	return header, err
+}
+
+// BlockByNumber returns block with the number, latest block if number is nil.
+func (nodes *nodes) BlockByNumber(ctx context.Context, number *big.Int) (block *types.Block, err error) {
+	err = nodes.call(ctx, func(client *ethclient.Client) error {
+		block, err = client.BlockByNumber(ctx, number)
+		return err
+	})
+	return block, err
+}
+
+// ChainID returns chain id every node is verified to have, NetworkMismatchError if any node is on another chain.
+func (nodes *nodes) ChainID(ctx context.Context) (*big.Int, error) {
+	if err := nodes.verifyAll(ctx); err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).Set(nodes.chainID), nil
+}
+
+// PendingNonceAt returns nonce of the account including pending transactions.
+func (nodes *nodes) PendingNonceAt(ctx context.Context, account common.Address) (nonce uint64, err error) {
+	err = nodes.call(ctx, func(client *ethclient.Client) error {
+		nonce, err = client.PendingNonceAt(ctx, account)
+		return err
+	})
+	return nonce, err
+}
+
+// PendingBalanceAt returns balance of the account including pending transactions.
+func (nodes *nodes) PendingBalanceAt(ctx context.Context, account common.Address) (balance *big.Int, err error) {
+	err = nodes.call(ctx, func(client *ethclient.Client) error {
+		balance, err = client.PendingBalanceAt(ctx, account)
+		return err
+	})
+	return balance, err
+}
+
+// BalanceAt returns balance of the account at the block, latest block if number is nil.
+func (nodes *nodes) BalanceAt(ctx context.Context, account common.Address, number *big.Int) (balance *big.Int, err error) {
+	err = nodes.call(ctx, func(client *ethclient.Client) error {
+		balance, err = client.BalanceAt(ctx, account, number)
+		return err
+	})
+	return balance, err
+}
+
+// SuggestGasPrice returns gas price suggested by the node.
+func (nodes *nodes) SuggestGasPrice(ctx context.Context) (price *big.Int, err error) {
+	err = nodes.call(ctx, func(client *ethclient.Client) error {
+		price, err = client.SuggestGasPrice(ctx)
+		return err
+	})
+	return price, err
+}
+
+// EstimateGas returns gas needed for the call.
+func (nodes *nodes) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (gas uint64, err error) {
+	err = nodes.call(ctx, func(client *ethclient.Client) error {
+		gas, err = client.EstimateGas(ctx, msg)
+		return err
+	})
+	return gas, err
+}
+
+// TransactionReceipt returns receipt of mined transaction, ethereum.NotFound if it is not mined yet.
+func (nodes *nodes) TransactionReceipt(ctx context.Context, hash common.Hash) (receipt *types.Receipt, err error) {
+	err = nodes.call(ctx, func(client *ethclient.Client) error {
+		receipt, err = client.TransactionReceipt(ctx, hash)
+		return err
+	})
+	return receipt, err
+}
+
+// SyncProgress returns sync progress of current node, nil if it is not syncing.
+func (nodes *nodes) SyncProgress(ctx context.Context) (progress *ethereum.SyncProgress, err error) {
+	err = nodes.call(ctx, func(client *ethclient.Client) error {
+		progress, err = client.SyncProgress(ctx)
+		return err
+	})
+	return progress, err
+}
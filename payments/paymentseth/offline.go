@@ -0,0 +1,274 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paymentseth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"paxful/internal/logger"
+	"paxful/payments"
+)
+
+// ensures that Transactions implements payments.OfflineTransactions.
+var _ payments.OfflineTransactions = (*Transactions)(nil)
+
+// offlineParams are ethereum parameters of a transfer prepared for offline signing.
+// big numbers are decimal strings, so they are not rounded by json tools.
+type offlineParams struct {
+	ChainID      string `json:"chainId"`
+	Nonce        uint64 `json:"nonce"`
+	Value        string `json:"value"`
+	GasPrice     string `json:"gasPrice"`
+	GasLimit     uint64 `json:"gasLimit"`
+	GasEstimated uint64 `json:"gasEstimated,omitempty"`
+}
+
+// transaction builds unsigned transaction from the params.
+func (params offlineParams) transaction(to string) (*types.Transaction, *big.Int, error) {
+	chainID, ok := new(big.Int).SetString(params.ChainID, 10)
+	if !ok {
+		return nil, nil, payments.ValidationError.New("chain id %q is not a decimal number", params.ChainID)
+	}
+	value, ok := new(big.Int).SetString(params.Value, 10)
+	if !ok {
+		return nil, nil, payments.ValidationError.New("value %q is not a decimal number", params.Value)
+	}
+	gasPrice, ok := new(big.Int).SetString(params.GasPrice, 10)
+	if !ok {
+		return nil, nil, payments.ValidationError.New("gas price %q is not a decimal number", params.GasPrice)
+	}
+	if !common.IsHexAddress(to) {
+		return nil, nil, payments.ValidationError.New("receiver address is not valid Hex address")
+	}
+
+	return types.NewTransaction(params.Nonce, common.HexToAddress(to), value, params.GasLimit, gasPrice, nil), chainID, nil
+}
+
+// Prepare returns unsigned transfer from the address with nonce, gas and chain id filled.
+// nonce is the pending nonce of the address, so transfers from the same address
+// must be broadcasted before the next one is prepared.
+func (t *Transactions) Prepare(ctx context.Context, tx payments.Transaction, from string) (payments.UnsignedTransaction, error) {
+	if !common.IsHexAddress(from) {
+		return payments.UnsignedTransaction{}, payments.ValidationError.New("sender address is not valid Hex address")
+	}
+	if err := t.ValidateAddress(tx.To); err != nil {
+		return payments.UnsignedTransaction{}, err
+	}
+	sender, to := common.HexToAddress(from), common.HexToAddress(tx.To)
+
+	settings := t.current()
+
+	start := time.Now()
+	nonce, err := t.eth.PendingNonceAt(ctx, sender)
+	t.metrics.observe("PendingNonceAt", start, err)
+	if err != nil {
+		return payments.UnsignedTransaction{}, Error.Wrap(err)
+	}
+
+	// amount is converted the same way as for transfers from the hot wallet.
+	weiAmount := FloatToBigInt(applyCommission(tx.Amount, settings.commissionPercent))
+
+	gasPrice, err := settings.oracle.GasPrice(ctx, tx.Urgency)
+	if err != nil {
+		return payments.UnsignedTransaction{}, err
+	}
+
+	gasEstimated, gasLimit, err := t.gasLimit(ctx, settings.config, sender, to, weiAmount, gasPrice)
+	if err != nil {
+		return payments.UnsignedTransaction{}, err
+	}
+
+	start = time.Now()
+	balance, err := t.eth.PendingBalanceAt(ctx, sender)
+	t.metrics.observe("PendingBalanceAt", start, err)
+	if err != nil {
+		return payments.UnsignedTransaction{}, Error.Wrap(err)
+	}
+
+	cost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit))
+	cost.Add(cost, weiAmount)
+	if balance.Cmp(cost) < 0 {
+		return payments.UnsignedTransaction{}, payments.InsufficientFundsError.New("balance %s wei is less than amount with fee %s wei", balance, cost)
+	}
+
+	chainID, err := t.chain(ctx)
+	if err != nil {
+		return payments.UnsignedTransaction{}, err
+	}
+
+	params, err := json.Marshal(offlineParams{
+		ChainID:      chainID.String(),
+		Nonce:        nonce,
+		Value:        weiAmount.String(),
+		GasPrice:     gasPrice.String(),
+		GasLimit:     gasLimit,
+		GasEstimated: gasEstimated,
+	})
+	if err != nil {
+		return payments.UnsignedTransaction{}, Error.Wrap(err)
+	}
+
+	return payments.UnsignedTransaction{
+		Currency:  payments.PaymentCurrencyETH,
+		Network:   settings.config.Network.Name,
+		From:      sender.String(),
+		To:        to.String(),
+		Amount:    tx.Amount,
+		Urgency:   tx.Urgency,
+		Params:    params,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Sign signs prepared transfer with the private key of its sender, node is not needed.
+func Sign(unsigned payments.UnsignedTransaction, privateKey *ecdsa.PrivateKey) (payments.SignedTransaction, error) {
+	if unsigned.Currency != payments.PaymentCurrencyETH {
+		return payments.SignedTransaction{}, payments.ValidationError.New("%s transaction could not be signed as ethereum one", unsigned.Currency)
+	}
+
+	if address := crypto.PubkeyToAddress(privateKey.PublicKey); !strings.EqualFold(address.String(), unsigned.From) {
+		return payments.SignedTransaction{}, payments.ValidationError.New("key of %s could not sign transaction from %s", address.String(), unsigned.From)
+	}
+
+	var params offlineParams
+	if err := json.Unmarshal(unsigned.Params, &params); err != nil {
+		return payments.SignedTransaction{}, payments.ValidationError.Wrap(err)
+	}
+
+	unsignedTx, chainID, err := params.transaction(unsigned.To)
+	if err != nil {
+		return payments.SignedTransaction{}, err
+	}
+
+	signedTx, err := types.SignTx(unsignedTx, types.NewEIP155Signer(chainID), privateKey)
+	if err != nil {
+		return payments.SignedTransaction{}, Error.Wrap(err)
+	}
+
+	raw, err := rlp.EncodeToBytes(signedTx)
+	if err != nil {
+		return payments.SignedTransaction{}, Error.Wrap(err)
+	}
+
+	return payments.SignedTransaction{
+		UnsignedTransaction: unsigned,
+		ID:                  signedTx.Hash().String(),
+		Raw:                 hexutil.Encode(raw),
+	}, nil
+}
+
+// Broadcast checks that signed transfer matches its parameters and node network, and sends it.
+func (t *Transactions) Broadcast(ctx context.Context, signed payments.SignedTransaction) (payments.Transaction, error) {
+	network := t.Network()
+	if signed.Network == "" {
+		return payments.Transaction{}, payments.ValidationError.New("network of the transaction is not set")
+	}
+	if err := network.CheckNetwork(signed.Network); err != nil {
+		return payments.Transaction{}, payments.ValidationError.Wrap(err)
+	}
+
+	signedTx, params, err := verifySigned(signed)
+	if err != nil {
+		return payments.Transaction{}, err
+	}
+
+	chainID, err := t.chain(ctx)
+	if err != nil {
+		return payments.Transaction{}, err
+	}
+	if chainID.Cmp(signedTx.ChainId()) != 0 {
+		return payments.Transaction{}, payments.ValidationError.Wrap(payments.NetworkMismatchError.New("transaction is signed for chain %s, %q network chain is %s", signedTx.ChainId(), network.Name, chainID))
+	}
+
+	logger.FromContext(ctx, t.log).Debug("sending offline signed ethereum transaction",
+		logger.String("txID", signedTx.Hash().String()),
+		logger.Any("nonce", signedTx.Nonce()),
+		logger.String("from", signed.From),
+		logger.String("chainID", chainID.String()),
+	)
+
+	start := time.Now()
+	err = t.eth.SendTransaction(ctx, signedTx)
+	t.metrics.observe("SendTransaction", start, err)
+	if err != nil {
+		return payments.Transaction{}, payments.BroadcastError.Wrap(Error.Wrap(err))
+	}
+
+	return payments.Transaction{
+		ID:           signedTx.Hash().String(),
+		Currency:     payments.PaymentCurrencyETH,
+		Network:      network.Name,
+		Amount:       signed.Amount,
+		Value:        BigIntToFloat(signedTx.Value()),
+		Fee:          signedTx.GasPrice().Int64(),
+		From:         common.HexToAddress(signed.From).String(),
+		To:           signedTx.To().String(),
+		Urgency:      signed.Urgency,
+		GasEstimated: params.GasEstimated,
+		GasLimit:     signedTx.Gas(),
+		CreatedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// verifySigned decodes signed transaction and checks that its sender, receiver and parameters
+// are the same as described, so stored record matches what is sent.
+func verifySigned(signed payments.SignedTransaction) (*types.Transaction, offlineParams, error) {
+	if signed.Currency != payments.PaymentCurrencyETH {
+		return nil, offlineParams{}, payments.ValidationError.New("%s transaction could not be broadcasted as ethereum one", signed.Currency)
+	}
+
+	var params offlineParams
+	if err := json.Unmarshal(signed.Params, &params); err != nil {
+		return nil, offlineParams{}, payments.ValidationError.Wrap(err)
+	}
+
+	expected, chainID, err := params.transaction(signed.To)
+	if err != nil {
+		return nil, offlineParams{}, err
+	}
+
+	raw, err := hexutil.Decode(signed.Raw)
+	if err != nil {
+		return nil, offlineParams{}, payments.ValidationError.New("raw transaction is not hex encoded: %v", err)
+	}
+
+	signedTx := new(types.Transaction)
+	if err = rlp.DecodeBytes(raw, signedTx); err != nil {
+		return nil, offlineParams{}, payments.ValidationError.New("raw transaction could not be decoded: %v", err)
+	}
+
+	if !signedTx.Protected() || signedTx.ChainId().Cmp(chainID) != 0 {
+		return nil, offlineParams{}, payments.ValidationError.New("transaction is not signed for chain %s", chainID)
+	}
+
+	sender, err := types.Sender(types.NewEIP155Signer(chainID), signedTx)
+	if err != nil {
+		return nil, offlineParams{}, payments.ValidationError.Wrap(err)
+	}
+
+	switch {
+	case !strings.EqualFold(sender.String(), signed.From):
+		return nil, offlineParams{}, payments.ValidationError.New("transaction is signed by %s, not %s", sender.String(), signed.From)
+	case signedTx.To() == nil || *signedTx.To() != *expected.To():
+		return nil, offlineParams{}, payments.ValidationError.New("transaction receiver does not match %s", signed.To)
+	case signedTx.Nonce() != expected.Nonce(), signedTx.Value().Cmp(expected.Value()) != 0,
+		signedTx.GasPrice().Cmp(expected.GasPrice()) != 0, signedTx.Gas() != expected.Gas(), len(signedTx.Data()) != 0:
+		return nil, offlineParams{}, payments.ValidationError.New("signed transaction does not match its params")
+	case signed.ID != "" && signed.ID != signedTx.Hash().String():
+		return nil, offlineParams{}, payments.ValidationError.New("transaction id does not match signed transaction")
+	}
+
+	return signedTx, params, nil
+}
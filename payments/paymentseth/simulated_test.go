@@ -0,0 +1,271 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paymentseth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap/zapcore"
+
+	"paxful/internal/logger/zaplog/zaplogtest"
+	"paxful/payments"
+	"paxful/payments/paymentseth"
+)
+
+// ensures that simulated implements paymentseth.Client.
+var _ paymentseth.Client = (*simulated)(nil)
+
+const (
+	// simulatedChainID is a chain id of go-ethereum simulated chain.
+	simulatedChainID = 1337
+	// gasPrice is a fixed gas price in wei transfers are sent with.
+	gasPrice = 1000000000
+	// transferGas is gas used by plain ether transfer.
+	transferGas = 21000
+)
+
+// simulated is an in-memory ethereum chain, transactions are mined only with Commit.
+// errors could be injected into any method to simulate failing node.
+type simulated struct {
+	*backends.SimulatedBackend
+
+	mu       sync.Mutex
+	failures map[string]error
+	// nonceLag is subtracted from pending nonce to simulate node which has not seen the latest transactions.
+	nonceLag uint64
+}
+
+// fail makes every call of the method return err until it is cleared with nil err.
+func (backend *simulated) fail(method string, err error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	if err == nil {
+		delete(backend.failures, method)
+		return
+	}
+	backend.failures[method] = err
+}
+
+// failure returns error injected into the method.
+func (backend *simulated) failure(method string) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	return backend.failures[method]
+}
+
+func (backend *simulated) ChainID(ctx context.Context) (*big.Int, error) {
+	if err := backend.failure("ChainID"); err != nil {
+		return nil, err
+	}
+	return big.NewInt(simulatedChainID), nil
+}
+
+func (backend *simulated) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	if err := backend.failure("PendingNonceAt"); err != nil {
+		return 0, err
+	}
+	nonce, err := backend.SimulatedBackend.PendingNonceAt(ctx, account)
+	if err != nil {
+		return 0, err
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.nonceLag > nonce {
+		return 0, nil
+	}
+	return nonce - backend.nonceLag, nil
+}
+
+// lag makes pending nonce lag behind by the amount of transactions.
+func (backend *simulated) lag(transactions uint64) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	backend.nonceLag = transactions
+}
+
+func (backend *simulated) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	if err := backend.failure("SuggestGasPrice"); err != nil {
+		return nil, err
+	}
+	return backend.SimulatedBackend.SuggestGasPrice(ctx)
+}
+
+func (backend *simulated) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	if err := backend.failure("EstimateGas"); err != nil {
+		return 0, err
+	}
+	return backend.SimulatedBackend.EstimateGas(ctx, msg)
+}
+
+// SendTransaction adds transaction to the pending block. simulated chain panics on invalid transaction,
+// e.g. with reused nonce, so it is returned as error the same way a node rejects it.
+func (backend *simulated) SendTransaction(ctx context.Context, tx *types.Transaction) (err error) {
+	if err := backend.failure("SendTransaction"); err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	return backend.SimulatedBackend.SendTransaction(ctx, tx)
+}
+
+// TransactionReceipt returns ethereum.NotFound for not mined transaction like a node does.
+func (backend *simulated) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	if err := backend.failure("TransactionReceipt"); err != nil {
+		return nil, err
+	}
+
+	receipt, err := backend.SimulatedBackend.TransactionReceipt(ctx, hash)
+	if err == nil && receipt == nil {
+		return nil, ethereum.NotFound
+	}
+	return receipt, err
+}
+
+// PendingBalanceAt returns balance in the latest block, simulated chain does not expose pending balances.
+func (backend *simulated) PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	if err := backend.failure("PendingBalanceAt"); err != nil {
+		return nil, err
+	}
+	return backend.SimulatedBackend.BalanceAt(ctx, account, nil)
+}
+
+func (backend *simulated) BalanceAt(ctx context.Context, account common.Address, number *big.Int) (*big.Int, error) {
+	if err := backend.failure("BalanceAt"); err != nil {
+		return nil, err
+	}
+	return backend.SimulatedBackend.BalanceAt(ctx, account, number)
+}
+
+func (backend *simulated) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if err := backend.failure("HeaderByNumber"); err != nil {
+		return nil, err
+	}
+	return backend.SimulatedBackend.HeaderByNumber(ctx, number)
+}
+
+func (backend *simulated) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	if err := backend.failure("BlockByNumber"); err != nil {
+		return nil, err
+	}
+	return backend.SimulatedBackend.BlockByNumber(ctx, number)
+}
+
+// SyncProgress returns nil, simulated chain is never syncing.
+func (backend *simulated) SyncProgress(ctx context.Context) (*ethereum.SyncProgress, error) {
+	return nil, backend.failure("SyncProgress")
+}
+
+// harness is eth transactions on top of simulated chain with funded hot wallet.
+type harness struct {
+	backend      *simulated
+	transactions *paymentseth.Transactions
+
+	hotWallet *ecdsa.PrivateKey
+	receiver  common.Address
+}
+
+// newHarness creates harness with hot wallet funded with balance in wei, it must be closed after use.
+// configure could change config before transactions are created.
+func newHarness(t *testing.T, balance *big.Int, commissionPercent float64, configure func(*paymentseth.Config)) *harness {
+	hotWallet, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := paymentseth.Config{
+		Network:       payments.NetworkConfig{Name: "simulated", Confirmations: 1},
+		ChainID:       simulatedChainID,
+		PrivateKey:    hex.EncodeToString(crypto.FromECDSA(hotWallet)),
+		GasMultiplier: 1.2,
+		MaxGasLimit:   500000,
+		GasPriceInWei: gasPrice,
+		GasOracle: paymentseth.GasOracleConfig{
+			Strategy:  paymentseth.GasPriceStrategyFixed,
+			OnCeiling: paymentseth.CeilingPolicyReject,
+		},
+	}
+	if configure != nil {
+		configure(&config)
+	}
+
+	backend := &simulated{
+		SimulatedBackend: backends.NewSimulatedBackend(core.GenesisAlloc{
+			crypto.PubkeyToAddress(hotWallet.PublicKey): {Balance: balance},
+		}, 8000000),
+		failures: make(map[string]error),
+	}
+
+	log, _ := zaplogtest.NewObserver(zapcore.InfoLevel)
+	transactions, err := paymentseth.NewTransactionsWithClient(log, config, commissionPercent, backend, prometheus.NewRegistry())
+	if err != nil {
+		_ = backend.Close()
+		t.Fatal(err)
+	}
+
+	return &harness{
+		backend:      backend,
+		transactions: transactions,
+		hotWallet:    hotWallet,
+		receiver:     crypto.PubkeyToAddress(receiver.PublicKey),
+	}
+}
+
+// close stops simulated chain.
+func (harness *harness) close() {
+	_ = harness.backend.Close()
+}
+
+// hotWalletAddress returns address of the hot wallet.
+func (harness *harness) hotWalletAddress() common.Address {
+	return crypto.PubkeyToAddress(harness.hotWallet.PublicKey)
+}
+
+// transfer returns transfer of the amount in ether to the receiver.
+func (harness *harness) transfer(amount float64) payments.Transaction {
+	return payments.Transaction{
+		Currency: payments.PaymentCurrencyETH,
+		Amount:   amount,
+		To:       harness.receiver.String(),
+	}
+}
+
+// balance returns balance of the address in the latest block.
+func (harness *harness) balance(t *testing.T, address common.Address) *big.Int {
+	balance, err := harness.backend.BalanceAt(context.Background(), address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+// ether returns amount of ether in wei.
+func ether(amount int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(amount), big.NewInt(1000000000000000000))
+}
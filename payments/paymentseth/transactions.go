@@ -6,122 +6,485 @@ package paymentseth
 import (
 	"context"
 	"crypto/ecdsa"
+	"errors"
+	"math"
 	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/zeebo/errs"
 
 	"paxful/internal/logger"
 	"paxful/payments"
 )
 
-// ensures that transactions implements payments.Transactions.
-var _ payments.Transactions = (*transactions)(nil)
+// ensures that Transactions implements payments.Transactions.
+var _ payments.Transactions = (*Transactions)(nil)
 
 // Error is an error class for internal ethereum transaction service error.
 var Error = errs.Class("ethereum transaction error")
 
 // Config stores needed information for eth payment service initialization.
 type Config struct {
-	URL           string `json:"url"`
-	PrivateKey    string `json:"privateKey"`
-	GasLimit      uint64 `json:"gasLimit"`
-	GasPriceInWei int64  `json:"gasPriceInWei"`
+	Network       payments.NetworkConfig `json:"network"`
+	ChainID       uint64                 `json:"chainId" help:"expected chain id of the node, 0 means chain id of well known network name: mainnet, ropsten, rinkeby, goerli or kovan" default:"0"`
+	URL           string                 `json:"url" help:"primary ethereum node rpc url, could contain api key" validate:"required,url" secret:"true"`
+	Failover      FailoverConfig         `json:"failover"`
+	PrivateKey    string                 `json:"privateKey" help:"hex encoded private key of the hot wallet" validate:"required,hex=32" secret:"true"`
+	GasLimit      uint64                 `json:"gasLimit" help:"fixed gas limit which overrides estimation, 0 means gas is estimated for every transfer" default:"0" reload:"true"`
+	GasMultiplier float64                `json:"gasMultiplier" help:"safety multiplier applied to estimated gas" default:"1.2" validate:"min=1" reload:"true"`
+	MaxGasLimit   uint64                 `json:"maxGasLimit" help:"upper cap of gas limit, transfers which need more gas are rejected" default:"500000" reload:"true"`
+	GasPriceInWei int64                  `json:"gasPriceInWei" help:"gas price for fixed gas price strategy" default:"0" validate:"min=0" reload:"true"`
+	GasOracle     GasOracleConfig        `json:"gasOracle"`
+	MinBalance    float64                `json:"minBalance" help:"minimal hot wallet balance in ether for service to be healthy" default:"0"`
+	LowWatermark  float64                `json:"lowWatermark" help:"hot wallet balance in ether below which low balance alert is emitted" default:"0"`
 }
 
-// transactions is an ETH implementation of paxful payment service.
-type transactions struct {
-	log    logger.Logger
-	config Config
+// Transactions is an ETH implementation of paxful payment service.
+type Transactions struct {
+	log logger.Logger
 
-	commissionPercent float64
+	eth     Client
+	metrics *metrics
+	// nodes is the failover client eth is set to, nil if transactions are created with another client.
+	nodes *nodes
+
+	// settings holds current *settings, they are replaced as a whole on reload.
+	settings atomic.Value
+
+	// sending serializes transfers from the hot wallet, so concurrent transfers never get the same nonce.
+	sending sync.Mutex
+	// nonces keeps the last nonce sent from every account, guarded by sending.
+	// node after failover could have not seen the last sent transaction, so its pending nonce is not trusted alone.
+	nonces map[common.Address]uint64
+
+	// chainID is an expected chain id of the network, verified is set once node reports the same one.
+	chainID  *big.Int
+	verified int32
+}
 
-	eth *ethclient.Client
+// chainIDs are chain ids of well known networks.
+var chainIDs = map[string]uint64{
+	"mainnet": 1,
+	"ropsten": 3,
+	"rinkeby": 4,
+	"goerli":  5,
+	"kovan":   42,
 }
 
 // NewClient is a constructor for a ETH client.
-func NewTransactions(log logger.Logger, config Config, commissionPercent float64) (payments.Transactions, error) {
-	client, err := ethclient.Dial(config.URL)
+// node rpc metrics are registered in the registerer, fallback nodes are used when primary one fails.
+func NewTransactions(log logger.Logger, config Config, commissionPercent float64, registerer prometheus.Registerer) (*Transactions, error) {
+	chainID, err := expectedChainID(config)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics, err := newMetrics(registerer)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	urls := append([]string{config.URL}, config.Failover.FallbackURLs...)
+	nodes, err := dialNodes(log, urls, chainID, config.Failover, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	t := newTransactions(log, config, commissionPercent, nodes, metrics, chainID)
+	t.nodes = nodes
+	return t, nil
+}
+
+// NewTransactionsWithClient creates transactions which use the client instead of configured nodes,
+// e.g. simulated chain. config url and failover are ignored, node rpc metrics are registered in the registerer.
+func NewTransactionsWithClient(log logger.Logger, config Config, commissionPercent float64, client Client, registerer prometheus.Registerer) (*Transactions, error) {
+	chainID, err := expectedChainID(config)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics, err := newMetrics(registerer)
 	if err != nil {
 		return nil, Error.Wrap(err)
 	}
 
-	return &transactions{
-		log:               log,
-		eth:               client,
+	return newTransactions(log, config, commissionPercent, client, metrics, chainID), nil
+}
+
+// newTransactions creates transactions with the client.
+func newTransactions(log logger.Logger, config Config, commissionPercent float64, client Client, metrics *metrics, chainID *big.Int) *Transactions {
+	t := &Transactions{
+		log:     log,
+		eth:     client,
+		metrics: metrics,
+		chainID: chainID,
+		nonces:  make(map[common.Address]uint64),
+	}
+	t.settings.Store(t.newSettings(config, commissionPercent))
+
+	return t
+}
+
+// expectedChainID returns configured chain id, or chain id of well known network.
+func expectedChainID(config Config) (*big.Int, error) {
+	chainID := config.ChainID
+	if chainID == 0 {
+		chainID = chainIDs[config.Network.Name]
+	}
+	if chainID == 0 {
+		return nil, Error.New("chainId must be set for %q network", config.Network.Name)
+	}
+
+	return new(big.Int).SetUint64(chainID), nil
+}
+
+// settings are gas and commission settings which could be reloaded without restart.
+type settings struct {
+	config            Config
+	commissionPercent float64
+	oracle            *gasOracle
+}
+
+// newSettings creates settings with gas oracle for the config.
+func (t *Transactions) newSettings(config Config, commissionPercent float64) *settings {
+	return &settings{
 		config:            config,
 		commissionPercent: commissionPercent,
-	}, nil
+		oracle:            newGasOracle(config, t.eth, t.metrics),
+	}
+}
+
+// current returns settings every transfer is sent with from start to end.
+func (t *Transactions) current() *settings {
+	return t.settings.Load().(*settings)
+}
+
+// Reload replaces gas and commission settings, transfers which are already in-flight are not affected.
+// network, nodes and private key could not be changed without restart.
+func (t *Transactions) Reload(config Config, commissionPercent float64) error {
+	current := t.current().config
+	if config.URL != current.URL || config.PrivateKey != current.PrivateKey ||
+		config.Network != current.Network || config.ChainID != current.ChainID ||
+		!reflect.DeepEqual(config.Failover, current.Failover) {
+		return Error.New("network, nodes and private key could not be reloaded")
+	}
+
+	t.settings.Store(t.newSettings(config, commissionPercent))
+	return nil
 }
 
 // Commit injects a signed transaction into the pending pool for execution.
-func (t *transactions) Commit(ctx context.Context, tx payments.Transaction) (payments.Transaction, error) {
-	privateKey, err := crypto.HexToECDSA(t.config.PrivateKey)
+func (t *Transactions) Commit(ctx context.Context, tx payments.Transaction) (payments.Transaction, error) {
+	privateKey, from, err := t.account()
 	if err != nil {
-		return payments.Transaction{}, Error.Wrap(err)
+		return payments.Transaction{}, err
 	}
 
-	publicKeyECDSA, ok := privateKey.Public().(*ecdsa.PublicKey)
-	if !ok {
-		return payments.Transaction{}, payments.ValidationError.New("public key could not be converted to ECDSA")
+	if err = t.ValidateAddress(tx.To); err != nil {
+		return payments.Transaction{}, err
 	}
+	to := common.HexToAddress(tx.To)
 
-	from := crypto.PubkeyToAddress(*publicKeyECDSA)
-	nonce, err := t.eth.PendingNonceAt(ctx, from)
-	if err != nil {
-		return payments.Transaction{}, Error.Wrap(err)
-	}
+	log := logger.FromContext(ctx, t.log)
+	settings := t.current()
 
 	// we assume that transaction amount field were in "wei" currency.
-	weiAmount := FloatToBigInt(t.applyCommission(tx.Amount))
+	weiAmount := FloatToBigInt(applyCommission(tx.Amount, settings.commissionPercent))
 
-	// in case when we don't want to configure gas price manually.
-	gasPrice := big.NewInt(t.config.GasPriceInWei)
-	if t.config.GasPriceInWei == 0 {
-		gasPrice, err = t.eth.SuggestGasPrice(ctx)
-		if err != nil {
-			return payments.Transaction{}, Error.Wrap(err)
-		}
+	// gas price could wait for the ceiling, so it is resolved before other transfers are blocked.
+	gasPrice, err := settings.oracle.GasPrice(ctx, tx.Urgency)
+	if err != nil {
+		return payments.Transaction{}, err
 	}
 
-	if !common.IsHexAddress(tx.To) {
-		return payments.Transaction{}, payments.ValidationError.New("receiver address is not valid Hex address")
+	gasEstimated, gasLimit, err := t.gasLimit(ctx, settings.config, from, to, weiAmount, gasPrice)
+	if err != nil {
+		return payments.Transaction{}, err
 	}
 
-	unsignedTx := types.NewTransaction(nonce, common.HexToAddress(tx.To), weiAmount, t.config.GasLimit, gasPrice, nil)
+	chainID, err := t.chain(ctx)
+	if err != nil {
+		return payments.Transaction{}, err
+	}
 
-	// signing transaction.
-	chainID, err := t.eth.NetworkID(ctx)
+	t.sending.Lock()
+	defer t.sending.Unlock()
+
+	start := time.Now()
+	nonce, err := t.eth.PendingNonceAt(ctx, from)
+	t.metrics.observe("PendingNonceAt", start, err)
 	if err != nil {
 		return payments.Transaction{}, Error.Wrap(err)
 	}
+	if last, ok := t.nonces[from]; ok && last+1 > nonce {
+		nonce = last + 1
+	}
 
+	// checking funds before signing, so node error is not the first sign of empty wallet.
+	// pending balance includes transfers sent before, so it is checked under the lock.
+	start = time.Now()
+	balance, err := t.eth.PendingBalanceAt(ctx, from)
+	t.metrics.observe("PendingBalanceAt", start, err)
+	if err != nil {
+		return payments.Transaction{}, Error.Wrap(err)
+	}
+
+	cost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit))
+	cost.Add(cost, weiAmount)
+	if balance.Cmp(cost) < 0 {
+		return payments.Transaction{}, payments.InsufficientFundsError.New("balance %s wei is less than amount with fee %s wei", balance, cost)
+	}
+
+	// signing transaction.
+	unsignedTx := types.NewTransaction(nonce, to, weiAmount, gasLimit, gasPrice, nil)
 	signedTx, err := types.SignTx(unsignedTx, types.NewEIP155Signer(chainID), privateKey)
 	if err != nil {
 		return payments.Transaction{}, Error.Wrap(err)
 	}
 
+	log.Debug("sending ethereum transaction",
+		logger.String("txID", signedTx.Hash().String()),
+		logger.Any("nonce", nonce),
+		logger.String("gasPrice", gasPrice.String()),
+		logger.Any("gasEstimated", gasEstimated),
+		logger.Any("gasLimit", gasLimit),
+		logger.String("chainID", chainID.String()),
+	)
+
 	// transferring assets.
+	start = time.Now()
 	err = t.eth.SendTransaction(ctx, signedTx)
+	t.metrics.observe("SendTransaction", start, err)
 	if err != nil {
-		return payments.Transaction{}, Error.Wrap(err)
+		return payments.Transaction{}, payments.BroadcastError.Wrap(Error.Wrap(err))
 	}
+	t.nonces[from] = nonce
 
 	tx.ID = signedTx.Hash().String()
+	tx.Network = settings.config.Network.Name
 	tx.CreatedAt = time.Now().UTC()
 	tx.From = from.String()
+	tx.Value = BigIntToFloat(weiAmount)
 	tx.Fee = gasPrice.Int64()
+	tx.GasEstimated = gasEstimated
+	tx.GasLimit = gasLimit
 
 	return tx, nil
 }
 
+// gasLimit returns gas estimated by the node and gas limit for the transfer.
+// estimation is multiplied by safety multiplier and capped, configured gas limit overrides estimation.
+func (t *Transactions) gasLimit(ctx context.Context, config Config, from, to common.Address, value, gasPrice *big.Int) (estimated, limit uint64, err error) {
+	if config.GasLimit != 0 {
+		return 0, config.GasLimit, nil
+	}
+
+	start := time.Now()
+	estimated, err = t.eth.EstimateGas(ctx, ethereum.CallMsg{
+		From:     from,
+		To:       &to,
+		GasPrice: gasPrice,
+		Value:    value,
+	})
+	t.metrics.observe("EstimateGas", start, err)
+	if err != nil {
+		// node refuses to estimate transfer which exceeds balance, so it is not reported as node failure.
+		if strings.Contains(err.Error(), "insufficient funds") {
+			return 0, 0, payments.InsufficientFundsError.Wrap(err)
+		}
+		return 0, 0, Error.Wrap(err)
+	}
+
+	if config.MaxGasLimit != 0 && estimated > config.MaxGasLimit {
+		return estimated, 0, payments.ValidationError.New("estimated gas %d exceeds maximum gas limit %d", estimated, config.MaxGasLimit)
+	}
+
+	multiplier := config.GasMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	limit = uint64(math.Ceil(float64(estimated) * multiplier))
+	if config.MaxGasLimit != 0 && limit > config.MaxGasLimit {
+		limit = config.MaxGasLimit
+	}
+
+	return estimated, limit, nil
+}
+
+// Ping checks that ethereum node is reachable and synced.
+func (t *Transactions) Ping(ctx context.Context) error {
+	start := time.Now()
+	progress, err := t.eth.SyncProgress(ctx)
+	t.metrics.observe("SyncProgress", start, err)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	// progress is nil when node is not syncing.
+	if progress != nil {
+		return Error.New("node is syncing: block %d of %d", progress.CurrentBlock, progress.HighestBlock)
+	}
+
+	return nil
+}
+
+// Balance returns current balance of the hot wallet in ether.
+func (t *Transactions) Balance(ctx context.Context) (float64, error) {
+	_, from, err := t.account()
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	balance, err := t.eth.BalanceAt(ctx, from, nil)
+	t.metrics.observe("BalanceAt", start, err)
+	if err != nil {
+		return 0, Error.Wrap(err)
+	}
+
+	return BigIntToFloat(balance), nil
+}
+
+// AddressBalance returns current balance of the address in ether.
+func (t *Transactions) AddressBalance(ctx context.Context, address string) (float64, error) {
+	if err := t.ValidateAddress(address); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	balance, err := t.eth.BalanceAt(ctx, common.HexToAddress(address), nil)
+	t.metrics.observe("BalanceAt", start, err)
+	if err != nil {
+		return 0, Error.Wrap(err)
+	}
+
+	return BigIntToFloat(balance), nil
+}
+
+// Status returns receipt of sent transaction.
+func (t *Transactions) Status(ctx context.Context, id string) (payments.Receipt, error) {
+	start := time.Now()
+	receipt, err := t.eth.TransactionReceipt(ctx, common.HexToHash(id))
+	t.metrics.observe("TransactionReceipt", start, err)
+	if err != nil {
+		// receipt is not available until transaction is mined.
+		if errors.Is(err, ethereum.NotFound) {
+			return payments.Receipt{Status: payments.TransactionStatusSuccess}, nil
+		}
+		return payments.Receipt{}, Error.Wrap(err)
+	}
+
+	// transaction is not final until enough blocks are mined on top of it.
+	if confirmations := t.current().config.Network.Confirmations; confirmations > 1 {
+		start = time.Now()
+		head, err := t.eth.HeaderByNumber(ctx, nil)
+		t.metrics.observe("HeaderByNumber", start, err)
+		if err != nil {
+			return payments.Receipt{}, Error.Wrap(err)
+		}
+
+		depth := new(big.Int).Sub(head.Number, receipt.BlockNumber)
+		if depth.Int64()+1 < confirmations {
+			return payments.Receipt{Status: payments.TransactionStatusSuccess, GasUsed: receipt.GasUsed, Mined: true}, nil
+		}
+	}
+
+	status := payments.TransactionStatusConfirmed
+	if receipt.Status == types.ReceiptStatusFailed {
+		status = payments.TransactionStatusFailed
+	}
+
+	return payments.Receipt{Status: status, GasUsed: receipt.GasUsed, Mined: true}, nil
+}
+
+// Network returns network the transfers are sent to.
+func (t *Transactions) Network() payments.NetworkConfig {
+	return t.current().config.Network
+}
+
+// VerifyNetwork checks that every node reports expected chain id.
+func (t *Transactions) VerifyNetwork(ctx context.Context) error {
+	start := time.Now()
+	chainID, err := t.eth.ChainID(ctx)
+	t.metrics.observe("ChainID", start, err)
+	if err != nil {
+		if payments.NetworkMismatchError.Has(err) {
+			return err
+		}
+		return Error.Wrap(err)
+	}
+
+	if chainID.Cmp(t.chainID) != 0 {
+		return payments.NetworkMismatchError.New("node chain id %s, %q network chain id %s", chainID, t.Network().Name, t.chainID)
+	}
+
+	atomic.StoreInt32(&t.verified, 1)
+	return nil
+}
+
+// chain returns chain id transactions are signed for. nodes are checked until they match once,
+// so nothing is signed before nodes are known to be on the configured network.
+// node which is not reachable yet is verified before its first use.
+func (t *Transactions) chain(ctx context.Context) (*big.Int, error) {
+	if atomic.LoadInt32(&t.verified) == 1 {
+		return t.chainID, nil
+	}
+
+	if err := t.VerifyNetwork(ctx); err != nil {
+		return nil, err
+	}
+
+	return t.chainID, nil
+}
+
+// Run checks health of the nodes and switches to the faster one until ctx is done.
+// it only waits for ctx if transactions are created with another client.
+func (t *Transactions) Run(ctx context.Context) error {
+	if t.nodes == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return t.nodes.Run(ctx)
+}
+
+// ValidateAddress checks that receiver address is a valid hex address.
+func (t *Transactions) ValidateAddress(address string) error {
+	if !common.IsHexAddress(address) {
+		return payments.ValidationError.New("receiver address is not valid Hex address")
+	}
+
+	return nil
+}
+
+// account returns private key of the hot wallet and its address.
+func (t *Transactions) account() (*ecdsa.PrivateKey, common.Address, error) {
+	privateKey, err := crypto.HexToECDSA(t.current().config.PrivateKey)
+	if err != nil {
+		return nil, common.Address{}, Error.Wrap(err)
+	}
+
+	publicKeyECDSA, ok := privateKey.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, common.Address{}, payments.ValidationError.New("public key could not be converted to ECDSA")
+	}
+
+	return privateKey, crypto.PubkeyToAddress(*publicKeyECDSA), nil
+}
+
 // applyCommission calculates new amount after applying commission.
-func (t *transactions) applyCommission(amount float64) float64 {
-	return amount / 100 * t.commissionPercent
+func applyCommission(amount, commissionPercent float64) float64 {
+	return amount / 100 * commissionPercent
 }
 
 // should be placed to internal pkg.
@@ -139,3 +502,14 @@ func FloatToBigInt(val float64) *big.Int {
 
 	return result
 }
+
+// BigIntToFloat converts amount in wei to ether.
+func BigIntToFloat(val *big.Int) float64 {
+	bigval := new(big.Float).SetInt(val)
+
+	coin := new(big.Float)
+	coin.SetInt(big.NewInt(1000000000000000000))
+
+	result, _ := bigval.Quo(bigval, coin).Float64()
+	return result
+}
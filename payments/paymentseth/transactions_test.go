@@ -0,0 +1,266 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paymentseth_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/zeebo/errs"
+
+	"paxful/payments"
+	"paxful/payments/paymentseth"
+)
+
+func TestCommit(t *testing.T) {
+	ctx := context.Background()
+	harness := newHarness(t, ether(10), 100, nil)
+	defer harness.close()
+
+	tx, err := harness.transactions.Commit(ctx, harness.transfer(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switch {
+	case tx.ID == "":
+		t.Error("transaction id is not set")
+	case tx.From != harness.hotWalletAddress().String():
+		t.Errorf("sender is %s, expected hot wallet %s", tx.From, harness.hotWalletAddress().String())
+	case tx.Network != "simulated":
+		t.Errorf("network is %q, expected simulated", tx.Network)
+	case tx.Fee != gasPrice:
+		t.Errorf("fee is %d, expected fixed gas price %d", tx.Fee, gasPrice)
+	case tx.GasEstimated != transferGas || tx.GasLimit != transferGas*12/10:
+		t.Errorf("gas estimated %d and limit %d, expected %d with 1.2 multiplier", tx.GasEstimated, tx.GasLimit, transferGas)
+	}
+
+	expectStatus(t, harness, tx.ID, payments.TransactionStatusSuccess)
+	harness.backend.Commit()
+	expectStatus(t, harness, tx.ID, payments.TransactionStatusConfirmed)
+
+	if received := harness.balance(t, harness.receiver); received.Cmp(ether(1)) != 0 {
+		t.Errorf("receiver balance is %s wei, expected 1 ether", received)
+	}
+
+	spent := new(big.Int).Add(ether(1), big.NewInt(transferGas*gasPrice))
+	if balance := harness.balance(t, harness.hotWalletAddress()); balance.Cmp(new(big.Int).Sub(ether(10), spent)) != 0 {
+		t.Errorf("hot wallet balance is %s wei, expected 10 ether without %s", balance, spent)
+	}
+}
+
+func TestCommitCommission(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		amount     float64
+		commission float64
+		// expected is amount receiver gets in ether as decimal fraction, so it is not rounded.
+		expected string
+	}{
+		{amount: 10, commission: 1.5, expected: "0.15"},
+		{amount: 1, commission: 100, expected: "1"},
+		{amount: 2.5, commission: 99.5, expected: "2.4875"},
+		{amount: 0.3, commission: 50, expected: "0.15"},
+	}
+
+	for _, c := range cases {
+		harness := newHarness(t, ether(20), c.commission, nil)
+
+		if _, err := harness.transactions.Commit(ctx, harness.transfer(c.amount)); err != nil {
+			harness.close()
+			t.Fatal(err)
+		}
+		harness.backend.Commit()
+
+		expected, _ := new(big.Rat).SetString(c.expected)
+		expected.Mul(expected, new(big.Rat).SetInt(ether(1)))
+		received := harness.balance(t, harness.receiver)
+		harness.close()
+
+		// amounts are float64 in the api, so received wei could differ from the decimal amount only by rounding.
+		diff := new(big.Rat).Sub(new(big.Rat).SetInt(received), expected)
+		tolerance := new(big.Rat).Mul(expected, big.NewRat(1, 1e12))
+		if diff.Abs(diff).Cmp(tolerance) > 0 {
+			t.Errorf("%v with %v%% commission: received %s wei, expected %s ether", c.amount, c.commission, received, c.expected)
+		}
+	}
+}
+
+func TestCommitNonceRace(t *testing.T) {
+	const transfers = 8
+
+	ctx := context.Background()
+	harness := newHarness(t, ether(100), 100, nil)
+	defer harness.close()
+
+	// transfer from the same wallet by another sender, e.g. operator, takes the pending nonce.
+	nonce, err := harness.backend.PendingNonceAt(ctx, harness.hotWalletAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	external, err := types.SignTx(types.NewTransaction(nonce, harness.receiver, ether(1), transferGas, big.NewInt(gasPrice), nil),
+		types.NewEIP155Signer(big.NewInt(simulatedChainID)), harness.hotWallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = harness.backend.SendTransaction(ctx, external); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, transfers)
+	failures := make([]error, transfers)
+
+	var group sync.WaitGroup
+	for i := 0; i < transfers; i++ {
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+
+			tx, err := harness.transactions.Commit(ctx, harness.transfer(1))
+			ids[i], failures[i] = tx.ID, err
+		}(i)
+	}
+	group.Wait()
+
+	if err = errs.Combine(failures...); err != nil {
+		t.Fatal(err)
+	}
+
+	harness.backend.Commit()
+
+	nonces := make(map[uint64]bool)
+	for _, id := range ids {
+		receipt, err := harness.backend.TransactionReceipt(ctx, common.HexToHash(id))
+		if err != nil {
+			t.Fatalf("transaction %s is not mined: %v", id, err)
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			t.Fatalf("transaction %s failed", id)
+		}
+
+		tx, _, err := harness.backend.TransactionByHash(ctx, receipt.TxHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nonces[tx.Nonce()] {
+			t.Errorf("nonce %d is used twice", tx.Nonce())
+		}
+		nonces[tx.Nonce()] = true
+	}
+
+	if received := harness.balance(t, harness.receiver); received.Cmp(ether(transfers+1)) != 0 {
+		t.Errorf("receiver balance is %s wei, expected %d ether", received, transfers+1)
+	}
+}
+
+func TestCommitStaleNonce(t *testing.T) {
+	ctx := context.Background()
+	harness := newHarness(t, ether(10), 100, nil)
+	defer harness.close()
+
+	first, err := harness.transactions.Commit(ctx, harness.transfer(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// node after failover has not seen the first transfer yet.
+	harness.backend.lag(1)
+
+	second, err := harness.transactions.Commit(ctx, harness.transfer(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	harness.backend.Commit()
+
+	for _, tx := range []payments.Transaction{first, second} {
+		receipt, err := harness.backend.TransactionReceipt(ctx, common.HexToHash(tx.ID))
+		if err != nil {
+			t.Fatalf("transfer %s is not mined: %v", tx.ID, err)
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			t.Fatalf("transfer %s failed", tx.ID)
+		}
+	}
+}
+
+func TestCommitNodeErrors(t *testing.T) {
+	ctx := context.Background()
+	harness := newHarness(t, ether(1), 100, nil)
+	defer harness.close()
+
+	nodeErr := errors.New("connection refused")
+	cases := []struct {
+		name   string
+		method string
+		amount float64
+		class  *errs.Class
+	}{
+		{name: "nonce", method: "PendingNonceAt", amount: 0.1, class: &paymentseth.Error},
+		{name: "estimation", method: "EstimateGas", amount: 0.1, class: &paymentseth.Error},
+		{name: "balance", method: "PendingBalanceAt", amount: 0.1, class: &paymentseth.Error},
+		{name: "broadcast", method: "SendTransaction", amount: 0.1, class: &payments.BroadcastError},
+		{name: "insufficient funds", amount: 2, class: &payments.InsufficientFundsError},
+	}
+
+	for _, c := range cases {
+		if c.method != "" {
+			harness.backend.fail(c.method, nodeErr)
+		}
+
+		_, err := harness.transactions.Commit(ctx, harness.transfer(c.amount))
+		harness.backend.fail(c.method, nil)
+
+		if !c.class.Has(err) {
+			t.Errorf("%s: expected %q error, got %v", c.name, *c.class, err)
+		}
+	}
+
+	// nothing is sent by failed transfers.
+	nonce, err := harness.backend.PendingNonceAt(ctx, harness.hotWalletAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 0 {
+		t.Errorf("%d transactions are sent by failed transfers", nonce)
+	}
+
+	harness.backend.fail("TransactionReceipt", nodeErr)
+	if _, err = harness.transactions.Status(ctx, common.Hash{}.String()); err == nil {
+		t.Error("status: node error is not returned")
+	}
+	harness.backend.fail("TransactionReceipt", nil)
+
+	harness.backend.fail("SyncProgress", nodeErr)
+	if err = harness.transactions.Ping(ctx); err == nil {
+		t.Error("ping: node error is not returned")
+	}
+	harness.backend.fail("SyncProgress", nil)
+}
+
+func TestCommitChainMismatch(t *testing.T) {
+	harness := newHarness(t, ether(1), 100, func(config *paymentseth.Config) { config.ChainID = 1 })
+	defer harness.close()
+
+	// node of another chain is never used for signing.
+	_, err := harness.transactions.Commit(context.Background(), harness.transfer(0.1))
+	if !payments.NetworkMismatchError.Has(err) {
+		t.Errorf("expected %q error, got %v", payments.NetworkMismatchError, err)
+	}
+}
+
+// expectStatus checks status of the transaction.
+func expectStatus(t *testing.T, harness *harness, id string, expected payments.TransactionStatus) {
+	receipt, err := harness.transactions.Status(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != expected {
+		t.Errorf("status is %q, expected %q", receipt.Status, expected)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package payments
+
+import (
+	"context"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/internal/logger"
+)
+
+// TrackerError is an error class for confirmation tracker errors.
+var TrackerError = errs.Class("confirmation tracker error")
+
+// TrackerConfig contains configuration for confirmation tracker.
+type TrackerConfig struct {
+	Interval time.Duration `json:"interval" help:"how often sent transactions are checked for confirmation" default:"30s"`
+}
+
+// Tracker polls blockchain nodes and moves sent transactions to confirmed or failed status.
+//
+// architecture: Worker
+type Tracker struct {
+	log      logger.Logger
+	config   TrackerConfig
+	provider PaymentProvider
+	txDB     TransactionsDB
+	events   Publisher
+}
+
+// NewTracker is a constructor for confirmation Tracker.
+// status transitions are published to events.
+func NewTracker(log logger.Logger, config TrackerConfig, provider PaymentProvider, txDB TransactionsDB, events Publisher) *Tracker {
+	return &Tracker{
+		log:      log,
+		config:   config,
+		provider: provider,
+		txDB:     txDB,
+		events:   events,
+	}
+}
+
+// Run checks sent transactions every interval until ctx is done.
+func (tracker *Tracker) Run(ctx context.Context) error {
+	interval := tracker.config.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := tracker.Check(ctx); err != nil {
+			tracker.log.Error("could not check transactions confirmations", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check updates status of every sent, but not yet confirmed transaction.
+func (tracker *Tracker) Check(ctx context.Context) error {
+	sent, err := tracker.txDB.ListByStatus(ctx, TransactionStatusSuccess)
+	if err != nil {
+		return TrackerError.Wrap(err)
+	}
+
+	// outputs of multi-output transaction share the receipt, so node is asked once per transaction.
+	receipts := make(map[string]Receipt)
+
+	var group errs.Group
+	for _, tx := range sent {
+		if ctx.Err() != nil {
+			break
+		}
+
+		transactions, err := tracker.provider.GetByCurrency(tx.Currency)
+		if err != nil {
+			group.Add(err)
+			continue
+		}
+		// transactions of other networks are tracked by services configured for them.
+		if transactions.Network().CheckNetwork(tx.Network) != nil {
+			continue
+		}
+
+		receipt, ok := receipts[tx.ID]
+		if !ok {
+			receipt, err = transactions.Status(ctx, tx.ID)
+			if err != nil {
+				group.Add(err)
+				continue
+			}
+			receipts[tx.ID] = receipt
+		}
+		if receipt.Status == TransactionStatusSuccess {
+			// outputs of the transaction are marked at once, so the rest of them are skipped by their flag.
+			if receipt.Mined && !tx.Mined {
+				if err := tracker.txDB.MarkMined(ctx, tx.ID, receipt.GasUsed); err != nil {
+					group.Add(err)
+					continue
+				}
+				receipts[tx.ID] = Receipt{Status: TransactionStatusSuccess}
+			}
+			continue
+		}
+
+		event, err := tracker.txDB.UpdateStatus(ctx, tx.ID, tx.OutputIndex, receipt)
+		if err != nil {
+			group.Add(err)
+			continue
+		}
+		if event.ID != 0 {
+			tracker.events.Publish(event)
+		}
+
+		tracker.log.Info("transaction status changed",
+			logger.String("txID", tx.ID),
+			logger.String("currency", string(tx.Currency)),
+			logger.String("status", receipt.Status.String()),
+		)
+	}
+
+	return TrackerError.Wrap(group.Err())
+}
@@ -10,8 +10,19 @@ import (
 	"github.com/zeebo/errs"
 )
 
-// ValidationError indicates that transaction data is corrupted.
-var ValidationError = errs.Class("transaction validation error")
+var (
+	// ValidationError indicates that transaction data is corrupted.
+	ValidationError = errs.Class("transaction validation error")
+	// InsufficientFundsError indicates that hot wallet can not cover amount and fee of the transaction.
+	InsufficientFundsError = errs.Class("insufficient funds")
+	// GasPriceTooHighError indicates that network fee exceeds configured maximum.
+	GasPriceTooHighError = errs.Class("gas price too high")
+	// BroadcastError indicates that sending to the network failed, but transaction could be already accepted,
+	// so the transfer must not be retried automatically.
+	BroadcastError = errs.Class("broadcast outcome unknown")
+	// ErrTransactionNotFound indicates that transaction does not exist.
+	ErrTransactionNotFound = errs.Class("transaction not found")
+)
 
 // Transactions exposes functionality to work with asset transferring.
 //
@@ -19,6 +30,21 @@ var ValidationError = errs.Class("transaction validation error")
 type Transactions interface {
 	// Commit is used to send transaction to a receiver.
 	Commit(ctx context.Context, tx Transaction) (Transaction, error)
+	// Ping checks that blockchain node is reachable and synced.
+	Ping(ctx context.Context) error
+	// Balance returns current balance of the hot wallet.
+	Balance(ctx context.Context) (float64, error)
+	// AddressBalance returns current balance of any address in the main currency unit.
+	AddressBalance(ctx context.Context, address string) (float64, error)
+	// Status returns receipt of sent transaction,
+	// TransactionStatusSuccess means that transaction is not confirmed yet.
+	Status(ctx context.Context, id string) (Receipt, error)
+	// ValidateAddress checks that receiver address is valid for the currency, returns ValidationError otherwise.
+	ValidateAddress(address string) error
+	// Network returns network the transfers are sent to.
+	Network() NetworkConfig
+	// VerifyNetwork checks that node is on the configured network, returns NetworkMismatchError otherwise.
+	VerifyNetwork(ctx context.Context) error
 }
 
 // TransactionsDB exposes functionality to manage transactions database.
@@ -26,20 +52,135 @@ type Transactions interface {
 // architecture: Database
 type TransactionsDB interface {
 	// Commit is used to create new transaction record in TransactionDB.
-	Commit(ctx context.Context, tx Transaction) error
+	// EventTransactionCreated is written to the outbox in the same db transaction and returned.
+	Commit(ctx context.Context, tx Transaction) (Event, error)
 	// List is used to return all transactions.
 	List(ctx context.Context) ([]Transaction, error)
+	// ListByStatus is used to return all transactions with the status.
+	ListByStatus(ctx context.Context, status TransactionStatus) ([]Transaction, error)
+	// Find returns transactions matching the filter, newest first.
+	Find(ctx context.Context, filter TransactionFilter) ([]Transaction, error)
+	// Get returns all outputs of the transaction ordered by output index, returns ErrTransactionNotFound if there is none.
+	Get(ctx context.Context, id string) ([]Transaction, error)
+	// UpdateStatus changes status of the transaction output and stores receipt data,
+	// corresponding event is written to the outbox in the same db transaction and returned.
+	// returned event has zero id if transaction already had the status.
+	UpdateStatus(ctx context.Context, id string, outputIndex int, receipt Receipt) (Event, error)
+	// MarkMined marks all not yet confirmed outputs of the transaction as included to the block and stores gas used.
+	MarkMined(ctx context.Context, id string, gasUsed uint64) error
+	// Events returns up to limit outbox events with id greater than afterID ordered by id.
+	Events(ctx context.Context, afterID int64, limit int) ([]Event, error)
+}
+
+// Publisher exposes functionality to notify in-process listeners about transaction events.
+type Publisher interface {
+	// Publish sends event to all current listeners without blocking.
+	Publish(event Event)
 }
 
 // Transaction stores information about asset transferring.
 type Transaction struct {
-	ID        string          `json:"id"`
-	Currency  PaymentCurrency `json:"currency"`
-	Amount    float64         `json:"amount"`
-	Fee       int64           `json:"fee"`
-	From      string          `json:"from"`
-	To        string          `json:"to"`
-	CreatedAt time.Time       `json:"createAt"`
+	ID       string          `json:"id"`
+	Currency PaymentCurrency `json:"currency"`
+	// Network is a name of the network transaction is sent to.
+	Network string  `json:"network"`
+	Amount  float64 `json:"amount"`
+	// Value is an amount received by the receiver, commission is already applied to it.
+	Value float64 `json:"value"`
+	// Fee is a gas price in wei for ethereum and a fee share in satoshis for bitcoin.
+	Fee    int64             `json:"fee"`
+	From   string            `json:"from"`
+	To     string            `json:"to"`
+	Status TransactionStatus `json:"status"`
+	// Urgency affects network fee the transaction is sent with.
+	Urgency Urgency `json:"urgency,omitempty"`
+	// OutputIndex is an index of the transaction output which pays to the receiver,
+	// transactions which share the same multi-output blockchain transaction have the same ID.
+	// index is negative if output could not be read, such transactions have unknown status.
+	OutputIndex int `json:"outputIndex"`
+	// GasEstimated is a gas amount estimated by the node before sending.
+	GasEstimated uint64 `json:"gasEstimated,omitempty"`
+	// GasLimit is a gas limit the transaction was sent with.
+	GasLimit uint64 `json:"gasLimit,omitempty"`
+	// GasUsed is an actual gas amount spent by the transaction, known after confirmation.
+	GasUsed uint64 `json:"gasUsed,omitempty"`
+	// Mined is true once transaction is included to the block, even if it is not confirmed yet.
+	Mined     bool      `json:"mined"`
+	CreatedAt time.Time `json:"createAt"`
+	// ExplorerURL is a link to the transaction in the network explorer, it is not stored.
+	ExplorerURL string `json:"explorerUrl,omitempty"`
+}
+
+// TransactionFilter selects transactions, zero fields match any value.
+type TransactionFilter struct {
+	Currency PaymentCurrency
+	Network  string
+	Status   *TransactionStatus
+	To       string
+	// Since and Until bound creation time, Until is exclusive.
+	Since time.Time
+	Until time.Time
+	// Limit is a maximum amount of returned transactions, 0 means no limit.
+	Limit int
+}
+
+// Urgency defines how fast transaction should be included to the blockchain, affects network fee.
+type Urgency string
+
+const (
+	// UrgencySlow is the cheapest fee, transaction could wait for a long time.
+	UrgencySlow Urgency = "slow"
+	// UrgencyNormal is a regular fee.
+	UrgencyNormal Urgency = "normal"
+	// UrgencyFast is the highest fee, transaction should be included as soon as possible.
+	UrgencyFast Urgency = "fast"
+)
+
+// UrgencyFromString creates Urgency from string, empty string means normal urgency.
+// returns error if urgency is not supported.
+func UrgencyFromString(urgency string) (Urgency, error) {
+	switch urgency {
+	case "", string(UrgencyNormal):
+		return UrgencyNormal, nil
+	case string(UrgencySlow):
+		return UrgencySlow, nil
+	case string(UrgencyFast):
+		return UrgencyFast, nil
+	default:
+		return "", ValidationError.New("urgency %q is not supported", urgency)
+	}
+}
+
+// Outgoing returns amount which leaves the hot wallet for the transaction in the main currency unit,
+// it is a value received by the receiver and network fee. Gas limit is used while gas used is unknown.
+func (tx Transaction) Outgoing() float64 {
+	switch tx.Currency {
+	case PaymentCurrencyETH:
+		gas := tx.GasUsed
+		if gas == 0 {
+			gas = tx.GasLimit
+		}
+		return tx.Value + float64(tx.Fee)*float64(gas)/weiPerEther
+	case PaymentCurrencyBTC:
+		return tx.Value + float64(tx.Fee)/satoshisPerBitcoin
+	default:
+		return tx.Value
+	}
+}
+
+const (
+	// weiPerEther is an amount of wei in one ether.
+	weiPerEther = 1e18
+	// satoshisPerBitcoin is an amount of satoshis in one bitcoin.
+	satoshisPerBitcoin = 1e8
+)
+
+// Receipt describes result of sent transaction.
+type Receipt struct {
+	Status  TransactionStatus
+	GasUsed uint64
+	// Mined is true if transaction is included to the block, receipts of final statuses are always mined.
+	Mined bool
 }
 
 // TransactionStatus indicates status of transaction transferring.
@@ -48,4 +189,74 @@ type TransactionStatus int
 const (
 	// TransactionStatusSuccess indicates that transaction was committed successfully.
 	TransactionStatusSuccess TransactionStatus = 0
+	// TransactionStatusConfirmed indicates that transaction was included to the blockchain.
+	TransactionStatusConfirmed TransactionStatus = 1
+	// TransactionStatusFailed indicates that transaction was included to the blockchain, but failed.
+	TransactionStatusFailed TransactionStatus = 2
+	// TransactionStatusUnknown indicates that transaction was sent, but its output could not be read,
+	// so it is not tracked and should be checked manually.
+	TransactionStatusUnknown TransactionStatus = 3
+)
+
+// String returns string representation of the status.
+func (status TransactionStatus) String() string {
+	switch status {
+	case TransactionStatusSuccess:
+		return "sent"
+	case TransactionStatusConfirmed:
+		return "confirmed"
+	case TransactionStatusFailed:
+		return "failed"
+	case TransactionStatusUnknown:
+		return "unknown"
+	default:
+		return "unknown"
+	}
+}
+
+// TransactionStatusFromString creates TransactionStatus from its string representation.
+// returns error if status is not supported.
+func TransactionStatusFromString(status string) (TransactionStatus, error) {
+	for _, known := range []TransactionStatus{TransactionStatusSuccess, TransactionStatusConfirmed, TransactionStatusFailed, TransactionStatusUnknown} {
+		if status == known.String() {
+			return known, nil
+		}
+	}
+
+	return 0, ValidationError.New("transaction status %q is not supported", status)
+}
+
+// EventType defines transaction lifecycle event.
+type EventType string
+
+const (
+	// EventTransactionCreated is emitted when transaction is sent and stored.
+	EventTransactionCreated EventType = "transaction.created"
+	// EventTransactionConfirmed is emitted when transaction is included to the blockchain.
+	EventTransactionConfirmed EventType = "transaction.confirmed"
+	// EventTransactionFailed is emitted when transaction is included to the blockchain, but failed.
+	EventTransactionFailed EventType = "transaction.failed"
 )
+
+// EventTypes contains all supported event types.
+var EventTypes = []EventType{EventTransactionCreated, EventTransactionConfirmed, EventTransactionFailed}
+
+// EventTypeFromStatus returns event type which is emitted when transaction gets the status.
+func EventTypeFromStatus(status TransactionStatus) EventType {
+	switch status {
+	case TransactionStatusConfirmed:
+		return EventTransactionConfirmed
+	case TransactionStatusFailed:
+		return EventTransactionFailed
+	default:
+		return EventTransactionCreated
+	}
+}
+
+// Event describes transaction status transition.
+type Event struct {
+	ID          int64       `json:"id"`
+	Type        EventType   `json:"type"`
+	Transaction Transaction `json:"transaction"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
@@ -6,18 +6,28 @@ package paxful
 import (
 	"context"
 	"errors"
+	"math"
 	"net"
-	"paxful/payments/paymentsbtc"
-	"paxful/payments/paymentseth"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/zeebo/errs"
 	"golang.org/x/sync/errgroup"
 
+	"paxful/audit"
+	"paxful/batches"
 	"paxful/console"
 	"paxful/console/server"
+	"paxful/internal/health"
 	"paxful/internal/logger"
+	"paxful/internal/logger/zaplog"
+	"paxful/internal/ratelimit"
+	"paxful/jobs"
 	"paxful/payments"
+	"paxful/payments/paymentsbtc"
 	"paxful/payments/paymentsconfig"
+	"paxful/payments/paymentseth"
+	"paxful/schedules"
+	"paxful/webhooks"
 )
 
 // DB provides access to all databases and database related functionality.
@@ -26,6 +36,26 @@ import (
 type DB interface {
 	// Transactions provides access to Transactions store.
 	Transactions() payments.TransactionsDB
+	// Audit provides access to append-only audit log.
+	Audit() audit.DB
+	// Webhooks provides access to webhook subscriptions and deliveries.
+	Webhooks() webhooks.DB
+	// Batches provides access to batch payouts.
+	Batches() batches.DB
+	// Schedules provides access to scheduled transfers.
+	Schedules() schedules.DB
+	// Jobs provides access to durable transfer queue.
+	Jobs() jobs.DB
+
+	// Ping verifies a connection to the database is still alive.
+	Ping(ctx context.Context) error
+	// CreateSchema applies all pending database migrations.
+	CreateSchema(ctx context.Context) error
+	// PendingMigrations returns amount of migrations that are not applied yet.
+	PendingMigrations(ctx context.Context) (int, error)
+
+	// Metrics returns collector of database queries metrics.
+	Metrics() prometheus.Collector
 
 	// Close closes underlying db connection.
 	Close() error
@@ -33,43 +63,127 @@ type DB interface {
 
 // Config is the global configuration for paxful payment service.
 type Config struct {
-	Server   server.Config         `json:"server"`
-	Payments paymentsconfig.Config `json:"payments"`
+	Server    server.Config          `json:"server"`
+	Console   console.Config         `json:"console"`
+	Payments  paymentsconfig.Config  `json:"payments"`
+	Health    health.Config          `json:"health"`
+	Log       zaplog.Config          `json:"log"`
+	Tracker   payments.TrackerConfig `json:"tracker"`
+	Monitor   payments.MonitorConfig `json:"monitor"`
+	Webhooks  webhooks.Config        `json:"webhooks"`
+	Batches   batches.Config         `json:"batches"`
+	Schedules schedules.Config       `json:"schedules"`
+	Jobs      jobs.Config            `json:"jobs"`
+	Reload    ReloadConfig           `json:"reload"`
 }
 
 // Peer is the representation of a paxful payment service.
 type Peer struct {
 	Log      logger.Logger
+	Config   Config
 	Listener net.Listener
 	Service  *console.Service
+	Payments payments.PaymentProvider
+	Ethereum *paymentseth.Transactions
+	Bitcoin  *paymentsbtc.Transactions
+	Events   *console.EventBus
+	Audit    *audit.Service
+	Tracker  *payments.Tracker
+	Monitor  *payments.BalanceMonitor
+	Webhooks struct {
+		Service    *webhooks.Service
+		Dispatcher *webhooks.Dispatcher
+	}
+	Batches struct {
+		Service   *batches.Service
+		Processor *batches.Processor
+	}
+	Schedules struct {
+		Service   *schedules.Service
+		Scheduler *schedules.Scheduler
+	}
+	Jobs struct {
+		Service *jobs.Service
+		Pool    *jobs.Pool
+	}
+	Health   *health.Service
+	Metrics  *prometheus.Registry
 	Database DB
 	Endpoint *server.Server
+
+	reload reloader
 }
 
 // New is a constructor for paxful payment Peer.
 func NewPeer(log logger.Logger, db DB, config Config) (peer *Peer, err error) {
 	peer = &Peer{
 		Log:      log,
+		Config:   config,
 		Database: db,
+		Metrics:  prometheus.NewRegistry(),
+	}
+	peer.reload.config = config
+
+	// every subsystem registers its collectors in the peer metrics registry.
+	err = peer.Metrics.Register(peer.Database.Metrics())
+	if err != nil {
+		return nil, err
 	}
 
-	eth, err := paymentseth.NewTransactions(peer.Log, config.Payments.Ethereum, config.Payments.CommissionPercent)
+	eth, err := paymentseth.NewTransactions(peer.Log, config.Payments.Ethereum, config.Payments.CommissionPercent, peer.Metrics)
 	if err != nil {
 		return nil, err
 	}
-	btc, err := paymentsbtc.NewTransactions(peer.Log, config.Payments.Bitcoin, config.Payments.CommissionPercent)
+	peer.Ethereum = eth
+	btc, err := paymentsbtc.NewTransactions(peer.Log, config.Payments.Bitcoin, config.Payments.CommissionPercent, peer.Metrics)
 	if err != nil {
 		return nil, err
 	}
+	peer.Bitcoin = btc
 	paymentProvider := payments.NewPaymentProvider(eth, btc)
-	peer.Service = console.NewService(paymentProvider, peer.Database.Transactions())
+	peer.Payments = paymentProvider
+	peer.Audit = audit.NewService(peer.Database.Audit())
+	peer.Events = console.NewEventBus()
+	peer.Service = console.NewService(peer.Log, config.Console, paymentProvider, peer.Database.Transactions(), peer.Audit, peer.Events)
+	peer.Tracker = payments.NewTracker(peer.Log, config.Tracker, paymentProvider, peer.Database.Transactions(), peer.Events)
+	peer.Monitor = payments.NewBalanceMonitor(peer.Log, config.Monitor, paymentProvider, map[payments.PaymentCurrency]float64{
+		payments.PaymentCurrencyETH: config.Payments.Ethereum.LowWatermark,
+		payments.PaymentCurrencyBTC: config.Payments.Bitcoin.LowWatermark,
+	})
+
+	peer.Webhooks.Service = webhooks.NewService(peer.Database.Webhooks(), peer.Audit)
+	peer.Webhooks.Dispatcher = webhooks.NewDispatcher(peer.Log, config.Webhooks, peer.Database.Webhooks())
+
+	peer.Batches.Service = batches.NewService(config.Batches, peer.Database.Batches(), peer.Service, peer.Audit)
+	peer.Batches.Processor = batches.NewProcessor(peer.Log, config.Batches, peer.Database.Batches(), peer.Service)
+
+	peer.Schedules.Service = schedules.NewService(config.Schedules, peer.Database.Schedules(), peer.Service, peer.Audit)
+	peer.Schedules.Scheduler = schedules.NewScheduler(peer.Log, config.Schedules, peer.Database.Schedules(), peer.Service)
+
+	peer.Jobs.Service = jobs.NewService(peer.Database.Jobs(), peer.Service)
+	peer.Jobs.Pool = jobs.NewPool(peer.Log, config.Jobs, peer.Database.Jobs(), peer.Service)
+
+	err = peer.registerMetrics()
+	if err != nil {
+		return nil, err
+	}
+
+	peer.Health = health.NewService(config.Health)
+	peer.Health.Register("database", health.KindHealth, peer.Database.Ping)
+	peer.Health.Register("migrations", health.KindReadiness, peer.checkMigrations)
+	peer.Health.Register("ethereum", health.KindHealth, eth.Ping)
+	peer.Health.Register("ethereum-balance", health.KindHealth, checkBalance(eth, config.Payments.Ethereum.MinBalance))
+	peer.Health.Register("bitcoin", health.KindHealth, btc.Ping)
+	peer.Health.Register("bitcoin-balance", health.KindHealth, checkBalance(btc, config.Payments.Bitcoin.MinBalance))
+	peer.Health.Register("ethereum-network", health.KindReadiness, eth.VerifyNetwork)
+	peer.Health.Register("bitcoin-network", health.KindReadiness, btc.VerifyNetwork)
 
 	peer.Listener, err = net.Listen("tcp", config.Server.Address)
 	if err != nil {
 		return nil, err
 	}
 
-	peer.Endpoint, err = server.NewServer(peer.Log, peer.Service, config.Server, peer.Listener)
+	peer.Endpoint, err = server.NewServer(peer.Log, peer.Service, peer.Webhooks.Service, peer.Batches.Service, peer.Schedules.Service, peer.Jobs.Service, peer.Health, config.Server, peer.Listener, ratelimit.NewMemoryStore(), peer.Metrics)
 	if err != nil {
 		return nil, errs.Combine(err, peer.Close())
 	}
@@ -78,15 +192,92 @@ func NewPeer(log logger.Logger, db DB, config Config) (peer *Peer, err error) {
 }
 
 // Run runs paxful payment service until it's either closed or it errors.
+//
+// Shutdown is ordered: new transfers are refused as soon as ctx is done, then web server
+// and background workers are stopped, and then Run waits for in-flight transfers,
+// so that database could be safely closed after Run returns.
 func (peer *Peer) Run(ctx context.Context) error {
-	group, ctx := errgroup.WithContext(ctx)
+	if err := peer.verifyNetworks(ctx); err != nil {
+		return err
+	}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	// refuse new transfers as soon as shutdown begins.
+	group.Go(func() error {
+		<-groupCtx.Done()
+		peer.Service.Close()
+		return nil
+	})
 
 	// start paxful payment service as a separate goroutine.
 	group.Go(func() error {
-		return ignoreCancel(peer.Endpoint.Run(ctx))
+		return ignoreCancel(peer.Endpoint.Run(groupCtx))
+	})
+
+	// background workers.
+	group.Go(func() error {
+		return ignoreCancel(peer.Ethereum.Run(groupCtx))
+	})
+	group.Go(func() error {
+		return ignoreCancel(peer.Tracker.Run(groupCtx))
+	})
+	group.Go(func() error {
+		return ignoreCancel(peer.Webhooks.Dispatcher.Run(groupCtx))
+	})
+	group.Go(func() error {
+		return ignoreCancel(peer.Monitor.Run(groupCtx))
+	})
+	group.Go(func() error {
+		return ignoreCancel(peer.Batches.Processor.Run(groupCtx))
+	})
+	group.Go(func() error {
+		return ignoreCancel(peer.Schedules.Scheduler.Run(groupCtx))
 	})
+	group.Go(func() error {
+		return ignoreCancel(peer.Jobs.Pool.Run(groupCtx))
+	})
+	group.Go(func() error {
+		return ignoreCancel(peer.watchConfig(groupCtx))
+	})
+
+	runErr := group.Wait()
 
-	return group.Wait()
+	return errs.Combine(runErr, peer.drain())
+}
+
+// verifyNetworks refuses to start if node of any currency is on another network than configured.
+// unreachable node does not prevent start, network is verified again before the first transfer.
+func (peer *Peer) verifyNetworks(ctx context.Context) error {
+	for _, currency := range peer.Payments.Currencies() {
+		transactions, err := peer.Payments.GetByCurrency(currency)
+		if err != nil {
+			return err
+		}
+
+		err = transactions.VerifyNetwork(ctx)
+		switch {
+		case payments.NetworkMismatchError.Has(err):
+			return errs.New("%s node is not on %q network: %v", currency, transactions.Network().Name, err)
+		case err != nil:
+			peer.Log.Error("could not verify network, it is verified before the first transfer", err,
+				logger.String("currency", string(currency)), logger.String("network", transactions.Network().Name))
+		}
+	}
+
+	return nil
+}
+
+// drain waits for in-flight transfers no longer than configured drain timeout.
+func (peer *Peer) drain() error {
+	ctx := context.Background()
+	if timeout := peer.Config.Server.DrainTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return peer.Service.Drain(ctx)
 }
 
 // Close closes all the resources.
@@ -104,6 +295,77 @@ func (peer *Peer) Close() error {
 	return errlist.Err()
 }
 
+// registerMetrics registers pending transfers and hot wallet balances gauges.
+func (peer *Peer) registerMetrics() error {
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "paxful",
+			Name:      "pending_transfers",
+			Help:      "Amount of transfers which are in progress.",
+		}, func() float64 {
+			return float64(peer.Service.Pending())
+		}),
+		balanceGauge(payments.PaymentCurrencyETH, peer.Monitor),
+		balanceGauge(payments.PaymentCurrencyBTC, peer.Monitor),
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	}
+
+	for _, collector := range collectors {
+		if err := peer.Metrics.Register(collector); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// balanceGauge returns gauge that reports hot wallet balance cached by the balance monitor,
+// so scrapes never query nodes. gauge reports NaN if balance could not be received.
+func balanceGauge(currency payments.PaymentCurrency, monitor *payments.BalanceMonitor) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   "paxful",
+		Name:        "hot_wallet_balance",
+		Help:        "Hot wallet balance in the main currency unit.",
+		ConstLabels: prometheus.Labels{"currency": string(currency)},
+	}, func() float64 {
+		balance, ok := monitor.Balance(currency)
+		if !ok {
+			return math.NaN()
+		}
+
+		return balance
+	})
+}
+
+// checkMigrations fails when database schema is not up to date.
+func (peer *Peer) checkMigrations(ctx context.Context) error {
+	pending, err := peer.Database.PendingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return errs.New("%d migrations are pending", pending)
+	}
+
+	return nil
+}
+
+// checkBalance returns health check that fails when hot wallet balance is below the minimum.
+func checkBalance(transactions payments.Transactions, minBalance float64) health.CheckFunc {
+	return func(ctx context.Context) error {
+		balance, err := transactions.Balance(ctx)
+		if err != nil {
+			return err
+		}
+		if balance < minBalance {
+			return errs.New("hot wallet balance %v is below %v", balance, minBalance)
+		}
+
+		return nil
+	}
+}
+
 // we ignore cancellation and stopping errors since they are expected.
 func ignoreCancel(err error) error {
 	if errors.Is(err, context.Canceled) {
@@ -0,0 +1,176 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package paxful
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/audit"
+	"paxful/internal/cfgstruct"
+	"paxful/internal/logger"
+)
+
+// ReloadError indicates that new config could not be applied to the running peer.
+var ReloadError = errs.Class("config reload error")
+
+// ReloadConfig contains configuration for live config reload.
+type ReloadConfig struct {
+	Interval time.Duration `json:"interval" help:"how often config file is checked for changes, 0 disables watching, SIGHUP always reloads config" default:"10s"`
+}
+
+// ConfigLoader loads and validates current config.
+type ConfigLoader func() (Config, error)
+
+// reloader keeps state of live config reload.
+type reloader struct {
+	path string
+	load ConfigLoader
+
+	// mu serializes reloads, config is the one which is applied now.
+	mu     sync.Mutex
+	config Config
+}
+
+// WatchConfig makes Run reload config with load on SIGHUP and whenever config file at path changes.
+// must be called before Run.
+func (peer *Peer) WatchConfig(path string, load ConfigLoader) {
+	peer.reload.path = path
+	peer.reload.load = load
+}
+
+// Reload applies fields of config with `reload:"true"` tag to the running services.
+// config is rejected as a whole if any other field is changed, so the peer never runs with partially applied config.
+func (peer *Peer) Reload(config Config) (changed []string, err error) {
+	peer.reload.mu.Lock()
+	defer peer.reload.mu.Unlock()
+
+	var fixed []string
+	for _, field := range cfgstruct.Diff(&peer.reload.config, &config, "") {
+		changed = append(changed, field.Key)
+		if !field.Reloadable {
+			fixed = append(fixed, field.Key)
+		}
+	}
+	if len(fixed) > 0 {
+		return nil, ReloadError.New("%s could not be changed without restart", strings.Join(fixed, ", "))
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	err = peer.Ethereum.Reload(config.Payments.Ethereum, config.Payments.CommissionPercent)
+	if err != nil {
+		return nil, ReloadError.Wrap(err)
+	}
+	peer.Bitcoin.Reload(config.Payments.CommissionPercent)
+	peer.Service.Reload(config.Console)
+	peer.Endpoint.Reload(config.Server)
+
+	peer.reload.config = config
+	return changed, nil
+}
+
+// watchConfig reloads config on SIGHUP and on config file change until ctx is canceled.
+func (peer *Peer) watchConfig(ctx context.Context) error {
+	if peer.reload.load == nil {
+		return nil
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var tick <-chan time.Time
+	if peer.Config.Reload.Interval > 0 {
+		ticker := time.NewTicker(peer.Config.Reload.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	modified := modTime(peer.reload.path)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-hangup:
+			peer.reloadConfig("signal")
+		case <-tick:
+			// config file is often replaced by rename, so modification time is compared instead of file events.
+			current := modTime(peer.reload.path)
+			if current.Equal(modified) {
+				continue
+			}
+			modified = current
+			peer.reloadConfig("file change")
+		}
+	}
+}
+
+// reloadConfig loads config and applies it, running config is kept if new one is invalid or not reloadable.
+func (peer *Peer) reloadConfig(trigger string) {
+	log := peer.Log.With(logger.String("trigger", trigger))
+
+	config, err := peer.reload.load()
+	if err != nil {
+		log.Error("config is not reloaded: invalid config", err)
+		peer.auditReload(trigger, nil, err)
+		return
+	}
+
+	changed, err := peer.Reload(config)
+	if err != nil {
+		log.Error("config is not reloaded", err)
+		peer.auditReload(trigger, nil, err)
+		return
+	}
+	if len(changed) == 0 {
+		log.Debug("config is not changed")
+		return
+	}
+
+	log.Info("config reloaded", logger.String("changed", strings.Join(changed, ", ")))
+	peer.auditReload(trigger, changed, nil)
+}
+
+// auditReloadDetails is a content of audit log entry details for config reloads.
+type auditReloadDetails struct {
+	Trigger string   `json:"trigger"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// auditReload records applied or rejected config reload to the audit log.
+// only keys of changed fields are recorded, values could be secrets.
+func (peer *Peer) auditReload(trigger string, changed []string, err error) {
+	outcome := audit.OutcomeSuccess
+	if err != nil {
+		outcome = audit.OutcomeRejected
+	}
+
+	details, _ := json.Marshal(auditReloadDetails{Trigger: trigger, Changed: changed})
+
+	ctx := audit.WithCaller(context.Background(), audit.Caller{Identity: "config-reload"})
+	auditErr := peer.Audit.Record(ctx, audit.ActionLimitChange, outcome, err, string(details))
+	if auditErr != nil {
+		peer.Log.Error("could not record config reload to audit log", auditErr, logger.String("details", string(details)))
+	}
+}
+
+// modTime returns modification time of the file, or zero time if it does not exist.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package schedules
+
+import (
+	"context"
+	"time"
+
+	"paxful/audit"
+	"paxful/console"
+	"paxful/internal/logger"
+)
+
+// Config contains configuration for scheduled transfers.
+type Config struct {
+	Interval     time.Duration `json:"interval" help:"how often due scheduled transfers are checked" default:"10s"`
+	BatchSize    int           `json:"batchSize" help:"maximum amount of scheduled transfers run at once" default:"20"`
+	Lease        time.Duration `json:"lease" help:"how long schedule is locked by scheduler while its transfer is sent" default:"5m"`
+	MinInterval  time.Duration `json:"minInterval" help:"minimal interval of recurring transfers" default:"1m"`
+	MaxClockSkew time.Duration `json:"maxClockSkew" help:"how far in the past executeAt is still accepted" default:"1m"`
+}
+
+// Scheduler runs due scheduled transfers.
+//
+// architecture: Worker
+type Scheduler struct {
+	log     logger.Logger
+	config  Config
+	db      DB
+	console *console.Service
+}
+
+// NewScheduler is a constructor for schedules Scheduler.
+func NewScheduler(log logger.Logger, config Config, db DB, console *console.Service) *Scheduler {
+	return &Scheduler{
+		log:     log,
+		config:  config,
+		db:      db,
+		console: console,
+	}
+}
+
+// Run runs due scheduled transfers every interval until ctx is done.
+func (scheduler *Scheduler) Run(ctx context.Context) error {
+	interval := scheduler.config.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := scheduler.RunDue(ctx); err != nil {
+			scheduler.log.Error("could not run scheduled transfers", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue runs up to batch size due scheduled transfers.
+func (scheduler *Scheduler) RunDue(ctx context.Context) error {
+	batchSize := scheduler.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = 20
+	}
+
+	lease := scheduler.config.Lease
+	if lease <= 0 {
+		lease = 5 * time.Minute
+	}
+
+	for i := 0; i < batchSize && ctx.Err() == nil; i++ {
+		schedule, err := scheduler.db.Claim(ctx, lease)
+		if err != nil {
+			if ErrNotFound.Has(err) {
+				return nil
+			}
+			return Error.Wrap(err)
+		}
+
+		stop, err := scheduler.run(ctx, schedule)
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// run sends the current run of the schedule at most once, returns true if console service does not accept transfers.
+func (scheduler *Scheduler) run(ctx context.Context, schedule Schedule) (bool, error) {
+	run := schedule.Runs + 1
+	log := scheduler.log.With(logger.String("scheduleID", schedule.ID), logger.Any("run", run))
+
+	started, previous, err := scheduler.db.BeginRun(ctx, schedule.ID, run)
+	if err != nil {
+		return false, Error.Wrap(err)
+	}
+
+	execution := Execution{Run: run}
+	if !started {
+		// run was started before, but schedule was not moved forward, transfer could be already sent.
+		execution.Status = previous
+		if previous == ExecutionStatusProcessing {
+			execution.Status = ExecutionStatusUnknown
+			execution.Error = "scheduler was stopped while transfer was sent, outcome is unknown"
+		}
+		log.Warn("scheduled run was already started, transfer is not sent again", logger.String("status", string(previous)))
+
+		return false, Error.Wrap(scheduler.db.FinishRun(ctx, schedule.ID, execution, schedule.Next(time.Now().UTC())))
+	}
+
+	// transfer is not interrupted by shutdown, console service waits for it while draining.
+	caller := audit.Caller{Identity: schedule.CreatedBy, RemoteAddr: schedule.RemoteAddr}
+	sendCtx := audit.WithCaller(logger.WithContext(context.Background(), log), caller)
+
+	transaction := schedule.Transaction
+	transaction.ExecuteAt, transaction.Recurrence = nil, nil
+
+	tx, err := scheduler.console.CommitTx(sendCtx, transaction)
+	switch {
+	case console.UnavailableError.Has(err):
+		// nothing was sent, run is retried when service is available again.
+		return true, Error.Wrap(scheduler.db.AbortRun(context.Background(), schedule.ID, run))
+	case err != nil:
+		execution.Status = ExecutionStatusFailed
+		execution.Error = err.Error()
+		log.Warn("scheduled transfer failed", logger.String("error", err.Error()))
+	default:
+		execution.Status = ExecutionStatusSent
+		execution.TxID = tx.ID
+		log.Info("scheduled transfer sent", logger.String("txID", tx.ID))
+	}
+
+	// result must be stored even if scheduler is stopping.
+	return false, Error.Wrap(scheduler.db.FinishRun(context.Background(), schedule.ID, execution, schedule.Next(time.Now().UTC())))
+}
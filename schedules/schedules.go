@@ -0,0 +1,120 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package schedules
+
+import (
+	"context"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/console"
+)
+
+var (
+	// Error is the default schedules error class.
+	Error = errs.Class("schedules error")
+	// ValidationError indicates that scheduled transfer is invalid.
+	ValidationError = errs.Class("schedule validation error")
+	// ErrNotFound indicates that scheduled transfer does not exist.
+	ErrNotFound = errs.Class("schedule not found")
+	// ErrNotActive indicates that scheduled transfer is already completed or canceled.
+	ErrNotActive = errs.Class("schedule is not active")
+)
+
+// DB exposes functionality to manage scheduled transfers.
+//
+// architecture: Database
+type DB interface {
+	// Create stores new scheduled transfer.
+	Create(ctx context.Context, schedule Schedule) error
+	// List returns all scheduled transfers ordered by next run.
+	List(ctx context.Context) ([]Schedule, error)
+	// Cancel cancels active scheduled transfer, run which is already in progress is not interrupted.
+	Cancel(ctx context.Context, id string) error
+
+	// Claim leases the earliest due active schedule for the lease duration, so concurrent schedulers
+	// never run the same schedule at once. returns ErrNotFound if nothing is due.
+	Claim(ctx context.Context, lease time.Duration) (Schedule, error)
+	// BeginRun records the start of the run, it is an idempotency key of the transfer.
+	// returns false and status of the existing execution if the run was already started.
+	BeginRun(ctx context.Context, id string, run int) (bool, ExecutionStatus, error)
+	// FinishRun stores run result and moves schedule to the next run, or completes it if next is nil.
+	FinishRun(ctx context.Context, id string, execution Execution, next *time.Time) error
+	// AbortRun removes started run which did not send anything and releases the lease, so the run is retried.
+	AbortRun(ctx context.Context, id string, run int) error
+}
+
+// Status indicates state of the scheduled transfer.
+type Status string
+
+const (
+	// StatusActive indicates that schedule has runs in the future.
+	StatusActive Status = "active"
+	// StatusCompleted indicates that all runs are done.
+	StatusCompleted Status = "completed"
+	// StatusCanceled indicates that schedule was canceled by client.
+	StatusCanceled Status = "canceled"
+)
+
+// ExecutionStatus indicates result of the single run.
+type ExecutionStatus string
+
+const (
+	// ExecutionStatusProcessing indicates that transfer is being sent.
+	ExecutionStatusProcessing ExecutionStatus = "processing"
+	// ExecutionStatusSent indicates that transfer was broadcasted.
+	ExecutionStatusSent ExecutionStatus = "sent"
+	// ExecutionStatusFailed indicates that transfer was not sent.
+	ExecutionStatusFailed ExecutionStatus = "failed"
+	// ExecutionStatusUnknown indicates that scheduler was stopped while transfer was being sent,
+	// transfer is not retried since it could be already broadcasted.
+	ExecutionStatusUnknown ExecutionStatus = "unknown"
+)
+
+// Schedule is a delayed, and optionally recurring, transfer.
+type Schedule struct {
+	ID          string              `json:"id"`
+	Transaction console.Transaction `json:"transaction"`
+	Status      Status              `json:"status"`
+	// NextRunAt is a time of the next run.
+	NextRunAt time.Time `json:"nextRunAt"`
+	// Interval is a time between runs, 0 means that transfer runs once.
+	Interval time.Duration `json:"-"`
+	// Count is a total amount of runs of recurring transfer, 0 means unlimited.
+	Count int `json:"count,omitempty"`
+	// Runs is an amount of finished runs.
+	Runs int `json:"runs"`
+
+	LastTxID  string `json:"lastTxId,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+
+	CreatedBy  string    `json:"createdBy"`
+	RemoteAddr string    `json:"-"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Next returns time of the run after the current one, or nil if current run is the last one.
+// missed runs are skipped, so transfer is not repeated many times after long downtime.
+func (schedule Schedule) Next(now time.Time) *time.Time {
+	run := schedule.Runs + 1
+	if schedule.Interval <= 0 || (schedule.Count > 0 && run >= schedule.Count) {
+		return nil
+	}
+
+	next := schedule.NextRunAt.Add(schedule.Interval)
+	for !next.After(now) {
+		next = next.Add(schedule.Interval)
+	}
+
+	return &next
+}
+
+// Execution is a result of the single run.
+type Execution struct {
+	Run    int             `json:"run"`
+	Status ExecutionStatus `json:"status"`
+	TxID   string          `json:"txId,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package schedules
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/audit"
+	"paxful/console"
+)
+
+// Service exposes functionality to create, list and cancel scheduled transfers.
+//
+// architecture: Service
+type Service struct {
+	config  Config
+	db      DB
+	console *console.Service
+	audit   *audit.Service
+}
+
+// NewService is a constructor for schedules Service.
+func NewService(config Config, db DB, console *console.Service, audit *audit.Service) *Service {
+	return &Service{
+		config:  config,
+		db:      db,
+		console: console,
+		audit:   audit,
+	}
+}
+
+// Create validates transfer and stores it to be sent at ExecuteAt, and then repeated according to Recurrence.
+func (service *Service) Create(ctx context.Context, transaction console.Transaction) (schedule Schedule, err error) {
+	defer func() {
+		err = errs.Combine(err, service.record(ctx, audit.ActionScheduleCreate, err, schedule.ID, transaction))
+	}()
+
+	if transaction.ExecuteAt == nil {
+		return Schedule{}, ValidationError.New("executeAt is required for scheduled transfer")
+	}
+
+	now := time.Now().UTC()
+	if transaction.ExecuteAt.Before(now.Add(-service.config.MaxClockSkew)) {
+		return Schedule{}, ValidationError.New("executeAt is in the past")
+	}
+
+	var interval time.Duration
+	var count int
+	if transaction.Recurrence != nil {
+		interval, err = transaction.Recurrence.Interval()
+		if err != nil {
+			return Schedule{}, ValidationError.Wrap(err)
+		}
+		if interval < service.config.MinInterval {
+			return Schedule{}, ValidationError.New("recurrence interval must be at least %s", service.config.MinInterval)
+		}
+		if transaction.Recurrence.Count < 0 {
+			return Schedule{}, ValidationError.New("recurrence count must not be negative")
+		}
+		count = transaction.Recurrence.Count
+	}
+
+	if err = service.console.Validate(ctx, transaction); err != nil {
+		return Schedule{}, ValidationError.Wrap(err)
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return Schedule{}, Error.Wrap(err)
+	}
+
+	caller := audit.CallerFromContext(ctx)
+	candidate := Schedule{
+		ID:          id,
+		Transaction: transaction,
+		Status:      StatusActive,
+		NextRunAt:   transaction.ExecuteAt.UTC(),
+		Interval:    interval,
+		Count:       count,
+		CreatedBy:   caller.Identity,
+		RemoteAddr:  caller.RemoteAddr,
+		CreatedAt:   now,
+	}
+
+	if err = service.db.Create(ctx, candidate); err != nil {
+		return Schedule{}, Error.Wrap(err)
+	}
+
+	return candidate, nil
+}
+
+// List returns all scheduled transfers.
+func (service *Service) List(ctx context.Context) ([]Schedule, error) {
+	schedules, err := service.db.List(ctx)
+	return schedules, Error.Wrap(err)
+}
+
+// Cancel cancels scheduled transfer, so it is not run anymore.
+func (service *Service) Cancel(ctx context.Context, id string) (err error) {
+	defer func() {
+		err = errs.Combine(err, service.record(ctx, audit.ActionScheduleCancel, err, id, console.Transaction{}))
+	}()
+
+	err = service.db.Cancel(ctx, id)
+	if ErrNotFound.Has(err) || ErrNotActive.Has(err) {
+		return err
+	}
+
+	return Error.Wrap(err)
+}
+
+// record writes schedule management action to the audit log, every run is recorded separately when sent.
+func (service *Service) record(ctx context.Context, action audit.Action, actionErr error, id string, transaction console.Transaction) error {
+	outcome := audit.OutcomeSuccess
+	switch {
+	case ValidationError.Has(actionErr), ErrNotFound.Has(actionErr), ErrNotActive.Has(actionErr):
+		outcome = audit.OutcomeRejected
+	case actionErr != nil:
+		outcome = audit.OutcomeFailed
+	}
+
+	details, err := json.Marshal(struct {
+		ScheduleID string               `json:"scheduleId,omitempty"`
+		Request    *console.Transaction `json:"request,omitempty"`
+	}{ScheduleID: id, Request: requestDetails(transaction)})
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	return service.audit.Record(ctx, action, outcome, actionErr, string(details))
+}
+
+// requestDetails returns transfer request to be recorded, or nil if there is no request.
+func requestDetails(transaction console.Transaction) *console.Transaction {
+	if transaction == (console.Transaction{}) {
+		return nil
+	}
+
+	return &transaction
+}
+
+// randomHex returns hex encoded random bytes.
+func randomHex(size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
@@ -0,0 +1,177 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/internal/logger"
+)
+
+// Config contains configuration for webhooks dispatcher.
+type Config struct {
+	Interval       time.Duration `json:"interval" help:"how often pending deliveries are checked" default:"5s"`
+	BatchSize      int           `json:"batchSize" help:"maximum amount of deliveries sent concurrently at once" default:"20"`
+	Timeout        time.Duration `json:"timeout" help:"timeout of a single webhook request" default:"10s"`
+	MaxAttempts    int           `json:"maxAttempts" help:"amount of attempts before delivery is moved to dead-letter state" default:"10"`
+	InitialBackoff time.Duration `json:"initialBackoff" help:"delay before the first retry, doubled on every next retry" default:"10s"`
+	MaxBackoff     time.Duration `json:"maxBackoff" help:"maximum delay between retries" default:"1h"`
+}
+
+// Dispatcher sends signed outbox events to subscribed webhook urls with retries.
+//
+// architecture: Worker
+type Dispatcher struct {
+	log    logger.Logger
+	config Config
+	db     DB
+	client *http.Client
+}
+
+// NewDispatcher is a constructor for webhooks Dispatcher.
+func NewDispatcher(log logger.Logger, config Config, db DB) *Dispatcher {
+	return &Dispatcher{
+		log:    log,
+		config: config,
+		db:     db,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// Run sends pending deliveries every interval until ctx is done.
+func (dispatcher *Dispatcher) Run(ctx context.Context) error {
+	interval := dispatcher.config.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := dispatcher.Dispatch(ctx); err != nil {
+			dispatcher.log.Error("could not dispatch webhooks", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch sends single batch of due deliveries.
+func (dispatcher *Dispatcher) Dispatch(ctx context.Context) error {
+	batchSize := dispatcher.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = 20
+	}
+
+	// deliveries are sent concurrently and are not waited for longer than half of the lease,
+	// so the lease could not expire and deliveries could not be claimed twice while they are being sent.
+	lease := 2*dispatcher.config.Timeout + time.Minute
+	deliveries, err := dispatcher.db.ClaimDeliveries(ctx, batchSize, lease)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, lease/2)
+	defer cancel()
+
+	results := make([]error, len(deliveries))
+	var wg sync.WaitGroup
+	for i, delivery := range deliveries {
+		wg.Add(1)
+		go func(i int, delivery Delivery) {
+			defer wg.Done()
+			results[i] = dispatcher.send(sendCtx, delivery)
+		}(i, delivery)
+	}
+	wg.Wait()
+
+	var group errs.Group
+	for i, delivery := range deliveries {
+		sendErr := results[i]
+		if sendErr == nil {
+			group.Add(dispatcher.db.MarkDelivered(ctx, delivery.ID))
+			continue
+		}
+
+		attempts := delivery.Attempts + 1
+		dead := dispatcher.config.MaxAttempts > 0 && attempts >= dispatcher.config.MaxAttempts
+		nextAttemptAt := time.Now().Add(dispatcher.backoff(attempts))
+
+		log := dispatcher.log.With(
+			logger.Any("deliveryID", delivery.ID),
+			logger.String("subscriptionID", delivery.SubscriptionID),
+			logger.Any("attempts", attempts),
+		)
+		if dead {
+			log.Error("webhook delivery moved to dead-letter state", sendErr)
+		} else {
+			log.Warn("webhook delivery failed", logger.String("error", sendErr.Error()))
+		}
+
+		group.Add(dispatcher.db.MarkFailed(ctx, delivery.ID, nextAttemptAt, dead, sendErr.Error()))
+	}
+
+	return Error.Wrap(group.Err())
+}
+
+// send posts signed event payload to the subscription url.
+func (dispatcher *Dispatcher) send(ctx context.Context, delivery Delivery) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(delivery.EventType))
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := dispatcher.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+		err = errs.Combine(err, resp.Body.Close())
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errs.New("receiver responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// backoff returns delay before the next attempt, which grows exponentially.
+func (dispatcher *Dispatcher) backoff(attempts int) time.Duration {
+	delay := dispatcher.config.InitialBackoff
+	if delay <= 0 {
+		delay = 10 * time.Second
+	}
+
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if dispatcher.config.MaxBackoff > 0 && delay >= dispatcher.config.MaxBackoff {
+			return dispatcher.config.MaxBackoff
+		}
+	}
+
+	return delay
+}
@@ -0,0 +1,282 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package webhooks_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"paxful/internal/logger/zaplog"
+	"paxful/payments"
+	"paxful/webhooks"
+)
+
+func TestDispatcherRetriesUntilDelivered(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDB()
+
+	const secret = "secret"
+	payload := []byte(`{"id":"tx"}`)
+
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		attempt := requests
+		mu.Unlock()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("could not read request body: %v", err)
+		}
+
+		timestamp, err := strconv.ParseInt(r.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+		if err != nil {
+			t.Errorf("invalid timestamp header: %v", err)
+		}
+		if !webhooks.Verify(secret, timestamp, body, r.Header.Get(webhooks.HeaderSignature)) {
+			t.Errorf("request %d signature %q is not valid", attempt, r.Header.Get(webhooks.HeaderSignature))
+		}
+		if event := r.Header.Get(webhooks.HeaderEvent); event != string(payments.EventTransactionCreated) {
+			t.Errorf("request %d event header %q", attempt, event)
+		}
+		if id := r.Header.Get(webhooks.HeaderDelivery); id != "1" {
+			t.Errorf("request %d delivery header %q", attempt, id)
+		}
+
+		// delivery is leased while it is sent, so other dispatchers could not claim it.
+		claimed, err := db.ClaimDeliveries(r.Context(), 10, time.Minute)
+		if err != nil || len(claimed) != 0 {
+			t.Errorf("delivery being sent is claimed again: %d deliveries, error %v", len(claimed), err)
+		}
+
+		if attempt <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	db.add(webhooks.Delivery{
+		ID:             1,
+		EventType:      payments.EventTransactionCreated,
+		Payload:        payload,
+		SubscriptionID: "subscription",
+		URL:            receiver.URL,
+		Secret:         secret,
+	})
+
+	config := webhooks.Config{
+		BatchSize:      10,
+		Timeout:        time.Second,
+		MaxAttempts:    5,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     90 * time.Second,
+	}
+	dispatcher := webhooks.NewDispatcher(zaplog.NewLog(), config, db)
+
+	// first attempt fails with 5xx and is scheduled after initial backoff.
+	start := time.Now()
+	if err := dispatcher.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	delivery := db.get(1)
+	if delivery.status != webhooks.DeliveryStatusPending || delivery.Attempts != 1 || delivery.lastError == "" {
+		t.Fatalf("delivery after first failure: status %q, attempts %d, last error %q", delivery.status, delivery.Attempts, delivery.lastError)
+	}
+	if delay := delivery.nextAttemptAt.Sub(start); delay < config.InitialBackoff || delay > config.InitialBackoff+time.Minute {
+		t.Fatalf("first retry is scheduled after %v, expected %v", delay, config.InitialBackoff)
+	}
+	if lease := db.lastLease(); lease < 2*config.Timeout {
+		t.Fatalf("delivery is leased for %v, which is shorter than sending it", lease)
+	}
+
+	// retry is not sent until backoff passes.
+	if err := dispatcher.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.get(1); got.Attempts != 1 {
+		t.Fatalf("delivery is retried before backoff, attempts %d", got.Attempts)
+	}
+
+	// second failure doubles the backoff, but never exceeds maximum.
+	db.due(1)
+	start = time.Now()
+	if err := dispatcher.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	delivery = db.get(1)
+	if delivery.status != webhooks.DeliveryStatusPending || delivery.Attempts != 2 {
+		t.Fatalf("delivery after second failure: status %q, attempts %d", delivery.status, delivery.Attempts)
+	}
+	if delay := delivery.nextAttemptAt.Sub(start); delay < config.MaxBackoff || delay > config.MaxBackoff+time.Minute {
+		t.Fatalf("second retry is scheduled after %v, expected %v", delay, config.MaxBackoff)
+	}
+
+	db.due(1)
+	if err := dispatcher.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	delivery = db.get(1)
+	if delivery.status != webhooks.DeliveryStatusDelivered {
+		t.Fatalf("delivery after successful attempt: status %q", delivery.status)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 3 {
+		t.Fatalf("receiver got %d requests, expected 3", requests)
+	}
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDB()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	db.add(webhooks.Delivery{ID: 1, Payload: []byte(`{}`), URL: receiver.URL, Secret: "secret"})
+
+	dispatcher := webhooks.NewDispatcher(zaplog.NewLog(), webhooks.Config{Timeout: time.Second, MaxAttempts: 2}, db)
+	for attempt := 1; attempt <= 2; attempt++ {
+		db.due(1)
+		if err := dispatcher.Dispatch(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	delivery := db.get(1)
+	if delivery.status != webhooks.DeliveryStatusDead || delivery.Attempts != 2 {
+		t.Fatalf("delivery after all attempts: status %q, attempts %d", delivery.status, delivery.Attempts)
+	}
+
+	// dead deliveries are never claimed again.
+	db.due(1)
+	if err := dispatcher.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.get(1); got.Attempts != 2 {
+		t.Fatalf("dead delivery is retried, attempts %d", got.Attempts)
+	}
+}
+
+// memoryDelivery is a delivery with its stored state.
+type memoryDelivery struct {
+	webhooks.Delivery
+	status        webhooks.DeliveryStatus
+	nextAttemptAt time.Time
+	lastError     string
+}
+
+// memoryDB keeps deliveries in memory and leases them the same way database does.
+type memoryDB struct {
+	mu         sync.Mutex
+	deliveries map[int64]*memoryDelivery
+	lease      time.Duration
+}
+
+func newMemoryDB() *memoryDB {
+	return &memoryDB{deliveries: make(map[int64]*memoryDelivery)}
+}
+
+func (db *memoryDB) add(delivery webhooks.Delivery) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.deliveries[delivery.ID] = &memoryDelivery{
+		Delivery:      delivery,
+		status:        webhooks.DeliveryStatusPending,
+		nextAttemptAt: time.Now(),
+	}
+}
+
+func (db *memoryDB) get(id int64) memoryDelivery {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return *db.deliveries[id]
+}
+
+// due makes the delivery due now.
+func (db *memoryDB) due(id int64) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.deliveries[id].nextAttemptAt = time.Now()
+}
+
+func (db *memoryDB) lastLease() time.Duration {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.lease
+}
+
+func (db *memoryDB) CreateSubscription(ctx context.Context, subscription webhooks.Subscription) error {
+	return nil
+}
+
+func (db *memoryDB) ListSubscriptions(ctx context.Context) ([]webhooks.Subscription, error) {
+	return nil, nil
+}
+
+func (db *memoryDB) DeleteSubscription(ctx context.Context, id string) error {
+	return nil
+}
+
+func (db *memoryDB) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]webhooks.Delivery, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var claimed []webhooks.Delivery
+	for _, delivery := range db.deliveries {
+		if len(claimed) >= limit {
+			break
+		}
+		if delivery.status != webhooks.DeliveryStatusPending || delivery.nextAttemptAt.After(time.Now()) {
+			continue
+		}
+
+		delivery.nextAttemptAt = time.Now().Add(lease)
+		db.lease = lease
+		claimed = append(claimed, delivery.Delivery)
+	}
+
+	return claimed, nil
+}
+
+func (db *memoryDB) MarkDelivered(ctx context.Context, id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.deliveries[id].status = webhooks.DeliveryStatusDelivered
+	return nil
+}
+
+func (db *memoryDB) MarkFailed(ctx context.Context, id int64, nextAttemptAt time.Time, dead bool, lastError string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delivery := db.deliveries[id]
+	delivery.Attempts++
+	delivery.nextAttemptAt, delivery.lastError = nextAttemptAt, lastError
+	if dead {
+		delivery.status = webhooks.DeliveryStatusDead
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/audit"
+	"paxful/payments"
+)
+
+// Service exposes functionality to manage webhook subscriptions.
+//
+// architecture: Service
+type Service struct {
+	db    DB
+	audit *audit.Service
+}
+
+// NewService is a constructor for webhooks Service.
+func NewService(db DB, audit *audit.Service) *Service {
+	return &Service{
+		db:    db,
+		audit: audit,
+	}
+}
+
+// Create registers new subscription, all events are sent if events list is empty.
+// returned subscription contains secret which is used to sign requests.
+func (service *Service) Create(ctx context.Context, rawURL string, events []payments.EventType) (_ Subscription, err error) {
+	defer func() { err = errs.Combine(err, service.record(ctx, audit.ActionWebhookCreate, err, rawURL)) }()
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return Subscription{}, ValidationError.Wrap(err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return Subscription{}, ValidationError.New("url must be absolute http or https url")
+	}
+
+	if len(events) == 0 {
+		events = payments.EventTypes
+	}
+	for _, event := range events {
+		if !isKnownEvent(event) {
+			return Subscription{}, ValidationError.New("unknown event type %q", event)
+		}
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return Subscription{}, Error.Wrap(err)
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return Subscription{}, Error.Wrap(err)
+	}
+
+	subscription := Subscription{
+		ID:        id,
+		URL:       parsed.String(),
+		Events:    events,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	err = service.db.CreateSubscription(ctx, subscription)
+	if err != nil {
+		return Subscription{}, Error.Wrap(err)
+	}
+
+	return subscription, nil
+}
+
+// List returns all subscriptions without secrets.
+func (service *Service) List(ctx context.Context) ([]Subscription, error) {
+	subscriptions, err := service.db.ListSubscriptions(ctx)
+	return subscriptions, Error.Wrap(err)
+}
+
+// Delete removes subscription, its pending deliveries are not sent anymore.
+func (service *Service) Delete(ctx context.Context, id string) (err error) {
+	defer func() { err = errs.Combine(err, service.record(ctx, audit.ActionWebhookDelete, err, id)) }()
+
+	err = service.db.DeleteSubscription(ctx, id)
+	if ErrNotFound.Has(err) {
+		return err
+	}
+
+	return Error.Wrap(err)
+}
+
+// record writes subscription management action to the audit log.
+func (service *Service) record(ctx context.Context, action audit.Action, actionErr error, details string) error {
+	outcome := audit.OutcomeSuccess
+	switch {
+	case ValidationError.Has(actionErr), ErrNotFound.Has(actionErr):
+		outcome = audit.OutcomeRejected
+	case actionErr != nil:
+		outcome = audit.OutcomeFailed
+	}
+
+	return service.audit.Record(ctx, action, outcome, actionErr, details)
+}
+
+// isKnownEvent checks that event type is supported.
+func isKnownEvent(event payments.EventType) bool {
+	for _, known := range payments.EventTypes {
+		if event == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// randomHex returns hex encoded random bytes.
+func randomHex(size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
@@ -0,0 +1,105 @@
+// Copyright (C) 2020 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"paxful/payments"
+)
+
+var (
+	// Error is the default webhooks error class.
+	Error = errs.Class("webhooks error")
+	// ValidationError indicates that subscription data is invalid.
+	ValidationError = errs.Class("webhook validation error")
+	// ErrNotFound indicates that subscription does not exist.
+	ErrNotFound = errs.Class("webhook subscription not found")
+)
+
+// headers of webhook requests.
+const (
+	HeaderEvent     = "X-Paxful-Event"
+	HeaderDelivery  = "X-Paxful-Delivery"
+	HeaderTimestamp = "X-Paxful-Timestamp"
+	HeaderSignature = "X-Paxful-Signature"
+)
+
+// DB exposes functionality to manage webhook subscriptions and deliveries.
+//
+// architecture: Database
+type DB interface {
+	// CreateSubscription stores new subscription.
+	CreateSubscription(ctx context.Context, subscription Subscription) error
+	// ListSubscriptions returns all subscriptions without secrets.
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+	// DeleteSubscription removes subscription with all its pending deliveries.
+	DeleteSubscription(ctx context.Context, id string) error
+
+	// ClaimDeliveries leases up to limit due pending deliveries for the lease duration,
+	// so concurrent dispatchers never send the same delivery at once.
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]Delivery, error)
+	// MarkDelivered marks delivery as successfully sent.
+	MarkDelivered(ctx context.Context, id int64) error
+	// MarkFailed records failed attempt, delivery is moved to dead-letter state if dead is true.
+	MarkFailed(ctx context.Context, id int64, nextAttemptAt time.Time, dead bool, lastError string) error
+}
+
+// Subscription is a registered receiver of transaction events.
+type Subscription struct {
+	ID     string               `json:"id"`
+	URL    string               `json:"url"`
+	Events []payments.EventType `json:"events"`
+	// Secret is used to sign requests, it is returned only once on creation.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DeliveryStatus indicates state of the event delivery.
+type DeliveryStatus string
+
+const (
+	// DeliveryStatusPending indicates that delivery is waiting for the next attempt.
+	DeliveryStatusPending DeliveryStatus = "pending"
+	// DeliveryStatusDelivered indicates that receiver acknowledged the event.
+	DeliveryStatusDelivered DeliveryStatus = "delivered"
+	// DeliveryStatusDead indicates that all attempts failed and delivery is not retried anymore.
+	DeliveryStatusDead DeliveryStatus = "dead"
+)
+
+// Delivery is an event which should be sent to the subscription.
+type Delivery struct {
+	ID        int64
+	EventID   int64
+	EventType payments.EventType
+	Payload   []byte
+	Attempts  int
+
+	SubscriptionID string
+	URL            string
+	Secret         string
+}
+
+// Sign returns signature of the webhook request body sent at timestamp.
+// receivers should compute the same value and compare it with X-Paxful-Signature header.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	_, _ = mac.Write([]byte("."))
+	_, _ = mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks signature of the webhook request body.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}